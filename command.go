@@ -22,13 +22,19 @@ package writ
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 	"unicode"
+	"unicode/utf8"
 )
 
 type commandError struct {
@@ -81,18 +87,312 @@ func (p Path) findOption(name string) *Option {
 	return nil
 }
 
+// skippedOption reports whether name belongs to an option of a command in p
+// that was left out by goos or goarch tags.
+func (p Path) skippedOption(name string) bool {
+	for _, cmd := range p {
+		if containsString(cmd.skippedNames, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOption is identical to findOption, except that names are compared
+// after applying normalize to both the given name and the option names.  If
+// normalize is nil, names are compared exactly.
+func (p Path) matchOption(name string, normalize func(string) string) *Option {
+	if normalize == nil {
+		return p.findOption(name)
+	}
+	name = normalize(name)
+	for i := len(p) - 1; i >= 0; i-- {
+		for _, o := range p[i].Options {
+			for _, n := range o.Names {
+				if normalize(n) == name {
+					return o
+				}
+			}
+		}
+	}
+	return nil
+}
+
 // New reads the input spec, searching for fields tagged with "option",
 // "flag", or "command".  The field type and tags are used to construct
 // a corresponding Command instance, which can be used to decode program
 // arguments.  See the package overview documentation for details.
 //
+// Any opts are applied to the constructed Command in order.
+//
 // NOTE: The spec value must be a pointer to a struct.
-func New(name string, spec interface{}) *Command {
+func New(name string, spec interface{}, opts ...ConfigOption) *Command {
 	cmd := parseCommandSpec(name, spec, nil)
+	cmd.specType = reflect.TypeOf(spec)
+	for _, opt := range opts {
+		opt(cmd)
+	}
+	cmd.validate()
+	return cmd
+}
+
+// ConfigOption configures a Command constructed by New().  ConfigOptions are
+// applied after the command tree is built from the spec, so they may inspect
+// and modify the tree.  Most ConfigOptions set the corresponding field of the
+// top-level Command, and are equivalent to setting the field after New()
+// returns.
+type ConfigOption func(*Command)
+
+// WithStrictDefaults sets the StrictDefaults field.
+func WithStrictDefaults() ConfigOption {
+	return func(c *Command) {
+		c.StrictDefaults = true
+	}
+}
+
+// WithWarnings sets the Warnings field to w.
+func WithWarnings(w io.Writer) ConfigOption {
+	return func(c *Command) {
+		c.Warnings = w
+	}
+}
+
+// WithTerminator sets the Terminator field to terminator.
+func WithTerminator(terminator string) ConfigOption {
+	return func(c *Command) {
+		c.Terminator = terminator
+	}
+}
+
+// WithoutTerminator sets the DisableTerminator field.
+func WithoutTerminator() ConfigOption {
+	return func(c *Command) {
+		c.DisableTerminator = true
+	}
+}
+
+// WithSubcommandTerminator sets the SubcommandTerminator field to terminator.
+func WithSubcommandTerminator(terminator string) ConfigOption {
+	return func(c *Command) {
+		c.SubcommandTerminator = terminator
+	}
+}
+
+// WithGlobalsBeforeSubcommand sets the GlobalsBeforeSubcommand field.
+func WithGlobalsBeforeSubcommand() ConfigOption {
+	return func(c *Command) {
+		c.GlobalsBeforeSubcommand = true
+	}
+}
+
+// WithoutShortClustering sets the DisableShortClustering field.
+func WithoutShortClustering() ConfigOption {
+	return func(c *Command) {
+		c.DisableShortClustering = true
+	}
+}
+
+// WithNormalizeName sets the NormalizeName field to normalize.
+func WithNormalizeName(normalize func(string) string) ConfigOption {
+	return func(c *Command) {
+		c.NormalizeName = normalize
+	}
+}
+
+// WithPositionalTransform sets the PositionalTransform field to transform.
+func WithPositionalTransform(transform func(string) (string, error)) ConfigOption {
+	return func(c *Command) {
+		c.PositionalTransform = transform
+	}
+}
+
+// ErrHelpRequested is returned by Decode() when a help flag added by
+// WithAutoHelp() is specified.  The returned Path selects the command whose
+// help was requested.
+var ErrHelpRequested = errors.New("help requested")
+
+// ErrStopParsing may be returned by an OptionDecoder to stop parsing
+// immediately, such as for a --version flag.  The option is counted as
+// specified, and Decode() returns ErrStopParsing along with the Path and
+// positional arguments parsed so far.  The remaining arguments are ignored,
+// and checks that require all arguments to be parsed, such as an Option's
+// MinValues, are skipped.
+//
+//	path, positional, err := cmd.Decode(os.Args[1:])
+//	if err == writ.ErrStopParsing {
+//		fmt.Println(version)
+//		os.Exit(0)
+//	}
+var ErrStopParsing = errors.New("parsing stopped")
+
+// DecodeError is returned by Decode() and its variants when an option
+// argument can't be processed, such as when the option isn't recognized or
+// its value fails to decode.  Command is the last command selected on the
+// path when the error occurred, and is suitable for displaying contextual
+// help via Command.WriteHelp().
+type DecodeError struct {
+	Command *Command
+	Err     error
+}
+
+// Error returns the message of the underlying error.
+func (e *DecodeError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error, so that errors.Is() and errors.As()
+// can match errors returned by option decoders.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// WithAutoHelp adds a "-h, --help" flag to the command and each of its
+// subcommands.  When the flag is specified, Decode() returns
+// ErrHelpRequested instead of any other error, and the Path's last command
+// is the one to display help for:
+//
+//	path, positional, err := cmd.Decode(os.Args[1:])
+//	if err == writ.ErrHelpRequested {
+//		path.Last().ExitHelp(nil)
+//	}
+//
+// Commands that already have a "help" option are left unchanged, and the
+// "h" name is omitted on commands that already use it.  The flag is listed
+// first in the command's first OptionGroup.
+func WithAutoHelp() ConfigOption {
+	return func(c *Command) {
+		c.addAutoHelp()
+	}
+}
+
+func (c *Command) addAutoHelp() {
+	if c.Option("help") == nil {
+		names := []string{"h", "help"}
+		if c.Option("h") != nil {
+			names = []string{"help"}
+		}
+		opt := &Option{
+			Names:       names,
+			Flag:        true,
+			Description: "Display this help message and exit",
+			Decoder:     autoHelpDecoder{},
+			autoHelp:    true,
+		}
+		c.Options = append(c.Options, opt)
+		if len(c.Help.OptionGroups) == 0 {
+			c.Help.OptionGroups = []OptionGroup{{Header: "Available Options:"}}
+		}
+		first := &c.Help.OptionGroups[0]
+		first.Options = append([]*Option{opt}, first.Options...)
+	}
+	for _, sub := range c.Subcommands {
+		sub.addAutoHelp()
+	}
+}
+
+// autoHelpDecoder decodes help flags added by WithAutoHelp().  The flag's
+// presence is detected by the parser, so decoding has no effect.
+type autoHelpDecoder struct{}
+
+func (autoHelpDecoder) Decode(arg string) error {
+	return nil
+}
+
+// Describe reads the input spec in the same manner as New(), but for
+// introspection only, such as generating help output or documentation.  The
+// spec may be a struct or a pointer to a struct, and is never modified.  The
+// returned Command's options use decoders that ignore their arguments, so
+// decoding with it has no effect.
+func Describe(name string, spec interface{}) *Command {
+	rval := reflect.ValueOf(spec)
+	if rval.Kind() == reflect.Ptr {
+		if rval.IsNil() {
+			panicCommand("command spec must not be a nil pointer")
+		}
+		rval = rval.Elem()
+	}
+	if rval.Kind() != reflect.Struct {
+		panicCommand("command spec must be a struct or a pointer to struct type, not %s", rval.Kind())
+	}
+	dup := reflect.New(rval.Type())
+	copySpec(dup.Elem(), rval)
+
+	cmd := parseCommandSpec(name, dup.Interface(), nil)
 	cmd.validate()
+	cmd.describeOnly()
 	return cmd
 }
 
+// copySpec copies the command spec src to dst.  Subcommand fields are copied
+// recursively, including those referenced by pointers, so dst shares no
+// subcommand specs with src.
+func copySpec(dst, src reflect.Value) {
+	dst.Set(src)
+	for i := 0; i < src.NumField(); i++ {
+		field := src.Type().Field(i)
+		if field.Tag.Get(commandTag) == "" {
+			continue
+		}
+		switch field.Type.Kind() {
+		case reflect.Struct:
+			copySpec(dst.Field(i), src.Field(i))
+		case reflect.Ptr:
+			if src.Field(i).IsNil() || field.Type.Elem().Kind() != reflect.Struct {
+				continue
+			}
+			sub := reflect.New(field.Type.Elem())
+			copySpec(sub.Elem(), src.Field(i).Elem())
+			dst.Field(i).Set(sub)
+		}
+	}
+}
+
+// describeOnly replaces the decoders of c and its subcommands, including
+// those of environment-only fields, with decoders that ignore their
+// arguments.  The replacements retain the placeholders of the original
+// decoders for help output.
+func (c *Command) describeOnly() {
+	for _, o := range c.Options {
+		o.Decoder = describedDecoder{typePlaceholder(o.Decoder)}
+	}
+	for _, o := range c.envFields {
+		o.Decoder = describedDecoder{typePlaceholder(o.Decoder)}
+	}
+	for _, sub := range c.Subcommands {
+		sub.describeOnly()
+	}
+}
+
+type describedDecoder struct {
+	placeholder string
+}
+
+func (describedDecoder) Decode(arg string) error {
+	return nil
+}
+
+// Validate reads the input spec in the same manner as New(), returning an
+// error if the spec is invalid.  Whereas New() panics on invalid specs, as
+// they indicate programmer error, Validate is intended for tests and tooling
+// that check specs.
+func Validate(spec interface{}) (err error) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			switch e := r.(type) {
+			case commandError:
+				err = e
+			case optionError:
+				err = e
+			default:
+				panic(e)
+			}
+		}
+	}()
+	New("command", spec)
+	return nil
+}
+
 // Command specifies program options and subcommands.
 //
 // NOTE: If building a *Command directly without New(), the Help output
@@ -108,7 +408,149 @@ type Command struct {
 	Options     []*Option
 	Subcommands []*Command
 	Help        Help
-	Description string // Commands without descriptions are hidden
+	Description string   // Commands without descriptions are hidden
+	ArgNames    []string // Positional argument names for help output (e.g. SOURCE DEST)
+
+	// LongDescription is a detailed description for documentation such as
+	// man pages.  It isn't displayed by the default help template.
+	LongDescription string
+
+	// Meta holds arbitrary user data, such as categories or permissions for
+	// tools built around writ.  The writ package never reads or modifies
+	// Meta.
+	Meta map[string]interface{}
+
+	// StrictDefaults causes Decode to return an error when an "env" or
+	// "default" value fails to decode.  By default, invalid environment
+	// values are ignored.  Only the value on the top-level command is used.
+	StrictDefaults bool
+
+	// Warnings receives non-fatal diagnostics from Decode, such as ignored
+	// environment values.  If nil, warnings are discarded.  Set Warnings to
+	// os.Stderr for typical CLI behavior.  Only the value on the top-level
+	// command is used.
+	Warnings io.Writer
+
+	// Terminator is the argument that ends option parsing.  All arguments
+	// after the terminator are positional.  If empty, "--" is used, so that
+	// Commands constructed directly, whose Terminator is the zero value, keep
+	// the conventional "--" handling.  Because an empty Terminator can't
+	// also mean "no terminator", set DisableTerminator to parse options
+	// through the end of the arguments instead.  Only the values on the
+	// top-level command are used.
+	Terminator        string
+	DisableTerminator bool
+
+	// SubcommandTerminator, if set, is an argument that ends subcommand
+	// matching, such as "++".  Remaining arguments are decoded as options or
+	// positional arguments of the most recently matched command, even if they
+	// match a subcommand name.  Unlike Terminator, options are still parsed.
+	// The SubcommandTerminator is only recognized while subcommands are being
+	// matched; afterwards, it's an ordinary positional argument.  If empty,
+	// subcommand matching ends at the first positional argument that isn't a
+	// subcommand.  Only the value on the top-level command is used.
+	SubcommandTerminator string
+
+	// UnknownCommandHandler, if set, is called when the first positional
+	// argument to a Command with subcommands doesn't match any of them.  This
+	// allows dispatching to external subcommands, as with git-style plugins.
+	// The handler receives the unrecognized name and the remaining arguments,
+	// starting with the name.  Parsing stops after the handler is called, and
+	// Decode returns the handler's error.
+	UnknownCommandHandler func(name string, args []string) error
+
+	// GlobalsBeforeSubcommand restricts options to the most recently matched
+	// command.  By default, options on ancestor commands may be specified
+	// after a subcommand, so "top mid -t 1" decodes top's -t option.  With
+	// GlobalsBeforeSubcommand set, ancestor options must precede the
+	// subcommand, and "top mid -t 1" returns an error.  Only the value on
+	// the top-level command is used.
+	GlobalsBeforeSubcommand bool
+
+	// PositionalTransform, if set, is applied to each positional argument
+	// before Decode returns, such as to expand "~" or environment variables
+	// the shell left unexpanded.  An error from PositionalTransform is
+	// returned by Decode.  Only the value on the top-level command is used.
+	PositionalTransform func(string) (string, error)
+
+	// WarnOnOptionLikeValues writes a warning to Warnings when an option
+	// consumes a separate argument as its value, and that argument names
+	// another option, as with "--name --verbose".  This usually means the
+	// user forgot the option's value.  The value is still decoded.  Only the
+	// value on the top-level command is used.
+	WarnOnOptionLikeValues bool
+
+	// TrackSources records where each option's value came from, such as a
+	// parsed argument or an environment variable.  Use ValueSource() to
+	// retrieve the source after decoding.  Only the value on the top-level
+	// command is used.
+	TrackSources bool
+
+	// MaxPositionalBytes, if positive, limits the combined length in bytes
+	// of the positional arguments returned by Decode, such as to stay within
+	// OS argument limits when forwarding them to another program.  Decode
+	// returns an error if the limit is exceeded.  Zero means unlimited.  Only
+	// the value on the top-level command is used.
+	MaxPositionalBytes int
+
+	// DisableShortClustering turns off the combining of short flags, so
+	// "-abc" is an error rather than being decoded as "-a -b -c".  Each short
+	// option must be specified separately.  Short options that take a value
+	// may still have the value attached, as in "-n5".  Only the value on the
+	// top-level command is used.
+	DisableShortClustering bool
+
+	// NormalizeName, if set, is applied to both option names and the names
+	// specified in arguments before matching them, such as to treat "_" and
+	// "-" as equivalent so that "--log_level" matches "--log-level".  Option
+	// names must remain unique after normalization.  If nil, names are
+	// matched exactly.  Command.Option() always matches exactly.  Only the
+	// value on the top-level command is used.
+	NormalizeName func(string) string
+
+	parent       *Command
+	envFields    []*Option
+	skippedNames []string // names of options left out by goos and goarch tags
+	pathName     string
+	specType     reflect.Type
+	frozen       *frozenCommand
+	configPath   string
+	configValues map[string]interface{}
+}
+
+// frozenCommand records the structure of a Command at the time it was frozen.
+type frozenCommand struct {
+	options     []*Option
+	subcommands []*Command
+}
+
+// Parent returns the command that the receiver is a subcommand of, or nil
+// for the top-level command.  Parents are recorded by New(), Clone(), and
+// AddHelpCommand().  Commands constructed directly have a nil Parent, even if
+// they're added to another command's Subcommands.
+func (c *Command) Parent() *Command {
+	return c.parent
+}
+
+// fullName returns the names of the command and its ancestors, as recorded by
+// New(), joined by spaces.  For commands built without New(), it returns Name.
+func (c *Command) fullName() string {
+	if c.pathName != "" {
+		return c.pathName
+	}
+	return c.Name
+}
+
+// Synopsis returns a one-line summary of the command's invocation, such as
+// "ln [OPTION]... OLD NEW".  The summary lists the command's ArgNames, or
+// "[ARG]..." if ArgNames is empty.  For commands built with New(), the names
+// of the parent commands are included.
+func (c *Command) Synopsis() string {
+	args := "[ARG]..."
+	if len(c.ArgNames) > 0 {
+		args = strings.Join(c.ArgNames, " ")
+	}
+	return fmt.Sprintf("%s [OPTION]... %s", c.fullName(), args)
 }
 
 // String returns the command's name.
@@ -122,6 +564,10 @@ func (c *Command) String() string {
 // associated subcommands, the subcommand names are matched and extracted
 // from the start of the positional arguments.
 //
+// Long-form options accept their argument either as the next argument or
+// attached with "=".  An attached empty argument, as in "--name=", is decoded
+// as an empty string, so whether it's valid depends on the Option's Decoder.
+//
 // To avoid ambiguity, subcommand matching terminates at the first unmatched
 // positional argument.  Similarly, option names are matched against the
 // command hierarchy as it exists at the point the option is encountered.  If
@@ -133,11 +579,185 @@ func (c *Command) String() string {
 //
 // As with GNU getopt_long, a bare "--" argument terminates argument parsing.
 // All arguments after the first "--" argument are considered positional
-// parameters.
+// parameters.  The terminator is configured with the Terminator and
+// DisableTerminator fields.  Similarly, the SubcommandTerminator field
+// configures an argument that ends subcommand matching, without ending
+// option parsing.
+//
+// An OptionDecoder may stop parsing early by returning ErrStopParsing, which
+// Decode returns along with the results parsed so far.
 func (c *Command) Decode(args []string) (path Path, positional []string, err error) {
+	err = c.prepareDecode()
+	if err != nil {
+		return
+	}
+	return parseArgs(c, args, make([]string, 0), newParseState())
+}
+
+// DecodeFull decodes a full argument list that includes the program name,
+// such as os.Args.  Unlike Decode(), which expects only the arguments that
+// follow the program name, DecodeFull skips args[0].  If the receiver's Name
+// is empty, it is set to the base name of args[0], as with "app" for
+// "/usr/bin/app".  Otherwise DecodeFull is equivalent to Decode(args[1:]).
+func (c *Command) DecodeFull(args []string) (path Path, positional []string, err error) {
+	if len(args) == 0 {
+		return c.Decode(args)
+	}
+	if c.Name == "" {
+		c.Name = filepath.Base(args[0])
+	}
+	return c.Decode(args[1:])
+}
+
+// DecodeInto is identical to Decode, except that positional arguments are
+// appended to the slice that positional points to, which is truncated first.
+// This allows callers that decode many argument lists to reuse a single
+// positional buffer.  As with Decode, the resulting slice is never nil.
+// DecodeInto panics if positional is nil.
+func (c *Command) DecodeInto(args []string, positional *[]string) (path Path, err error) {
+	if positional == nil {
+		panicCommand("DecodeInto() called with a nil positional pointer (command %s)", c.Name)
+	}
+	buf := (*positional)[:0]
+	if buf == nil {
+		buf = make([]string, 0)
+	}
+	err = c.prepareDecode()
+	if err != nil {
+		*positional = buf
+		return
+	}
+	path, *positional, err = parseArgs(c, args, buf, newParseState())
+	return
+}
+
+// Result summarizes a decoded command invocation, such as for logging or
+// telemetry.  See Command.DecodeResult().
+type Result struct {
+	Path       string         // The selected command path, as returned by Path.String()
+	Options    []OptionResult // The options of every command on the path, in order
+	Positional []string       // The positional arguments
+}
+
+// OptionResult summarizes a single option of a decoded command invocation.
+type OptionResult struct {
+	Name  string      // The option's CanonicalName()
+	Count int         // The number of times the option was specified
+	Raw   []string    // The specified values, in order; flags have empty values
+	Value interface{} // The decoded value, if the Decoder implements OptionValuer
+}
+
+// DecodeResult decodes args as with Decode(), and returns a Result that
+// consolidates the selected path, the options of each command on the path,
+// and the positional arguments.  Options that weren't specified are included
+// with a Count of 0, and their Value reflects any default.  If an
+// OptionDecoder returns ErrStopParsing, the Result for the arguments parsed
+// so far is returned along with ErrStopParsing.
+func (c *Command) DecodeResult(args []string) (*Result, error) {
+	err := c.prepareDecode()
+	if err != nil {
+		return nil, err
+	}
+	state := newParseState()
+	state.values = make(map[*Option][]string)
+	path, positional, err := parseArgs(c, args, make([]string, 0), state)
+	if err != nil && err != ErrStopParsing {
+		return nil, err
+	}
+	result := &Result{Path: path.String(), Positional: positional}
+	for _, cmd := range path {
+		for _, opt := range cmd.Options {
+			result.Options = append(result.Options, OptionResult{
+				Name:  opt.CanonicalName(),
+				Count: state.counts[opt],
+				Raw:   state.values[opt],
+				Value: decodedValue(opt.Decoder),
+			})
+		}
+	}
+	return result, err
+}
+
+// prepareDecode checks the receiver and applies default and config values
+// prior to decoding.
+func (c *Command) prepareDecode() error {
+	c.checkFrozen()
 	c.validate()
-	c.setDefaults()
-	return parseArgs(c, args)
+	err := c.setDefaults(c.StrictDefaults, c.Warnings, c.TrackSources)
+	if err != nil {
+		return err
+	}
+	if c.configValues != nil {
+		return applyConfig(c, c.configValues, c.configPath, c.TrackSources, c.NormalizeName)
+	}
+	return nil
+}
+
+// DecodeMap decodes pre-tokenized option values, such as HTTP query
+// parameters, using the receiver's options.  Each key is matched against the
+// receiver's option names, and each of its values is decoded in turn.  Flags
+// accept only empty values, or the words listed by their BoolWords.  Default
+// values are applied and parsed values are validated as with Decode(), but
+// subcommands aren't matched.  Keys are processed in sorted order.
+func (c *Command) DecodeMap(values map[string][]string) error {
+	err := c.prepareDecode()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	state := newParseState()
+	state.trackSources = c.TrackSources
+	for _, name := range keys {
+		arg := "--" + name
+		if len([]rune(name)) == 1 {
+			arg = "-" + name
+		}
+		opt := Path{c}.matchOption(name, c.NormalizeName)
+		if opt == nil {
+			return fmt.Errorf("option '%s' is not recognized", arg)
+		}
+		for _, value := range values[name] {
+			if opt.Flag && opt.BoolWords == nil && value != "" {
+				return fmt.Errorf("flag '%s' does not accept an argument", optionDisplayName(opt))
+			}
+			err = decodeOption(state, opt, value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return validateParsed(Path{c}, state.counts)
+}
+
+// ParseArgs parses args against cmd in the same manner as cmd.Decode(), but
+// doesn't apply default values.  Options are only decoded by their own
+// Decoders, so a Command whose options use in-memory decoders may be parsed
+// without side effects.  This makes ParseArgs suitable for fuzzing argument
+// tokenization and routing.
+//
+// Like Decode, ParseArgs panics if cmd is invalid.
+func ParseArgs(cmd *Command, args []string) (path Path, positional []string, err error) {
+	cmd.validate()
+	return parseArgs(cmd, args, make([]string, 0), newParseState())
+}
+
+// MustDecode is like Decode but panics if the arguments cannot be decoded.
+// The panic value is the error returned by Decode.  It simplifies quick
+// scripts and examples where a decoding error is fatal anyway.  Production
+// tools should prefer Decode, which allows reporting errors to users via
+// ExitHelp.
+func (c *Command) MustDecode(args []string) (path Path, positional []string) {
+	path, positional, err := c.Decode(args)
+	if err != nil {
+		panic(err)
+	}
+	return path, positional
 }
 
 // Subcommand locates subcommands on the method receiver.  It returns a match
@@ -171,6 +791,62 @@ func (c *Command) Option(name string) *Option {
 	return nil
 }
 
+// Flags returns the receiver's options that have the Flag field set, in the
+// order they appear in the Options field.  Subcommand options aren't
+// included.
+func (c *Command) Flags() []*Option {
+	var flags []*Option
+	for _, o := range c.Options {
+		if o.Flag {
+			flags = append(flags, o)
+		}
+	}
+	return flags
+}
+
+// ValueOptions returns the receiver's options that take arguments, i.e. those
+// without the Flag field set, in the order they appear in the Options field.
+// Subcommand options aren't included.
+func (c *Command) ValueOptions() []*Option {
+	var options []*Option
+	for _, o := range c.Options {
+		if !o.Flag {
+			options = append(options, o)
+		}
+	}
+	return options
+}
+
+// DecodedValues returns the current values of the receiver's options, keyed
+// by each option's CanonicalName().  Values are reported by decoders that
+// implement OptionValuer.  Options whose decoders don't implement
+// OptionValuer are omitted.  As with Option(), subcommand options aren't
+// included.
+func (c *Command) DecodedValues() map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, o := range c.Options {
+		valuer, ok := o.Decoder.(OptionValuer)
+		if ok {
+			values[o.CanonicalName()] = valuer.Value()
+		}
+	}
+	return values
+}
+
+// ValueSource returns the source of the current value of the receiver's
+// option with the given name: SourceArg, SourceEnv, SourceConfig, or
+// SourceDefault.  It returns an empty string if the value wasn't set by the
+// most recent decode, such as a pre-set field value, or if TrackSources isn't
+// set on the top-level command.  ValueSource panics if the receiver has no
+// option with the given name.
+func (c *Command) ValueSource(name string) string {
+	o := c.Option(name)
+	if o == nil {
+		panicCommand("Option not found: %s", name)
+	}
+	return o.source
+}
+
 // GroupOptions is used to build OptionGroups for help output.  It searches the
 // method receiver for the named options and returns a corresponding OptionGroup.
 // If any of the named options are not found, GroupOptions panics.
@@ -201,41 +877,433 @@ func (c *Command) GroupCommands(names ...string) CommandGroup {
 	return group
 }
 
+// Clone returns a deep copy of the command tree rooted at the method receiver.
+// The copy's Options, Subcommands, and Help are distinct from the receiver's,
+// so the copy may be modified without affecting the receiver.
+//
+// If spec is non-nil, the receiver must have been built by New() with a spec
+// of the same type.  The copy's options decode into spec rather than the
+// receiver's spec, allowing the receiver and copy to Decode() concurrently.
+// Options added to the receiver after New() returned keep their original
+// decoders.  If spec is nil, the copy shares the receiver's decoders.  The
+// copy is the root of its own tree, so its Parent() is nil.
+func (c *Command) Clone(spec interface{}) *Command {
+	var rebuilt *Command
+	if spec != nil {
+		if c.specType == nil {
+			panicCommand("Clone() with a spec requires a command built with New() (command %s)", c.Name)
+		}
+		if reflect.TypeOf(spec) != c.specType {
+			panicCommand("Clone() spec must be of type %s, not %s (command %s)", c.specType, reflect.TypeOf(spec), c.Name)
+		}
+		rebuilt = parseCommandSpec(c.Name, spec, nil)
+	}
+	dup := c.clone(rebuilt)
+	dup.parent = nil
+	return dup
+}
+
+// Freeze marks the receiver and its subcommands as frozen.  Frozen commands
+// are intended to be configured once and reused, such as in long-lived server
+// processes.  AddHelpCommand() panics on a frozen command, and Decode() panics
+// if options or subcommands were added, removed, or replaced after Freeze()
+// was called.  Decode() doesn't modify the structure of a command, but it does
+// update the values of the command's spec.  Use Clone() to decode
+// concurrently, or to obtain an unfrozen copy for further configuration.
+//
+// Freeze panics if the command is invalid.
+func (c *Command) Freeze() {
+	c.validate()
+	c.frozen = &frozenCommand{
+		options:     append([]*Option(nil), c.Options...),
+		subcommands: append([]*Command(nil), c.Subcommands...),
+	}
+	for _, sub := range c.Subcommands {
+		sub.Freeze()
+	}
+}
+
+// Frozen reports whether Freeze() was called on the receiver.
+func (c *Command) Frozen() bool {
+	return c.frozen != nil
+}
+
+// checkFrozen panics if the structure of a frozen command was modified.
+func (c *Command) checkFrozen() {
+	if c.frozen == nil {
+		return
+	}
+	if !sameOptions(c.Options, c.frozen.options) {
+		panicCommand("options of a frozen command were modified (command %s)", c.Name)
+	}
+	if !sameCommands(c.Subcommands, c.frozen.subcommands) {
+		panicCommand("subcommands of a frozen command were modified (command %s)", c.Name)
+	}
+	for _, sub := range c.Subcommands {
+		sub.checkFrozen()
+	}
+}
+
+func sameOptions(a []*Option, b []*Option) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameCommands(a []*Command, b []*Command) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// clone copies c, taking decoders from the corresponding options of rebuilt
+// when rebuilt is non-nil.
+func (c *Command) clone(rebuilt *Command) *Command {
+	dup := *c
+	dup.frozen = nil
+	if rebuilt != nil {
+		dup.envFields = rebuilt.envFields
+	}
+	dup.Aliases = append([]string(nil), c.Aliases...)
+	dup.ArgNames = append([]string(nil), c.ArgNames...)
+
+	options := make(map[*Option]*Option)
+	dup.Options = nil
+	for i, o := range c.Options {
+		opt := *o
+		opt.Names = append([]string(nil), o.Names...)
+		if rebuilt != nil && i < len(rebuilt.Options) && reflect.DeepEqual(o.Names, rebuilt.Options[i].Names) {
+			opt.Decoder = rebuilt.Options[i].Decoder
+		}
+		options[o] = &opt
+		dup.Options = append(dup.Options, &opt)
+	}
+
+	commands := make(map[*Command]*Command)
+	dup.Subcommands = nil
+	for i, sub := range c.Subcommands {
+		var rebuiltSub *Command
+		if rebuilt != nil && i < len(rebuilt.Subcommands) && rebuilt.Subcommands[i].Name == sub.Name {
+			rebuiltSub = rebuilt.Subcommands[i]
+		}
+		commands[sub] = sub.clone(rebuiltSub)
+		commands[sub].parent = &dup
+		dup.Subcommands = append(dup.Subcommands, commands[sub])
+	}
+
+	dup.Help.OptionGroups = nil
+	for _, group := range c.Help.OptionGroups {
+		g := group
+		g.Options = nil
+		for _, o := range group.Options {
+			if options[o] != nil {
+				o = options[o]
+			}
+			g.Options = append(g.Options, o)
+		}
+		dup.Help.OptionGroups = append(dup.Help.OptionGroups, g)
+	}
+	dup.Help.CommandGroups = nil
+	for _, group := range c.Help.CommandGroups {
+		g := group
+		g.Commands = nil
+		for _, sub := range group.Commands {
+			if commands[sub] != nil {
+				sub = commands[sub]
+			}
+			g.Commands = append(g.Commands, sub)
+		}
+		dup.Help.CommandGroups = append(dup.Help.CommandGroups, g)
+	}
+	dup.Help.Examples = append([]Example(nil), c.Help.Examples...)
+	if c.Help.ArgDescriptions != nil {
+		dup.Help.ArgDescriptions = make(map[string]string)
+		for k, v := range c.Help.ArgDescriptions {
+			dup.Help.ArgDescriptions[k] = v
+		}
+	}
+	return &dup
+}
+
 // WriteHelp renders help output to the given io.Writer.  Output is influenced
-// by the Command's Help field.  See the Help type for details.
+// by the Command's Help field.  See the Help type for details.  If
+// Help.Template is nil, the template of the nearest ancestor recorded by
+// Parent() that has one is used, so a template set on the top-level command
+// applies to subcommands built by New().  ExitHelp() and HelpString() render
+// output with WriteHelp, so they use the same template.
 func (c *Command) WriteHelp(w io.Writer) error {
-	var tmpl *template.Template
-	if c.Help.Template != nil {
-		tmpl = c.Help.Template
-	} else {
+	tmpl := c.Help.Template
+	for p := c.parent; tmpl == nil && p != nil; p = p.parent {
+		tmpl = p.Help.Template
+	}
+	if tmpl == nil {
 		tmpl = defaultTemplate
 	}
-
-	buf := bytes.NewBuffer(nil)
-	err := tmpl.Execute(buf, c)
-	if err != nil {
-		panicCommand("failed to render help: %s", err)
+	if c.Help.HideEnv {
+		clone, err := tmpl.Clone()
+		if err != nil {
+			panicCommand("failed to render help: %s", err)
+		}
+		tmpl = clone.Funcs(hideEnvFuncs)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err := tmpl.Execute(buf, c)
+	if err != nil {
+		panicCommand("failed to render help: %s", err)
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// HelpString returns the help output that WriteHelp() would render.  Like
+// WriteHelp, it panics if the help template fails to execute.
+func (c *Command) HelpString() string {
+	buf := bytes.NewBuffer(nil)
+	c.WriteHelp(buf)
+	return buf.String()
+}
+
+// WriteHelpFor renders help output for the subcommand named by path to the
+// given io.Writer.  Each element of path names a subcommand (or alias) of the
+// previous command, starting with the method receiver.  The target command's
+// Help field is used to render output.  If the target's Help.Template is nil,
+// the template of its nearest ancestor along path that has one is used, so a
+// template set on the receiver applies to all of its subcommands.  If path
+// doesn't resolve to a command, WriteHelpFor returns an error and writes
+// nothing.
+func (c *Command) WriteHelpFor(w io.Writer, path ...string) error {
+	resolved := Path{c}
+	for _, name := range path {
+		sub := resolved.Last().Subcommand(name)
+		if sub == nil {
+			return fmt.Errorf("command '%s' is not recognized", name)
+		}
+		resolved = append(resolved, sub)
+	}
+	target := *resolved.Last()
+	target.Help.Template = pathTemplate(resolved)
+	return target.WriteHelp(w)
+}
+
+// pathTemplate returns the Help.Template of the last command of path that
+// has one, or nil if none do.
+func pathTemplate(path Path) *template.Template {
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i].Help.Template != nil {
+			return path[i].Help.Template
+		}
+	}
+	return nil
+}
+
+// SetTemplateRecursive sets the Help.Template field of the receiver and all
+// of its subcommands, recursively, such as to apply a custom template to all
+// help output.  Subcommands added afterwards aren't affected.
+func (c *Command) SetTemplateRecursive(tmpl *template.Template) {
+	c.Help.Template = tmpl
+	for _, sub := range c.Subcommands {
+		sub.SetTemplateRecursive(tmpl)
+	}
+}
+
+// WriteCommandTree writes the receiver's subcommands to the given
+// io.Writer, recursively, as an overview of deep command hierarchies.  Each
+// subcommand is listed with its description as with the default help
+// template, indented by its depth below the receiver.  Hidden commands,
+// which have no description, are skipped along with their subcommands.
+func (c *Command) WriteCommandTree(w io.Writer) error {
+	buf := bytes.NewBuffer(nil)
+	writeCommandTree(buf, c, 0)
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func writeCommandTree(buf *bytes.Buffer, c *Command, depth int) {
+	for _, sub := range c.Subcommands {
+		if sub.Description == "" {
+			continue
+		}
+		buf.WriteString(formatCommandIndented(sub, depth))
+		buf.WriteString("\n")
+		writeCommandTree(buf, sub, depth+1)
+	}
+}
+
+// WriteMarkdown renders the command's help as Markdown to the given
+// io.Writer, such as for documentation websites.  The output includes a
+// heading with the command's full name, its description and long
+// description, a usage code block, a table of options, and a list of
+// subcommands.  Subcommands are rendered after the command, with headings
+// one level deeper, up to depth levels below the receiver.  A depth of 0
+// renders only the receiver, and a negative depth renders the entire tree.
+// Subcommands that are rendered are linked from the subcommand list.
+//
+// As with help output, options and subcommands without descriptions are
+// hidden.  Characters in names and descriptions that have special meaning
+// in Markdown are escaped.  Options are rendered from the Options field,
+// rather than Help.OptionGroups, so that the output doesn't depend on the
+// help template.
+func (c *Command) WriteMarkdown(w io.Writer, depth int) error {
+	buf := bytes.NewBuffer(nil)
+	writeMarkdown(buf, c, 1, depth)
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func writeMarkdown(buf *bytes.Buffer, c *Command, level int, depth int) {
+	if level > 1 {
+		buf.WriteString("\n")
+	}
+	buf.WriteString(formatMarkdownCommand(c, level, depth != 0))
+	if depth == 0 {
+		return
+	}
+	for _, sub := range c.Subcommands {
+		if sub.Description != "" {
+			writeMarkdown(buf, sub, level+1, depth-1)
+		}
+	}
+}
+
+// WriteHelpForPath renders help output for the last command of path, such as
+// the Path returned by Decode(), to the given io.Writer.  The command's own
+// help is rendered as with WriteHelp, followed by a "Global Options:" group
+// named "global" listing the options inherited from the other commands of
+// path.  Inherited options without descriptions are hidden, as are options
+// whose names are all shadowed by nearer commands.  As with WriteHelpFor, a
+// nil Help.Template is inherited from the nearest command of path that has
+// one.  The command's Help field is not modified.
+//
+// WriteHelpForPath panics if path is empty.
+func (c *Command) WriteHelpForPath(w io.Writer, path Path) error {
+	if len(path) == 0 {
+		panicCommand("WriteHelpForPath() called with an empty path (command %s)", c.Name)
+	}
+	target := *path.Last()
+	target.Help.Template = pathTemplate(path)
+	var globals []*Option
+	for _, cmd := range path[:len(path)-1] {
+		for _, opt := range cmd.Options {
+			if opt.Description != "" && !shadowedOption(path, opt) {
+				globals = append(globals, opt)
+			}
+		}
+	}
+	if len(globals) > 0 {
+		groups := make([]OptionGroup, len(target.Help.OptionGroups), len(target.Help.OptionGroups)+1)
+		copy(groups, target.Help.OptionGroups)
+		target.Help.OptionGroups = append(groups, OptionGroup{Name: "global", Header: "Global Options:", Options: globals})
+	}
+	return target.WriteHelp(w)
+}
+
+// shadowedOption reports whether none of opt's names resolve to opt on path.
+func shadowedOption(path Path, opt *Option) bool {
+	for _, name := range opt.Names {
+		if path.findOption(name) == opt {
+			return false
+		}
+	}
+	return true
+}
+
+// AddHelpCommand adds a "help" subcommand to the method receiver and returns
+// the new subcommand.  If description is non-empty, the help command is added
+// to the receiver's last CommandGroup for help output, creating an "Available
+// Commands:" group if none exist.  Otherwise the help command is hidden.
+//
+// When Decode() selects the help command, the positional arguments name the
+// subcommand to display help for.  Applications render the help by passing the
+// positional arguments to the receiver's WriteHelpFor() method:
+//
+//	helpCmd := cmd.AddHelpCommand("Display help for a command")
+//	path, positional, err := cmd.Decode(os.Args[1:])
+//	if err == nil && path.Last() == helpCmd {
+//		err = cmd.WriteHelpFor(os.Stdout, positional...)
+//	}
+//
+// With no positional arguments, the receiver's own help is rendered.  If the
+// receiver already has a subcommand named "help", or if the receiver is
+// frozen, AddHelpCommand panics.
+func (c *Command) AddHelpCommand(description string) *Command {
+	if c.frozen != nil {
+		panicCommand("AddHelpCommand() called on a frozen command (command %s)", c.Name)
+	}
+	if c.Subcommand("help") != nil {
+		panicCommand("command names must be unique (help is specified multiple times)")
 	}
-	_, err = buf.WriteTo(w)
-	return err
+	help := &Command{Name: "help", Description: description, parent: c}
+	help.Help.Usage = fmt.Sprintf("Usage: %s help [COMMAND]...", c.Name)
+	c.Subcommands = append(c.Subcommands, help)
+	if description != "" {
+		if len(c.Help.CommandGroups) == 0 {
+			c.Help.CommandGroups = []CommandGroup{{Header: "Available Commands:"}}
+		}
+		last := &c.Help.CommandGroups[len(c.Help.CommandGroups)-1]
+		last.Commands = append(last.Commands, help)
+	}
+	return help
 }
 
 // ExitHelp writes help output and terminates the program.  If err is nil,
 // the output is written to os.Stdout and the program terminates with a 0 exit
 // code.  Otherwise, both the help output and error message are written to
-// os.Stderr and the program terminates with a 1 exit code.
+// os.Stderr and the program terminates with a 1 exit code.  The error message
+// is formatted with the Command's Help.ErrorFormat.  If Help.ErrorToStdout is
+// set, errors are written to os.Stdout instead.  Help output is rendered as
+// with WriteHelp(), including its template inheritance.
 func (c *Command) ExitHelp(err error) {
+	os.Exit(c.writeExitHelp(err, os.Stdout, os.Stderr))
+}
+
+// writeExitHelp writes the output for ExitHelp and returns the exit code.
+func (c *Command) writeExitHelp(err error, stdout io.Writer, stderr io.Writer) int {
 	if err == nil {
-		c.WriteHelp(os.Stdout)
-		os.Exit(0)
+		c.WriteHelp(stdout)
+		return 0
+	}
+	if c.Help.ErrorToStdout {
+		stderr = stdout
+	}
+	c.WriteHelp(stderr)
+	c.WriteError(stderr, err)
+	return 1
+}
+
+// WriteError writes err to the given io.Writer, formatted with the Command's
+// Help.ErrorFormat.  If Help.ErrorFormat is empty, "\nError: %s\n" is used.
+func (c *Command) WriteError(w io.Writer, err error) error {
+	format := c.Help.ErrorFormat
+	if format == "" {
+		format = defaultErrorFormat
 	}
-	c.WriteHelp(os.Stderr)
-	fmt.Fprintf(os.Stderr, "\nError: %s\n", err)
-	os.Exit(1)
+	_, werr := fmt.Fprintf(w, format, err)
+	return werr
 }
 
 // validate command spec
 func (c *Command) validate() {
+	c.validateCommand()
+	c.validateRelations(c.ancestors())
+}
+
+// validateCommand checks the receiver and its subcommands, excluding option
+// relations.  Relations may name options of ancestor commands, so they're
+// checked by validateRelations once the whole tree is built.
+func (c *Command) validateCommand() {
 	if c.Name == "" {
 		panicCommand("Command name cannot be empty")
 	}
@@ -249,6 +1317,26 @@ func (c *Command) validate() {
 		}
 	}
 
+	terminator := c.Terminator
+	if terminator == "" {
+		terminator = "--"
+	}
+	if c.SubcommandTerminator != "" && !c.DisableTerminator && c.SubcommandTerminator == terminator {
+		panicCommand("SubcommandTerminator cannot match the Terminator (command %s)", c.Name)
+	}
+	if c.MaxPositionalBytes < 0 {
+		panicCommand("MaxPositionalBytes cannot be negative (command %s)", c.Name)
+	}
+
+	for _, a := range c.ArgNames {
+		if a == "" {
+			panicCommand("Argument names cannot be blank (command %s)", c.Name)
+		}
+		if strings.HasPrefix(a, "-") {
+			panicCommand("Argument names cannot begin with '-' (command %s, argument %s)", c.Name, a)
+		}
+	}
+
 	for _, a := range c.Aliases {
 		if strings.HasPrefix(a, "-") {
 			panicCommand("Command aliases cannot begin with '-' (command %s, alias %s)", c.Name, a)
@@ -263,7 +1351,7 @@ func (c *Command) validate() {
 
 	seen := make(map[string]bool)
 	for _, sub := range c.Subcommands {
-		sub.validate()
+		sub.validateCommand()
 		subnames := append(sub.Aliases, sub.Name)
 		for _, name := range subnames {
 			_, present := seen[name]
@@ -285,32 +1373,142 @@ func (c *Command) validate() {
 			seen[name] = true
 		}
 	}
+
+	if c.NormalizeName != nil {
+		c.validateNormalized(c.NormalizeName)
+	}
 }
 
-func (c *Command) setDefaults() {
+// validateRelations checks that the Requires and Conflicts names of the
+// receiver's options, and those of its subcommands, refer to options of the
+// receiver or of the commands on path.  Names of options left out by goos
+// and goarch tags are permitted, so that specs are valid on every platform.
+func (c *Command) validateRelations(path Path) {
+	path = append(path[:len(path):len(path)], c)
 	for _, opt := range c.Options {
-		defaulter, ok := opt.Decoder.(OptionDefaulter)
-		if ok {
-			defaulter.SetDefault()
+		for _, name := range opt.Requires {
+			if path.findOption(name) == nil && !path.skippedOption(name) {
+				panicOption("option %s requires unknown option %s", optionDisplayName(opt), name)
+			}
+		}
+		for _, name := range opt.Conflicts {
+			if path.findOption(name) == nil && !path.skippedOption(name) {
+				panicOption("option %s conflicts with unknown option %s", optionDisplayName(opt), name)
+			}
+		}
+	}
+	for _, sub := range c.Subcommands {
+		sub.validateRelations(path)
+	}
+}
+
+// ancestors returns the commands above the receiver, as recorded by Parent(),
+// ordered from the top-level command down.
+func (c *Command) ancestors() Path {
+	var path Path
+	for p := c.parent; p != nil; p = p.parent {
+		path = append(Path{p}, path...)
+	}
+	return path
+}
+
+// validateNormalized checks that the option names of the receiver and its
+// subcommands remain unique after normalization.  Names of the same option
+// may normalize to the same value.
+func (c *Command) validateNormalized(normalize func(string) string) {
+	seen := make(map[string]*Option)
+	for _, o := range c.Options {
+		for _, name := range o.Names {
+			normalized := normalize(name)
+			other, present := seen[normalized]
+			if present && other != o {
+				panicCommand("option names must be unique after normalization (%s is specified multiple times)", normalized)
+			}
+			seen[normalized] = o
+		}
+	}
+	for _, sub := range c.Subcommands {
+		sub.validateNormalized(normalize)
+	}
+}
+
+func (c *Command) setDefaults(strict bool, warnings io.Writer, track bool) error {
+	for _, opt := range c.Options {
+		source, err := setDefault(opt.Decoder, strict, warnings)
+		if err != nil {
+			return fmt.Errorf("option %s: %s", opt, err)
+		}
+		opt.source = ""
+		if track {
+			opt.source = source
+		}
+	}
+	for _, opt := range c.envFields {
+		_, err := setDefault(opt.Decoder, strict, warnings)
+		if err != nil {
+			return fmt.Errorf("environment variable %s: %s", opt.Env, err)
 		}
 	}
 	for _, sub := range c.Subcommands {
-		sub.setDefaults()
+		err := sub.setDefaults(strict, warnings, track)
+		if err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// warnf writes a non-fatal diagnostic to w.  If w is nil, the warning is
+// discarded.
+func warnf(w io.Writer, format string, values ...interface{}) {
+	if w == nil {
+		return
+	}
+	fmt.Fprintf(w, "Warning: "+format+"\n", values...)
 }
 
 /*
  * Argument parsing
  */
 
-func parseArgs(c *Command, args []string) (path Path, positional []string, err error) {
+// parseArgs parses args against c, recording decoded options in state.
+// Positional arguments are appended to buf, which must not be nil.  If a help
+// flag added by WithAutoHelp() was decoded, ErrHelpRequested is returned in
+// place of any other error.
+func parseArgs(c *Command, args []string, buf []string, state *parseState) (path Path, positional []string, err error) {
 	path = Path{c}
-	positional = make([]string, 0) // positional args should never be nil
+	positional = buf
+	state.trackSources = c.TrackSources
+	state.disableClustering = c.DisableShortClustering
+	if c.WarnOnOptionLikeValues {
+		state.warnings = c.Warnings
+	}
+	defer func() {
+		for opt := range state.counts {
+			if opt.autoHelp {
+				err = ErrHelpRequested
+				return
+			}
+		}
+	}()
+
+	terminator := c.Terminator
+	if terminator == "" {
+		terminator = "--"
+	}
 
-	seen := make(map[*Option]bool)
 	parseCmd, parseOpt := true, true
 	for i := 0; i < len(args); i++ {
 		a := args[i]
+		if parseOpt && !c.DisableTerminator && a == terminator {
+			parseOpt = false
+			parseCmd = false
+			continue
+		}
+		if parseCmd && c.SubcommandTerminator != "" && a == c.SubcommandTerminator {
+			parseCmd = false
+			continue
+		}
 		if parseCmd {
 			subcmd := path.Last().Subcommand(a)
 			if subcmd != nil {
@@ -325,115 +1523,375 @@ func parseArgs(c *Command, args []string) (path Path, positional []string, err e
 				parseCmd = false
 				continue
 			}
-			if a == "--" {
-				parseOpt = false
-				parseCmd = false
-				continue
-			}
 
-			var opt *Option
-			opt, args, err = processOption(path, args, i)
-			if err != nil {
+			scope := path
+			if c.GlobalsBeforeSubcommand {
+				scope = path[len(path)-1:]
+			}
+			var consumed int
+			consumed, err = processOption(scope, a, args[i+1:], state, c.NormalizeName)
+			if err == ErrStopParsing {
 				return
 			}
-			_, present := seen[opt]
-			if present && !opt.Plural {
-				err = fmt.Errorf("option %q specified too many times", args[i])
+			if err != nil {
+				err = &DecodeError{Command: path.Last(), Err: err}
 				return
 			}
-			seen[opt] = true
+			i += consumed
 			continue
 		}
 
 		// Unmatched positional arg
+		last := path.Last()
+		if parseCmd && len(last.Subcommands) > 0 && last.UnknownCommandHandler != nil {
+			err = last.UnknownCommandHandler(a, args[i:])
+			return
+		}
 		parseCmd = false
 		positional = append(positional, a)
 	}
+	err = validateParsed(path, state.counts)
+	if err != nil {
+		return
+	}
+	if c.PositionalTransform != nil {
+		for i, a := range positional {
+			positional[i], err = c.PositionalTransform(a)
+			if err != nil {
+				return
+			}
+		}
+	}
+	if c.MaxPositionalBytes > 0 {
+		err = checkPositionalBytes(positional, c.MaxPositionalBytes)
+	}
 	return
 }
 
-func processOption(path Path, args []string, optidx int) (opt *Option, newargs []string, err error) {
-	if strings.HasPrefix(args[optidx], "--") {
-		return processLongOption(path, args, optidx)
+// checkMissing returns an error listing the required options on path that
+// weren't specified, if there are two or more.  Options are required if
+// their MinValues is 1 or more.  A single missing option is reported by
+// validateParsed with the option's own MinValues message.
+func checkMissing(path Path, counts map[*Option]int) error {
+	var missing []string
+	for _, cmd := range path {
+		for _, opt := range cmd.Options {
+			if opt.MinValues > 0 && counts[opt] == 0 {
+				missing = append(missing, optionDisplayName(opt))
+			}
+		}
+	}
+	if len(missing) < 2 {
+		return nil
+	}
+	return fmt.Errorf("missing required options: %s", strings.Join(missing, ", "))
+}
+
+// checkPositionalBytes returns an error if the combined length of positional
+// exceeds limit bytes.
+func checkPositionalBytes(positional []string, limit int) error {
+	total := 0
+	for _, a := range positional {
+		total += len(a)
+	}
+	if total > limit {
+		return fmt.Errorf("positional arguments total %d bytes, exceeding the limit of %d bytes", total, limit)
+	}
+	return nil
+}
+
+// validateParsed checks constraints that can only be evaluated once all
+// arguments are parsed, such as value bounds and option relations.  Only
+// options on the selected path are checked, and counts only reflect
+// user-provided arguments.
+func validateParsed(path Path, counts map[*Option]int) error {
+	err := checkMissing(path, counts)
+	if err != nil {
+		return err
+	}
+	for _, cmd := range path {
+		for _, opt := range cmd.Options {
+			n := counts[opt]
+			if n < opt.MinValues {
+				if opt.Flag {
+					return fmt.Errorf("flag '%s' must be specified at least %d %s", optionDisplayName(opt), opt.MinValues, pluralize("time", opt.MinValues))
+				}
+				return fmt.Errorf("option '%s' requires at least %d %s", optionDisplayName(opt), opt.MinValues, pluralize("value", opt.MinValues))
+			}
+			if opt.MaxValues > 0 && n > opt.MaxValues {
+				if opt.Flag {
+					return fmt.Errorf("flag '%s' may be specified at most %d %s", optionDisplayName(opt), opt.MaxValues, pluralize("time", opt.MaxValues))
+				}
+				return fmt.Errorf("option '%s' accepts at most %d %s", optionDisplayName(opt), opt.MaxValues, pluralize("value", opt.MaxValues))
+			}
+			if n == 0 {
+				continue
+			}
+			for _, name := range opt.Requires {
+				other := findRelatedOption(path, opt, name)
+				if other != nil && counts[other] == 0 {
+					return fmt.Errorf("option '%s' requires option '%s'", optionDisplayName(opt), optionDisplayName(other))
+				}
+			}
+			for _, name := range opt.Conflicts {
+				other := findRelatedOption(path, opt, name)
+				if other != nil && counts[other] > 0 {
+					return fmt.Errorf("option '%s' conflicts with option '%s'", optionDisplayName(opt), optionDisplayName(other))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// findRelatedOption locates an option named by opt's Requires or Conflicts
+// field.  It returns nil if the option was left out by goos or goarch tags,
+// in which case the relation is ignored.  The names are checked by
+// validate(), so it only panics if the command was modified after
+// validation.
+func findRelatedOption(path Path, opt *Option, name string) *Option {
+	other := path.findOption(name)
+	if other == nil && !path.skippedOption(name) {
+		panicOption("option %s references unknown option %s", optionDisplayName(opt), name)
+	}
+	return other
+}
+
+// optionDisplayName returns the canonical name of o with its "-" or "--"
+// prefix.
+func optionDisplayName(o *Option) string {
+	name := o.CanonicalName()
+	if len([]rune(name)) == 1 {
+		return "-" + name
+	}
+	return "--" + name
+}
+
+func pluralize(word string, n int) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
+
+// parseState records the options decoded while parsing arguments.  The
+// counts and values only reflect user-provided arguments, not defaults.
+// Values are only recorded if the values map is non-nil.
+type parseState struct {
+	counts map[*Option]int
+	values map[*Option][]string
+
+	// trackSources records SourceArg as the source of decoded options.
+	trackSources bool
+
+	// warnings receives warnings for option-like values.  It is nil unless
+	// Command.WarnOnOptionLikeValues is set.
+	warnings io.Writer
+
+	// disableClustering rejects short option clusters, as set by
+	// Command.DisableShortClustering.
+	disableClustering bool
+
+	// stdinReads records the option that read each input file, such as
+	// os.Stdin.  Each input file may only be read once.
+	stdinReads map[*os.File]*Option
+}
+
+func newParseState() *parseState {
+	return &parseState{counts: make(map[*Option]int), stdinReads: make(map[*os.File]*Option)}
+}
+
+// processOption decodes the option or options specified by arg, recording each
+// in state.  The next parameter holds the args that follow arg, and consumed
+// is the number of them that were used as option values.  Option names are
+// matched with normalize, if non-nil.
+func processOption(path Path, arg string, next []string, state *parseState, normalize func(string) string) (consumed int, err error) {
+	if strings.HasPrefix(arg, "--") {
+		return processLongOption(path, arg, next, state, normalize)
 	}
-	return processShortOption(path, args, optidx)
+	return processShortOption(path, arg, next, state, normalize)
 }
 
-func processLongOption(path Path, args []string, optidx int) (opt *Option, newargs []string, err error) {
-	keyval := strings.SplitN(strings.TrimPrefix(args[optidx], "--"), "=", 2)
+// decodeOption decodes value with opt's Decoder and records the occurrence
+// in state.  Repeated occurrences of non-Plural options are handled according
+// to opt.OnRepeat.
+func decodeOption(state *parseState, opt *Option, value string) error {
+	decode := true
+	if state.counts[opt] > 0 && !opt.Plural {
+		switch opt.OnRepeat {
+		case RepeatKeepFirst:
+			decode = false
+		case RepeatKeepLast:
+		default:
+			return fmt.Errorf("option %q specified too many times", optionDisplayName(opt))
+		}
+	}
+	var err error
+	if decode {
+		in := stdinInput(opt.Decoder, value)
+		if in != nil {
+			other := state.stdinReads[in]
+			if other == opt {
+				return fmt.Errorf("option '%s' may only read standard input once", optionDisplayName(opt))
+			}
+			if other != nil {
+				return fmt.Errorf("option '%s' cannot read standard input, which was already read by option '%s'", optionDisplayName(opt), optionDisplayName(other))
+			}
+			state.stdinReads[in] = opt
+		}
+		err = decodeValue(opt, value)
+		if err != nil && err != ErrStopParsing {
+			return err
+		}
+	}
+	state.counts[opt]++
+	if state.trackSources {
+		opt.source = SourceArg
+	}
+	if state.values != nil {
+		state.values[opt] = append(state.values[opt], value)
+	}
+	return err
+}
+
+// decodeValue decodes value with opt's Decoder.  Values for flags with
+// BoolWords set are parsed as true or false words, and an empty value means
+// true.
+func decodeValue(opt *Option, value string) error {
+	if opt.BoolWords == nil || value == "" {
+		return opt.Decoder.Decode(value)
+	}
+	truth, err := opt.BoolWords.parse(value)
+	if err != nil {
+		return fmt.Errorf("flag '%s' %s", optionDisplayName(opt), err)
+	}
+	*opt.Decoder.(flagDecoder).value = truth
+	return nil
+}
+
+func processLongOption(path Path, arg string, next []string, state *parseState, normalize func(string) string) (consumed int, err error) {
+	keyval := strings.SplitN(strings.TrimPrefix(arg, "--"), "=", 2)
 	name := keyval[0]
-	newargs = args
 
-	opt = path.findOption(name)
+	opt := path.matchOption(name, normalize)
 	if opt == nil {
 		err = fmt.Errorf("option '--%s' is not recognized", name)
 		return
 	}
+	var value string
 	if opt.Flag {
 		if len(keyval) == 2 {
-			err = fmt.Errorf("flag '--%s' does not accept an argument", name)
-		} else {
-			err = opt.Decoder.Decode("")
+			if opt.BoolWords == nil {
+				err = fmt.Errorf("flag '%s' does not accept an argument", optionDisplayName(opt))
+				return
+			}
+			value = keyval[1]
 		}
 	} else {
 		if len(keyval) == 2 {
-			err = opt.Decoder.Decode(keyval[1])
-		} else {
-			if len(args[optidx:]) < 2 {
-				err = fmt.Errorf("option '--%s' requires an argument", name)
-			} else {
-				// Consume the next arg
-				err = opt.Decoder.Decode(args[optidx+1])
-				newargs = duplicateArgs(args)
-				newargs = append(newargs[:optidx+1], newargs[optidx+2:]...)
+			value = keyval[1]
+		} else if !opt.OptionalArg {
+			if len(next) == 0 {
+				err = fmt.Errorf("option '%s' requires an argument", optionDisplayName(opt))
+				return
 			}
+			// Consume the next arg
+			value = next[0]
+			consumed = 1
+			warnOptionLikeValue(path, opt, value, state, normalize)
 		}
 	}
+	err = decodeOption(state, opt, value)
 	return
 }
 
-func processShortOption(path Path, args []string, optidx int) (opt *Option, newargs []string, err error) {
-	keyval := strings.SplitN(strings.TrimPrefix(args[optidx], "-"), "", 2)
-	name := keyval[0]
-	newargs = args
-
-	opt = path.findOption(name)
-	if opt == nil {
-		err = fmt.Errorf("option '-%s' is not recognized", name)
+// warnOptionLikeValue writes a warning to state.warnings if value, which opt
+// consumed from a separate argument, names an option on path.
+func warnOptionLikeValue(path Path, opt *Option, value string, state *parseState, normalize func(string) string) {
+	if state.warnings == nil || len(value) < 2 || value[0] != '-' {
 		return
 	}
-	if opt.Flag {
-		err = opt.Decoder.Decode("")
-		if len(keyval) == 2 {
-			// Short-form options are aggregated.  TODO: Cleanup
-			// Rewrite current arg as -<name> and append remaining aggregate opts as a new arg after the current one
-			newargs = duplicateArgs(args)
-			newargs = append(newargs[:optidx+1], append([]string{"-" + keyval[1]}, newargs[optidx+1:]...)...)
-			newargs[optidx] = "-" + name
-		}
+	var name string
+	if strings.HasPrefix(value, "--") {
+		name = strings.SplitN(value[2:], "=", 2)[0]
 	} else {
-		if len(keyval) == 2 {
-			err = opt.Decoder.Decode(keyval[1])
-		} else {
-			if len(args[optidx:]) < 2 {
-				err = fmt.Errorf("option '-%s' requires an argument", name)
-			} else {
-				// Consume the next arg
-				err = opt.Decoder.Decode(args[optidx+1])
-				newargs = duplicateArgs(args)
-				newargs = append(newargs[:optidx+1], newargs[optidx+2:]...)
+		_, size := utf8.DecodeRuneInString(value[1:])
+		name = value[1 : 1+size]
+	}
+	if path.matchOption(name, normalize) != nil {
+		warnf(state.warnings, "option '%s' consumed %q as its value; did you forget to specify a value?", optionDisplayName(opt), value)
+	}
+}
+
+// processShortOption decodes a cluster of short options, such as "-vvv" or
+// "-vfFILE".  Flags are decoded in turn until an option that takes a value
+// is found.  The value is the remainder of the cluster, if any, or else the
+// next arg.
+func processShortOption(path Path, arg string, next []string, state *parseState, normalize func(string) string) (consumed int, err error) {
+	cluster := strings.TrimPrefix(arg, "-")
+	var prev *Option
+	for i := 0; i < len(cluster); {
+		r, size := utf8.DecodeRuneInString(cluster[i:])
+		name := cluster[i : i+size]
+		i += size
+		opt := path.matchOption(name, normalize)
+		if opt == nil {
+			if prev != nil && prev.Plural && r >= '0' && r <= '9' {
+				err = accumulatorValueError(cluster[:i-size], r)
+				return
+			}
+			if state.disableClustering {
+				err = fmt.Errorf("option '%s' is not recognized", arg)
+				return
+			}
+			err = fmt.Errorf("option '-%s' is not recognized", name)
+			return
+		}
+		if opt.Flag {
+			if state.disableClustering && i < len(cluster) {
+				next, _ := utf8.DecodeRuneInString(cluster[i:])
+				if opt.Plural && next >= '0' && next <= '9' {
+					err = accumulatorValueError(cluster[:i], next)
+					return
+				}
+				err = fmt.Errorf("option '%s' is not recognized; short flags can't be combined, so specify '-%s' separately", arg, name)
+				return
+			}
+			err = decodeOption(state, opt, "")
+			if err != nil {
+				return
+			}
+			prev = opt
+			continue
+		}
+
+		value := cluster[i:]
+		if value == "" && !opt.OptionalArg {
+			if len(next) == 0 {
+				err = fmt.Errorf("option '%s' requires an argument", optionDisplayName(opt))
+				return
 			}
+			// Consume the next arg
+			value = next[0]
+			consumed = 1
+			warnOptionLikeValue(path, opt, value, state, normalize)
 		}
+		err = decodeOption(state, opt, value)
+		return
 	}
 	return
 }
 
-func duplicateArgs(args []string) []string {
-	dupe := make([]string, len(args))
-	for i := range args {
-		dupe[i] = args[i]
+// accumulatorValueError returns the error for a digit following a repeatable
+// flag in a short option cluster, such as "-v3".  The flag is the last rune
+// of prefix.
+func accumulatorValueError(prefix string, digit rune) error {
+	flag, _ := utf8.DecodeLastRuneInString(prefix)
+	n := int(digit - '0')
+	if n < 2 {
+		return fmt.Errorf("flag '-%c' does not take a value", flag)
 	}
-	return dupe
+	return fmt.Errorf("flag '-%c' does not take a value; did you mean to repeat it as -%s?", flag, strings.Repeat(string(flag), n))
 }
 
 /*
@@ -445,17 +1903,35 @@ var (
 	decoderT   = reflect.TypeOf(decoderPtr).Elem()
 
 	aliasTag       = "alias"
+	baseTag        = "base"
+	byteSizeTag    = "bytesize"
+	caseTag        = "case"
 	commandTag     = "command"
+	conflictsTag   = "conflicts"
 	defaultTag     = "default"
 	descriptionTag = "description"
 	envTag         = "env"
+	expandTag      = "expand"
 	flagTag        = "flag"
+	longDescTag    = "long_description"
+	globTag        = "glob"
+	goarchTag      = "goarch"
+	goosTag        = "goos"
+	groupingTag    = "grouping"
 	optionTag      = "option"
 	placeholderTag = "placeholder"
+	replaceTag     = "replace"
+	requiresTag    = "requires"
+	maxValuesTag   = "maxvalues"
+	minValuesTag   = "minvalues"
+	uniqueTag      = "unique"
+	pathTag        = "path"
+	envFieldType   = "environment field"
 	invalidTags    = map[string][]string{
-		commandTag: {defaultTag, envTag, flagTag, optionTag, placeholderTag},
-		flagTag:    {aliasTag, commandTag, defaultTag, envTag, optionTag, placeholderTag},
-		optionTag:  {aliasTag, commandTag, flagTag},
+		commandTag:   {baseTag, byteSizeTag, caseTag, conflictsTag, defaultTag, envTag, expandTag, flagTag, globTag, goarchTag, goosTag, groupingTag, maxValuesTag, minValuesTag, optionTag, pathTag, placeholderTag, replaceTag, requiresTag, uniqueTag},
+		flagTag:      {aliasTag, baseTag, byteSizeTag, caseTag, commandTag, defaultTag, envTag, globTag, groupingTag, optionTag, pathTag, placeholderTag, replaceTag, uniqueTag},
+		optionTag:    {aliasTag, commandTag, flagTag},
+		envFieldType: {aliasTag, baseTag, byteSizeTag, caseTag, commandTag, conflictsTag, descriptionTag, expandTag, flagTag, globTag, groupingTag, longDescTag, maxValuesTag, minValuesTag, optionTag, pathTag, placeholderTag, replaceTag, requiresTag, uniqueTag},
 	}
 )
 
@@ -470,6 +1946,9 @@ func parseCommandSpec(name string, spec interface{}, path Path) *Command {
 	rval = rval.Elem()
 
 	cmd := &Command{Name: name}
+	if len(path) > 0 {
+		cmd.parent = path.Last()
+	}
 	path = append(path, cmd)
 
 	for i := 0; i < rval.Type().NumField(); i++ {
@@ -480,11 +1959,28 @@ func parseCommandSpec(name string, spec interface{}, path Path) *Command {
 			continue
 		}
 		if field.Tag.Get(flagTag) != "" {
-			cmd.Options = append(cmd.Options, parseFlagField(field, fieldVal))
+			opt := parseFlagField(field, fieldVal)
+			if platformMatches(field) {
+				cmd.Options = append(cmd.Options, opt)
+			} else {
+				cmd.skippedNames = append(cmd.skippedNames, opt.Names...)
+			}
 			continue
 		}
 		if field.Tag.Get(optionTag) != "" {
-			cmd.Options = append(cmd.Options, parseOptionField(field, fieldVal))
+			opt := parseOptionField(field, fieldVal)
+			if platformMatches(field) {
+				cmd.Options = append(cmd.Options, opt)
+			} else {
+				cmd.skippedNames = append(cmd.skippedNames, opt.Names...)
+			}
+			continue
+		}
+		if field.Tag.Get(envTag) != "" {
+			opt := parseEnvField(field, fieldVal)
+			if platformMatches(field) {
+				cmd.envFields = append(cmd.envFields, opt)
+			}
 			continue
 		}
 	}
@@ -511,7 +2007,8 @@ func parseCommandSpec(name string, spec interface{}, path Path) *Command {
 			{Commands: visibleSubs, Header: "Available Commands:"},
 		}
 	}
-	cmd.Help.Usage = fmt.Sprintf("Usage: %s [OPTION]... [ARG]...", path.String())
+	cmd.pathName = path.String()
+	cmd.Help.Usage = "Usage: " + cmd.Synopsis()
 	return cmd
 }
 
@@ -527,10 +2024,24 @@ func parseCommandField(field reflect.StructField, fieldVal reflect.Value, path P
 		panicCommand("commands must have a single name (field %s)", field.Name)
 	}
 
-	cmd := parseCommandSpec(names[0], fieldVal.Addr().Interface(), path)
+	var spec interface{}
+	if field.Type.Kind() == reflect.Ptr {
+		if field.Type.Elem().Kind() != reflect.Struct {
+			panicCommand("command fields must be structs or pointers to structs, not %s (field %s)", field.Type, field.Name)
+		}
+		if fieldVal.IsNil() {
+			fieldVal.Set(reflect.New(field.Type.Elem()))
+		}
+		spec = fieldVal.Interface()
+	} else {
+		spec = fieldVal.Addr().Interface()
+	}
+
+	cmd := parseCommandSpec(names[0], spec, path)
 	cmd.Aliases = parseCommaNames(field.Tag.Get(aliasTag))
 	cmd.Description = field.Tag.Get(descriptionTag)
-	cmd.validate()
+	cmd.LongDescription = field.Tag.Get(longDescTag)
+	cmd.validateCommand()
 	return cmd
 }
 
@@ -547,7 +2058,11 @@ func parseFlagField(field reflect.StructField, fieldVal reflect.Value) *Option {
 		Names:       names,
 		Flag:        true,
 		Description: field.Tag.Get(descriptionTag),
+		Requires:    parseCommaNames(field.Tag.Get(requiresTag)),
+		Conflicts:   parseCommaNames(field.Tag.Get(conflictsTag)),
 	}
+	opt.LongDescription = field.Tag.Get(longDescTag)
+	opt.ExpandDescription = parseExpandTag(field)
 
 	if field.Type.Implements(decoderT) {
 		opt.Decoder = fieldVal.Interface().(OptionDecoder)
@@ -565,6 +2080,9 @@ func parseFlagField(field reflect.StructField, fieldVal reflect.Value) *Option {
 		}
 	}
 
+	opt.MinValues = parseIntTag(field, minValuesTag)
+	opt.MaxValues = parseIntTag(field, maxValuesTag)
+
 	opt.validate()
 	return opt
 }
@@ -582,9 +2100,94 @@ func parseOptionField(field reflect.StructField, fieldVal reflect.Value) *Option
 		Names:       names,
 		Description: field.Tag.Get(descriptionTag),
 		Placeholder: field.Tag.Get(placeholderTag),
+		Requires:    parseCommaNames(field.Tag.Get(requiresTag)),
+		Conflicts:   parseCommaNames(field.Tag.Get(conflictsTag)),
 	}
+	opt.LongDescription = field.Tag.Get(longDescTag)
+	opt.ExpandDescription = parseExpandTag(field)
 
-	if field.Type.Implements(decoderT) {
+	var decoderTag string
+	for _, tag := range decoderTags {
+		if field.Tag.Get(tag) == "" {
+			continue
+		}
+		if decoderTag != "" {
+			panicCommand("tags %s and %s cannot be combined (field %s)", decoderTag, tag, field.Name)
+		}
+		decoderTag = tag
+	}
+
+	unique := field.Tag.Get(uniqueTag)
+	if unique != "" {
+		if field.Type != reflect.TypeOf([]string(nil)) {
+			panicCommand("tag %s is only valid for []string options (field %s)", uniqueTag, field.Name)
+		}
+		switch unique {
+		case "true":
+			opt.Decoder = NewUniqueStringSliceDecoder(fieldVal.Addr().Interface().(*[]string))
+		case "ignorecase":
+			opt.Decoder = NewUniqueStringSliceDecoderFold(fieldVal.Addr().Interface().(*[]string))
+		default:
+			panicCommand("tag %s must be %q or %q (field %s)", uniqueTag, "true", "ignorecase", field.Name)
+		}
+		opt.Plural = true
+	} else if field.Tag.Get(globTag) != "" {
+		if field.Type != reflect.TypeOf([]string(nil)) {
+			panicCommand("tag %s is only valid for []string options (field %s)", globTag, field.Name)
+		}
+		switch field.Tag.Get(globTag) {
+		case "true":
+			opt.Decoder = NewGlobSliceDecoder(fieldVal.Addr().Interface().(*[]string))
+		case "strict":
+			opt.Decoder = NewStrictGlobSliceDecoder(fieldVal.Addr().Interface().(*[]string))
+		default:
+			panicCommand("tag %s must be %q or %q (field %s)", globTag, "true", "strict", field.Name)
+		}
+		opt.Plural = true
+	} else if field.Tag.Get(pathTag) != "" {
+		if field.Type.Kind() != reflect.String {
+			panicCommand("tag %s is only valid for string options (field %s)", pathTag, field.Name)
+		}
+		mode, present := pathModes[field.Tag.Get(pathTag)]
+		if !present {
+			panicCommand("tag %s value %q is not recognized (field %s)", pathTag, field.Tag.Get(pathTag), field.Name)
+		}
+		opt.Decoder = NewPathDecoder(fieldVal.Addr().Interface().(*string), mode)
+	} else if field.Tag.Get(caseTag) != "" {
+		if field.Type != reflect.TypeOf("") {
+			panicCommand("tag %s is only valid for string options (field %s)", caseTag, field.Name)
+		}
+		mode, present := caseModes[field.Tag.Get(caseTag)]
+		if !present {
+			panicCommand("tag %s value %q is not recognized (field %s)", caseTag, field.Tag.Get(caseTag), field.Name)
+		}
+		opt.Decoder = NewCaseStringDecoder(fieldVal.Addr().Interface().(*string), mode)
+	} else if field.Tag.Get(baseTag) != "" {
+		switch field.Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			panicCommand("tag %s is only valid for integer options (field %s)", baseTag, field.Name)
+		}
+		opt.Decoder = NewBaseIntDecoder(fieldVal.Addr().Interface(), parseIntTag(field, baseTag))
+	} else if field.Tag.Get(byteSizeTag) != "" {
+		if field.Type != reflect.TypeOf(int64(0)) {
+			panicCommand("tag %s is only valid for int64 options (field %s)", byteSizeTag, field.Name)
+		}
+		if field.Tag.Get(byteSizeTag) != "true" {
+			panicCommand("tag %s must be %q (field %s)", byteSizeTag, "true", field.Name)
+		}
+		opt.Decoder = NewByteSizeDecoder(fieldVal.Addr().Interface().(*int64))
+	} else if field.Tag.Get(groupingTag) != "" {
+		sep := []rune(field.Tag.Get(groupingTag))
+		if len(sep) != 1 {
+			panicCommand("tag %s must be a single character (field %s)", groupingTag, field.Name)
+		}
+		if !groupableKind(field.Type.Kind()) {
+			panicCommand("tag %s is only valid for integer and float options (field %s)", groupingTag, field.Name)
+		}
+		opt.Decoder = newGroupedDecoder(fieldVal, sep[0])
+	} else if field.Type.Implements(decoderT) {
 		opt.Decoder = fieldVal.Interface().(OptionDecoder)
 	} else if fieldVal.CanAddr() && reflect.PtrTo(field.Type).Implements(decoderT) {
 		opt.Decoder = fieldVal.Addr().Interface().(OptionDecoder)
@@ -598,19 +2201,82 @@ func parseOptionField(field reflect.StructField, fieldVal reflect.Value) *Option
 		opt.Decoder = NewOptionDecoder(fieldVal.Addr().Interface())
 	}
 
-	defaultArg := field.Tag.Get(defaultTag)
-	if defaultArg != "" {
-		opt.Decoder = NewDefaulter(opt.Decoder, defaultArg)
+	opt.MinValues = parseIntTag(field, minValuesTag)
+	opt.MaxValues = parseIntTag(field, maxValuesTag)
+
+	opt.Default = field.Tag.Get(defaultTag)
+	if opt.Default != "" {
+		opt.Decoder = NewDefaulter(opt.Decoder, opt.Default)
+	}
+	opt.Env = field.Tag.Get(envTag)
+	if opt.Env != "" {
+		opt.Decoder = NewEnvDefaulter(opt.Decoder, opt.Env)
 	}
-	envName := field.Tag.Get(envTag)
-	if envName != "" {
-		opt.Decoder = NewEnvDefaulter(opt.Decoder, envName)
+	switch field.Tag.Get(replaceTag) {
+	case "":
+		if opt.Plural && (field.Type.Kind() == reflect.Slice || field.Type.Kind() == reflect.Map) {
+			opt.Decoder = newConfigReplacingDecoder(opt.Decoder, fieldVal)
+		}
+	case "true":
+		if field.Type.Kind() != reflect.Slice && field.Type.Kind() != reflect.Map {
+			panicCommand("tag %s is only valid for slice and map options (field %s)", replaceTag, field.Name)
+		}
+		opt.Decoder = NewReplacingDecoder(opt.Decoder, fieldVal.Addr().Interface())
+	default:
+		panicCommand("tag %s must be %q (field %s)", replaceTag, "true", field.Name)
 	}
 
 	opt.validate()
 	return opt
 }
 
+// decoderTags lists the option field tags that select the field's decoder.
+// At most one of them may be set on a field.
+var decoderTags = []string{uniqueTag, globTag, pathTag, caseTag, baseTag, byteSizeTag, groupingTag}
+
+// parseEnvField parses a field with an "env" tag, but no "option" or "flag"
+// tag.  The returned Option has no names, so it can't be parsed from
+// arguments.  It's only used to apply defaults.
+func parseEnvField(field reflect.StructField, fieldVal reflect.Value) *Option {
+	checkTags(field, envFieldType)
+	checkExported(field, envFieldType)
+
+	opt := &Option{}
+	if field.Type.Implements(decoderT) {
+		opt.Decoder = fieldVal.Interface().(OptionDecoder)
+	} else if fieldVal.CanAddr() && reflect.PtrTo(field.Type).Implements(decoderT) {
+		opt.Decoder = fieldVal.Addr().Interface().(OptionDecoder)
+	} else if fieldVal.Kind() == reflect.Bool {
+		opt.Decoder = basicDecoder{fieldVal, decodeBool}
+	} else {
+		opt.Decoder = NewOptionDecoder(fieldVal.Addr().Interface())
+	}
+
+	opt.Default = field.Tag.Get(defaultTag)
+	if opt.Default != "" {
+		opt.Decoder = NewDefaulter(opt.Decoder, opt.Default)
+	}
+	opt.Env = field.Tag.Get(envTag)
+	opt.Decoder = NewEnvDefaulter(opt.Decoder, opt.Env)
+	return opt
+}
+
+// pathModes maps "path" tag values to PathMode values.
+var pathModes = map[string]PathMode{
+	"existing":      PathMustExist,
+	"existing-dir":  PathMustBeDir,
+	"existing-file": PathMustBeFile,
+	"parent-exists": PathParentMustExist,
+}
+
+// caseModes maps "case" tag values to CaseMode values.
+var caseModes = map[string]CaseMode{
+	"none":  CaseNone,
+	"lower": CaseLower,
+	"upper": CaseUpper,
+	"title": CaseTitle,
+}
+
 func checkTags(field reflect.StructField, fieldType string) {
 	badTags, present := invalidTags[fieldType]
 	if !present {
@@ -629,6 +2295,58 @@ func checkExported(field reflect.StructField, fieldType string) {
 	}
 }
 
+func parseIntTag(field reflect.StructField, tag string) int {
+	spec := field.Tag.Get(tag)
+	if spec == "" {
+		return 0
+	}
+	v, err := strconv.Atoi(spec)
+	if err != nil {
+		panicCommand("tag %s must be an integer (field %s)", tag, field.Name)
+	}
+	return v
+}
+
+// parseExpandTag reports whether field's description should be rendered as a
+// template, as set by its "expand" tag.
+func parseExpandTag(field reflect.StructField) bool {
+	switch field.Tag.Get(expandTag) {
+	case "":
+		return false
+	case "true":
+		return true
+	}
+	panicCommand("tag %s must be %q (field %s)", expandTag, "true", field.Name)
+	return false
+}
+
+// targetGOOS and targetGOARCH are the platform values matched against the
+// goos and goarch tags.  They are variables so tests may override them.
+var (
+	targetGOOS   = runtime.GOOS
+	targetGOARCH = runtime.GOARCH
+)
+
+// platformMatches reports whether the field's goos and goarch tags, if any,
+// include the current platform.  The field is parsed regardless so that tag
+// errors surface on every platform.
+func platformMatches(field reflect.StructField) bool {
+	return tagMatches(field, goosTag, targetGOOS) && tagMatches(field, goarchTag, targetGOARCH)
+}
+
+func tagMatches(field reflect.StructField, tag string, target string) bool {
+	values := parseCommaNames(field.Tag.Get(tag))
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
 func parseCommaNames(spec string) []string {
 	isSep := func(r rune) bool {
 		return r == ',' || unicode.IsSpace(r)
@@ -21,14 +21,18 @@
 package writ
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"math"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -109,8 +113,8 @@ var commandFieldTests = []commandFieldTest{
 	{Args: []string{"-f", "bar"}, Valid: false},
 	{Args: []string{"-fbar"}, Valid: false},
 	{Args: []string{"--help", "--help"}, Valid: false, Err: `option "--help" specified too many times`},
-	{Args: []string{"-h", "-h"}, Valid: false, Err: `option "-h" specified too many times`},
-	{Args: []string{"-hh"}, Valid: false, Err: `option "-h" specified too many times`},
+	{Args: []string{"-h", "-h"}, Valid: false, Err: `option "--help" specified too many times`},
+	{Args: []string{"-hh"}, Valid: false, Err: `option "--help" specified too many times`},
 
 	// Path: top mid
 	{Args: []string{"mid"}, Valid: true, Path: "top mid", Positional: []string{}},
@@ -165,8 +169,8 @@ var commandFieldTests = []commandFieldTest{
 	{Args: []string{"mid", "-f", "bar"}, Valid: false},
 	{Args: []string{"mid", "-fbar"}, Valid: false},
 	{Args: []string{"mid", "--help", "--help"}, Valid: false, Err: `option "--help" specified too many times`},
-	{Args: []string{"mid", "-h", "-h"}, Valid: false, Err: `option "-h" specified too many times`},
-	{Args: []string{"mid", "-hh"}, Valid: false, Err: `option "-h" specified too many times`},
+	{Args: []string{"mid", "-h", "-h"}, Valid: false, Err: `option "--help" specified too many times`},
+	{Args: []string{"mid", "-hh"}, Valid: false, Err: `option "--help" specified too many times`},
 
 	// Path: top mid bottom
 	{Args: []string{"mid", "bottom"}, Valid: true, Path: "top mid bottom", Positional: []string{}},
@@ -207,8 +211,8 @@ var commandFieldTests = []commandFieldTest{
 	{Args: []string{"-b", "3", "bottom"}, Valid: false},
 	{Args: []string{"-b", "3", "mid", "bottom"}, Valid: false},
 	{Args: []string{"mid", "--help", "--help", "bottom"}, Valid: false, Err: `option "--help" specified too many times`},
-	{Args: []string{"mid", "-h", "-h", "bottom"}, Valid: false, Err: `option "-h" specified too many times`},
-	{Args: []string{"mid", "-hh", "bottom"}, Valid: false, Err: `option "-h" specified too many times`},
+	{Args: []string{"mid", "-h", "-h", "bottom"}, Valid: false, Err: `option "--help" specified too many times`},
+	{Args: []string{"mid", "-hh", "bottom"}, Valid: false, Err: `option "--help" specified too many times`},
 
 	// Duplicate option routing (HelpFlag)
 	{Args: []string{"-h"}, Valid: true, Path: "top", Positional: []string{}, Field: "HelpFlagTop", Value: true},
@@ -282,6 +286,24 @@ func runCommandFieldTest(t *testing.T, spec *topSpec, test commandFieldTest) {
 	}
 }
 
+func TestMustDecode(t *testing.T) {
+	spec := &topSpec{}
+	cmd := New("top", spec)
+	path, positional := cmd.MustDecode([]string{"-t", "1", "mid", "foo"})
+	if path.String() != "top mid" || !reflect.DeepEqual(positional, []string{"foo"}) || spec.Top != 1 {
+		t.Errorf("MustDecode returned incorrect results.  Path: %s, Positional: %q, Top: %d", path, positional, spec.Top)
+	}
+
+	defer func() {
+		r := recover()
+		_, ok := r.(error)
+		if !ok {
+			t.Errorf("Expected MustDecode to panic with an error, but received %#v", r)
+		}
+	}()
+	cmd.MustDecode([]string{"--bogus"})
+}
+
 func TestCommandString(t *testing.T) {
 	cmd := New("top", &topSpec{})
 	if cmd.String() != "top" {
@@ -295,6 +317,206 @@ func TestCommandString(t *testing.T) {
 	}
 }
 
+func TestParent(t *testing.T) {
+	cmd := New("top", &topSpec{})
+	mid := cmd.Subcommand("mid")
+	bottom := mid.Subcommand("bottom")
+	if cmd.Parent() != nil {
+		t.Errorf("Expected a nil parent for the top-level command.  Received: %s", cmd.Parent())
+	}
+	if mid.Parent() != cmd || bottom.Parent() != mid {
+		t.Errorf("Invalid parents.  Mid: %v, Bottom: %v", mid.Parent(), bottom.Parent())
+	}
+
+	help := cmd.AddHelpCommand("")
+	if help.Parent() != cmd {
+		t.Errorf("Invalid parent for help command.  Received: %v", help.Parent())
+	}
+
+	dup := cmd.Clone(&topSpec{})
+	dupMid := dup.Subcommand("mid")
+	if dup.Parent() != nil || dupMid.Parent() != dup || dupMid.Subcommand("bottom").Parent() != dupMid {
+		t.Errorf("Invalid parents for cloned commands.  Top: %v, Mid: %v", dup.Parent(), dupMid.Parent())
+	}
+	if mid.Clone(nil).Parent() != nil {
+		t.Errorf("Expected a nil parent for a cloned subcommand")
+	}
+
+	manual := &Command{Name: "manual", Subcommands: []*Command{{Name: "sub"}}}
+	if manual.Subcommands[0].Parent() != nil {
+		t.Errorf("Expected a nil parent for a manually constructed command")
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	cmd := New("top", &topSpec{})
+	cmd.Freeze()
+	if !cmd.Frozen() || !cmd.Subcommand("mid").Subcommand("bottom").Frozen() {
+		t.Errorf("Expected Freeze() to freeze the command tree")
+	}
+
+	before := cmd.Clone(nil)
+	_, _, err := cmd.Decode([]string{"-t", "1", "mid", "-m", "2", "bottom", "-b", "3"})
+	if err != nil {
+		t.Errorf("Received unexpected error decoding frozen command.  Error: %s", err)
+	}
+	if !sameCommandStructure(before, cmd) {
+		t.Errorf("Expected Decode() not to modify the structure of a frozen command")
+	}
+
+	mutations := []struct {
+		Description string
+		Mutate      func(c *Command)
+	}{
+		{"add help command", func(c *Command) { c.AddHelpCommand("help") }},
+		{"add option", func(c *Command) {
+			c.Options = append(c.Options, &Option{Names: []string{"x"}, Decoder: NewFlagDecoder(new(bool)), Flag: true})
+			c.Decode(nil)
+		}},
+		{"replace subcommand", func(c *Command) {
+			c.Subcommands[0] = &Command{Name: "mid"}
+			c.Decode(nil)
+		}},
+		{"remove nested option", func(c *Command) {
+			mid := c.Subcommand("mid")
+			mid.Options = mid.Options[:1]
+			c.Decode(nil)
+		}},
+	}
+	for _, m := range mutations {
+		frozen := New("top", &topSpec{})
+		frozen.Freeze()
+		func() {
+			defer func() {
+				r := recover()
+				if _, ok := r.(commandError); !ok {
+					t.Errorf("Expected a commandError panic.  Mutation: %s, Received: %v", m.Description, r)
+				}
+			}()
+			m.Mutate(frozen)
+		}()
+	}
+
+	dup := cmd.Clone(nil)
+	if dup.Frozen() || dup.Subcommand("mid").Frozen() {
+		t.Errorf("Expected Clone() to return an unfrozen copy")
+	}
+	dup.AddHelpCommand("Display help")
+	if cmd.Subcommand("help") != nil {
+		t.Errorf("Expected changes to the clone not to affect the frozen command")
+	}
+}
+
+// sameCommandStructure compares the names of a and b's options and
+// subcommands, recursively.
+func sameCommandStructure(a *Command, b *Command) bool {
+	if a.Name != b.Name || len(a.Options) != len(b.Options) || len(a.Subcommands) != len(b.Subcommands) {
+		return false
+	}
+	for i := range a.Options {
+		if !reflect.DeepEqual(a.Options[i].Names, b.Options[i].Names) {
+			return false
+		}
+	}
+	for i := range a.Subcommands {
+		if !sameCommandStructure(a.Subcommands[i], b.Subcommands[i]) {
+			return false
+		}
+	}
+	return len(a.Help.OptionGroups) == len(b.Help.OptionGroups) && len(a.Help.CommandGroups) == len(b.Help.CommandGroups)
+}
+
+func TestCommandClone(t *testing.T) {
+	spec := &topSpec{}
+	cmd := New("top", spec)
+	cmd.Help.Header = "Header"
+	cmd.Subcommand("mid").Description = "changed"
+
+	cloneSpec := &topSpec{}
+	clone := cmd.Clone(cloneSpec)
+	if clone == cmd || clone.Subcommand("mid") == cmd.Subcommand("mid") || clone.Option("t") == cmd.Option("t") {
+		t.Errorf("Expected cloned command to have distinct commands and options")
+	}
+	if clone.Help.Header != "Header" || clone.Subcommand("mid").Description != "changed" {
+		t.Errorf("Expected cloned command to retain customizations")
+	}
+	if clone.Help.OptionGroups[0].Options[0] != clone.Options[0] {
+		t.Errorf("Expected cloned option groups to reference cloned options")
+	}
+	if clone.Help.CommandGroups[0].Commands[0] != clone.Subcommands[0] {
+		t.Errorf("Expected cloned command groups to reference cloned commands")
+	}
+
+	path, _, err := clone.Decode([]string{"-t", "1", "mid", "-m", "2"})
+	if err != nil {
+		t.Errorf("Received unexpected error decoding clone.  Error: %s", err)
+		return
+	}
+	if path.String() != "top mid" || path.First() != clone {
+		t.Errorf("Expected cloned path to be %q, received %q", "top mid", path)
+	}
+	if cloneSpec.Top != 1 || cloneSpec.MidSpec.Mid != 2 {
+		t.Errorf("Expected clone to decode into the new spec")
+	}
+	if spec.Top != 0 || spec.MidSpec.Mid != 0 {
+		t.Errorf("Expected clone decoding to leave the original spec untouched")
+	}
+
+	shared := cmd.Clone(nil)
+	shared.Decode([]string{"-t", "3"})
+	if spec.Top != 3 {
+		t.Errorf("Expected clone without a spec to share decoders with the original")
+	}
+
+	err = checkInvalidClone(cmd, &struct{}{})
+	if err == nil {
+		t.Errorf("Expected error cloning with a mismatched spec type, but none received")
+	}
+	err = checkInvalidClone(&Command{Name: "manual"}, &topSpec{})
+	if err == nil {
+		t.Errorf("Expected error cloning a manual command with a spec, but none received")
+	}
+}
+
+func TestConcurrentClones(t *testing.T) {
+	cmd := New("top", &topSpec{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			spec := &topSpec{}
+			_, _, err := cmd.Clone(spec).Decode([]string{"-t", strconv.Itoa(i), "mid", "bottom", "-b", strconv.Itoa(i)})
+			if err != nil {
+				t.Errorf("Received unexpected error decoding clone.  Error: %s", err)
+				return
+			}
+			if spec.Top != i || spec.MidSpec.BottomSpec.Bottom != i {
+				t.Errorf("Decoded value is incorrect.  Expected: %d, Received: %d and %d", i, spec.Top, spec.MidSpec.BottomSpec.Bottom)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func checkInvalidClone(cmd *Command, spec interface{}) (err error) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			switch e := r.(type) {
+			case commandError:
+				err = e
+			case optionError:
+				err = e
+			default:
+				panic(e)
+			}
+		}
+	}()
+	cmd.Clone(spec)
+	return nil
+}
+
 /*
  * Test parsing of description metadata
  */
@@ -344,6 +566,7 @@ type defaultFieldSpec struct {
 type defaultFieldTest struct {
 	Args       []string
 	Valid      bool
+	Strict     bool
 	Field      string
 	Value      interface{}
 	EnvKey     string
@@ -373,6 +596,14 @@ var defaultFieldTests = []defaultFieldTest{
 	{Args: []string{"-s", "4"}, Valid: true, EnvKey: "STACKED_DEFAULT", EnvValue: "foo", Field: "StackedDefault", Value: 4},
 	{Args: []string{"-s", "foo"}, Valid: false, EnvKey: "STACKED_DEFAULT", EnvValue: "foo"},
 	{Args: []string{"-s", "foo"}, Valid: false},
+
+	// Strict defaults
+	{Args: []string{""}, Valid: true, Strict: true, Field: "StackedDefault", Value: 84},
+	{Args: []string{""}, Valid: true, Strict: true, EnvKey: "ENV_DEFAULT", EnvValue: "2", Field: "EnvDefault", Value: 2},
+	{Args: []string{""}, Valid: true, Strict: true, EnvKey: "STACKED_DEFAULT", EnvValue: "2", Field: "StackedDefault", Value: 2},
+	{Args: []string{""}, Valid: false, Strict: true, EnvKey: "ENV_DEFAULT", EnvValue: "foo"},
+	{Args: []string{""}, Valid: false, Strict: true, EnvKey: "STACKED_DEFAULT", EnvValue: "foo"},
+	{Args: []string{"-s", "4"}, Valid: false, Strict: true, EnvKey: "STACKED_DEFAULT", EnvValue: "foo"},
 }
 
 func TestDefaultFields(t *testing.T) {
@@ -394,6 +625,7 @@ func runDefaultFieldTest(t *testing.T, spec interface{}, test defaultFieldTest)
 		os.Setenv(test.EnvKey, test.EnvValue)
 	}
 	cmd := New("test", spec)
+	cmd.StrictDefaults = test.Strict
 	_, _, err := cmd.Decode(test.Args)
 
 	if !test.Valid {
@@ -413,26 +645,199 @@ func runDefaultFieldTest(t *testing.T, spec interface{}, test defaultFieldTest)
 	}
 }
 
+func TestDefaultFieldsRecorded(t *testing.T) {
+	cmd := New("test", &struct {
+		Both    string `option:"b" default:"bval" env:"BVAL"`
+		Default int    `option:"d" default:"42"`
+		Env     string `option:"e" env:"EVAL"`
+		Neither string `option:"n"`
+	}{})
+	expected := map[string][2]string{
+		"b": {"bval", "BVAL"},
+		"d": {"42", ""},
+		"e": {"", "EVAL"},
+		"n": {"", ""},
+	}
+	for name, values := range expected {
+		opt := cmd.Option(name)
+		if opt.Default != values[0] || opt.Env != values[1] {
+			t.Errorf("Invalid default fields.  Option: %s, Expected: %q, Received: %q", name, values, [2]string{opt.Default, opt.Env})
+		}
+	}
+}
+
+type envFieldSpec struct {
+	Token   string   `env:"WRIT_ENVFIELD_TOKEN"`
+	Workers int      `env:"WRIT_ENVFIELD_WORKERS" default:"4"`
+	Debug   bool     `env:"WRIT_ENVFIELD_DEBUG"`
+	Hosts   []string `env:"WRIT_ENVFIELD_HOSTS"`
+	Name    string   `option:"n, name"`
+	Sub     struct {
+		Region string `env:"WRIT_ENVFIELD_REGION" default:"us"`
+	} `command:"sub"`
+}
+
+func TestEnvFields(t *testing.T) {
+	env := map[string]string{
+		"WRIT_ENVFIELD_TOKEN":   "secret",
+		"WRIT_ENVFIELD_WORKERS": "8",
+		"WRIT_ENVFIELD_DEBUG":   "true",
+		"WRIT_ENVFIELD_HOSTS":   "a",
+		"WRIT_ENVFIELD_REGION":  "eu",
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	spec := &envFieldSpec{}
+	cmd := New("test", spec)
+	if len(cmd.Options) != 1 {
+		t.Errorf("Expected environment fields to have no options.  Received: %d options", len(cmd.Options))
+	}
+	_, _, err := cmd.Decode([]string{"-n", "foo"})
+	if err != nil {
+		t.Fatalf("Received unexpected error.  Error: %s", err)
+	}
+	if spec.Token != "secret" || spec.Workers != 8 || !spec.Debug || !reflect.DeepEqual(spec.Hosts, []string{"a"}) || spec.Sub.Region != "eu" || spec.Name != "foo" {
+		t.Errorf("Invalid environment field values.  Spec: %+v", spec)
+	}
+	_, _, err = cmd.Decode([]string{"--token", "foo"})
+	if err == nil {
+		t.Errorf("Expected environment fields to be unparseable")
+	}
+
+	// Defaults apply when variables are unset, and clones decode into their own spec
+	os.Unsetenv("WRIT_ENVFIELD_WORKERS")
+	os.Unsetenv("WRIT_ENVFIELD_REGION")
+	os.Setenv("WRIT_ENVFIELD_DEBUG", "0")
+	dupSpec := &envFieldSpec{}
+	_, _, err = cmd.Clone(dupSpec).Decode([]string{})
+	if err != nil {
+		t.Fatalf("Received unexpected error.  Error: %s", err)
+	}
+	if dupSpec.Workers != 4 || dupSpec.Debug || dupSpec.Sub.Region != "us" || dupSpec.Token != "secret" {
+		t.Errorf("Invalid environment field values for clone.  Spec: %+v", dupSpec)
+	}
+
+	// Invalid values are ignored, unless StrictDefaults is set
+	os.Setenv("WRIT_ENVFIELD_WORKERS", "many")
+	spec = &envFieldSpec{}
+	cmd = New("test", spec)
+	_, _, err = cmd.Decode([]string{})
+	if err != nil || spec.Workers != 4 {
+		t.Errorf("Expected invalid environment value to be ignored.  Workers: %d, Error: %v", spec.Workers, err)
+	}
+	cmd.StrictDefaults = true
+	_, _, err = cmd.Decode([]string{})
+	if err == nil || !strings.Contains(err.Error(), "WRIT_ENVFIELD_WORKERS") {
+		t.Errorf("Expected an error naming the environment variable.  Received: %v", err)
+	}
+}
+
+func TestDecodedValues(t *testing.T) {
+	cmd := New("test", &struct {
+		Verbose  int               `flag:"v, verbose"`
+		Force    bool              `flag:"f"`
+		Name     string            `option:"n, name" default:"anon"`
+		Ports    []string          `option:"p, port"`
+		Settings map[string]string `option:"s"`
+		Custom   customTestOption  `option:"c, custom"`
+		Sub      struct {
+			Depth int `option:"d"`
+		} `command:"sub"`
+	}{})
+	_, _, err := cmd.Decode([]string{"-vv", "--port", "80", "-p", "443", "-s", "a=b"})
+	if err != nil {
+		t.Errorf("Received unexpected error.  Error: %s", err)
+		return
+	}
+	expected := map[string]interface{}{
+		"verbose": 2,
+		"f":       false,
+		"name":    "anon",
+		"port":    []string{"80", "443"},
+		"s":       map[string]string{"a": "b"},
+	}
+	values := cmd.DecodedValues()
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Invalid decoded values.  Expected: %#v, Received: %#v", expected, values)
+	}
+}
+
+func TestLongDescriptionFields(t *testing.T) {
+	spec := &struct {
+		Flag   bool   `flag:"f" description:"short flag" long_description:"long flag"`
+		Option string `option:"o" description:"short option" long_description:"long option"`
+		Sub    struct {
+			Plain bool `flag:"p" description:"plain"`
+		} `command:"sub" description:"short sub" long_description:"long sub"`
+	}{}
+	cmd := New("test", spec)
+	if cmd.Option("f").LongDescription != "long flag" {
+		t.Errorf("Invalid flag long description.  Received: %q", cmd.Option("f").LongDescription)
+	}
+	if cmd.Option("o").LongDescription != "long option" {
+		t.Errorf("Invalid option long description.  Received: %q", cmd.Option("o").LongDescription)
+	}
+	if cmd.Subcommand("sub").LongDescription != "long sub" {
+		t.Errorf("Invalid command long description.  Received: %q", cmd.Subcommand("sub").LongDescription)
+	}
+	if cmd.Subcommand("sub").Option("p").LongDescription != "" {
+		t.Errorf("Expected empty long description.  Received: %q", cmd.Subcommand("sub").Option("p").LongDescription)
+	}
+
+	help := cmd.HelpString()
+	if strings.Contains(help, "long ") {
+		t.Errorf("Long descriptions should not appear in help output.  Received: %q", help)
+	}
+}
+
+func TestDefaultWarnings(t *testing.T) {
+	realval := os.Getenv("ENV_DEFAULT")
+	defer os.Setenv("ENV_DEFAULT", realval)
+
+	os.Setenv("ENV_DEFAULT", "foo")
+	buf := bytes.NewBuffer(nil)
+	cmd := New("test", &defaultFieldSpec{})
+	cmd.Warnings = buf
+	_, _, err := cmd.Decode([]string{})
+	if err != nil {
+		t.Errorf("Received unexpected error. Error: %s", err)
+		return
+	}
+	expected := "Warning: error setting default value: decoder rejected value \"foo\" for environment variable ENV_DEFAULT\n"
+	if buf.String() != expected {
+		t.Errorf("Invalid warning output.  Expected: %q, Received: %q", expected, buf.String())
+	}
+
+	os.Setenv("ENV_DEFAULT", "2")
+	buf.Reset()
+	_, _, err = cmd.Decode([]string{})
+	if err != nil {
+		t.Errorf("Received unexpected error. Error: %s", err)
+		return
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected no warning output, but received %q", buf.String())
+	}
+}
+
 func TestBogusDefaultField(t *testing.T) {
 	var spec = &struct {
 		BogusDefault int `option:"b" description:"An int field with a bogus default" default:"bogus"`
 	}{}
 
-	defer func() {
-		r := recover()
-		if r != nil {
-			switch r.(type) {
-			case commandError, optionError:
-				// Intentional No-op
-			default:
-				panic(r)
-			}
-		}
-	}()
-
 	cmd := New("test", spec)
-	cmd.Decode([]string{})
-	t.Errorf("Expected decoding to panic on bogus default value, but this didn't happen.")
+	_, _, err := cmd.Decode([]string{})
+	if err == nil {
+		t.Errorf("Expected decoding to return an error on bogus default value, but this didn't happen.")
+		return
+	}
+	expected := `option -b: error setting default value: decoder rejected arg "bogus"`
+	if err.Error() != expected {
+		t.Errorf("Invalid error message.  Expected: %s, Received: %s", expected, err.Error())
+	}
 }
 
 /*
@@ -442,6 +847,7 @@ func TestBogusDefaultField(t *testing.T) {
 type fieldTest struct {
 	Args       []string
 	Valid      bool
+	Err        string
 	Field      string
 	Value      interface{}
 	SkipReason string
@@ -458,6 +864,10 @@ func runFieldTest(t *testing.T, spec interface{}, test fieldTest) {
 	if !test.Valid {
 		if err == nil {
 			t.Errorf("Expected error but none received. Args: %q", test.Args)
+			return
+		}
+		if test.Err != "" && err.Error() != test.Err {
+			t.Errorf("Invalid error message.  Expected: %s, Received: %s", test.Err, err.Error())
 		}
 		return
 	}
@@ -538,7 +948,7 @@ var flagTests = []fieldTest{
 	{Args: []string{"-b"}, Valid: true, Field: "Bool", Value: true},
 	{Args: []string{"--bool"}, Valid: true, Field: "Bool", Value: true},
 	{Args: []string{"-b", "-b"}, Valid: false},
-	{Args: []string{"-b2"}, Valid: false},
+	{Args: []string{"-b2"}, Valid: false, Err: "option '-2' is not recognized"},
 	{Args: []string{"--bool=2"}, Valid: false},
 
 	// Accumulator flag
@@ -548,7 +958,9 @@ var flagTests = []fieldTest{
 	{Args: []string{"-aaa"}, Valid: true, Field: "Accumulator", Value: 3},
 	{Args: []string{"--acc", "-a"}, Valid: true, Field: "Accumulator", Value: 2},
 	{Args: []string{"-a", "--acc", "-aa"}, Valid: true, Field: "Accumulator", Value: 4},
-	{Args: []string{"-a3"}, Valid: false},
+	{Args: []string{"-a3"}, Valid: false, Err: "flag '-a' does not take a value; did you mean to repeat it as -aaa?"},
+	{Args: []string{"-ba2"}, Valid: false, Err: "flag '-a' does not take a value; did you mean to repeat it as -aa?"},
+	{Args: []string{"-a1"}, Valid: false, Err: "flag '-a' does not take a value"},
 	{Args: []string{"--acc=3"}, Valid: false},
 }
 
@@ -619,10 +1031,1721 @@ var mapSliceFieldTests = []fieldTest{
 	{Args: []string{"-m"}, Valid: false},
 }
 
-func TestMapSliceFields(t *testing.T) {
-	for _, test := range mapSliceFieldTests {
-		spec := &mapSliceFieldSpec{}
-		runFieldTest(t, spec, test)
+func TestMapSliceFields(t *testing.T) {
+	for _, test := range mapSliceFieldTests {
+		spec := &mapSliceFieldSpec{}
+		runFieldTest(t, spec, test)
+	}
+}
+
+/*
+ * Test value count bounds
+ */
+
+type valueBoundsFieldSpec struct {
+	Tags    []string          `option:"t, tag" description:"A bounded string slice option" minvalues:"1" maxvalues:"3"`
+	Labels  map[string]string `option:"l" description:"A bounded map option" maxvalues:"1"`
+	Command struct {
+		Required []string `option:"r" minvalues:"2"`
+	} `command:"command"`
+}
+
+var valueBoundsFieldTests = []fieldTest{
+	{Args: []string{"-t", "a"}, Valid: true, Field: "Tags", Value: []string{"a"}},
+	{Args: []string{"-t", "a", "--tag", "b", "-tc"}, Valid: true, Field: "Tags", Value: []string{"a", "b", "c"}},
+	{Args: []string{"-t", "a", "-l", "a=b"}, Valid: true, Field: "Labels", Value: map[string]string{"a": "b"}},
+	{Args: []string{}, Valid: false, Err: "option '--tag' requires at least 1 value"},
+	{Args: []string{"-l", "a=b"}, Valid: false, Err: "option '--tag' requires at least 1 value"},
+	{Args: []string{"-t", "a", "-t", "b", "-t", "c", "-t", "d"}, Valid: false, Err: "option '--tag' accepts at most 3 values"},
+	{Args: []string{"-t", "a", "-l", "a=b", "-l", "c=d"}, Valid: false, Err: "option '-l' accepts at most 1 value"},
+	{Args: []string{"-t", "a", "command", "-r", "a", "-r", "b"}, Valid: true, Field: "Tags", Value: []string{"a"}},
+	{Args: []string{"-t", "a", "command", "-r", "a"}, Valid: false, Err: "option '-r' requires at least 2 values"},
+	{Args: []string{"-t", "a", "command"}, Valid: false, Err: "option '-r' requires at least 2 values"},
+	{Args: []string{"command"}, Valid: false, Err: "missing required options: --tag, -r"},
+	{Args: []string{"-l", "a=b", "command"}, Valid: false, Err: "missing required options: --tag, -r"},
+	{Args: []string{"command", "-r", "a"}, Valid: false, Err: "option '--tag' requires at least 1 value"},
+}
+
+type relationFieldSpec struct {
+	Archive bool   `flag:"a, archive" requires:"output"`
+	Extract bool   `flag:"x, extract" conflicts:"a, create"`
+	Create  bool   `flag:"c, create"`
+	Output  string `option:"o, output" default:"out"`
+	Command struct {
+		Level int `option:"l, level" requires:"archive, o" conflicts:"x"`
+	} `command:"command"`
+}
+
+var relationFieldTests = []fieldTest{
+	{Args: []string{"-a", "-o", "file"}, Valid: true, Field: "Output", Value: "file"},
+	{Args: []string{"-x"}, Valid: true, Field: "Extract", Value: true},
+	{Args: []string{"-o", "file"}, Valid: true, Field: "Archive", Value: false},
+	{Args: []string{"-a"}, Valid: false, Err: "option '--archive' requires option '--output'"},
+	{Args: []string{"-xa", "-o", "file"}, Valid: false, Err: "option '--extract' conflicts with option '--archive'"},
+	{Args: []string{"-c", "-x"}, Valid: false, Err: "option '--extract' conflicts with option '--create'"},
+	{Args: []string{"-a", "-o", "file", "command", "-l", "1"}, Valid: true, Field: "Output", Value: "file"},
+	{Args: []string{"command", "-l", "1"}, Valid: false, Err: "option '--level' requires option '--archive'"},
+	{Args: []string{"-a", "command", "-o", "file", "-l", "1", "-x"}, Valid: false, Err: "option '--extract' conflicts with option '--archive'"},
+}
+
+func TestRelationFields(t *testing.T) {
+	for _, test := range relationFieldTests {
+		spec := &relationFieldSpec{}
+		runFieldTest(t, spec, test)
+	}
+
+	err := Validate(&struct {
+		Archive bool   `flag:"a" requires:"ouptut"`
+		Output  string `option:"o, output"`
+	}{})
+	if _, ok := err.(optionError); !ok {
+		t.Errorf("Expected an option error for a misspelled required option.  Received: %v", err)
+	}
+	err = Validate(&struct {
+		Command struct {
+			Level int `option:"l" conflicts:"extract"`
+		} `command:"command"`
+		Other struct {
+			Extract bool `flag:"x, extract"`
+		} `command:"other"`
+	}{})
+	if _, ok := err.(optionError); !ok {
+		t.Errorf("Expected an option error for a conflict with a sibling command's option.  Received: %v", err)
+	}
+	err = Validate(&struct {
+		Command struct {
+			Level int `option:"l" requires:"x"`
+		} `command:"command"`
+		Extract bool `flag:"x"`
+	}{})
+	if err != nil {
+		t.Errorf("Expected a relation to a later parent option to validate.  Received: %v", err)
+	}
+
+	cmd := &Command{Name: "test"}
+	cmd.Options = []*Option{
+		{Names: []string{"a"}, Decoder: NewFlagDecoder(new(bool)), Flag: true, Requires: []string{"bogus"}},
+	}
+	defer func() {
+		r := recover()
+		if _, ok := r.(optionError); !ok {
+			t.Errorf("Expected an optionError panic for an unknown related option.  Received: %v", r)
+		}
+	}()
+	cmd.Decode([]string{"-a"})
+}
+
+func TestValueBoundsFields(t *testing.T) {
+	for _, test := range valueBoundsFieldTests {
+		spec := &valueBoundsFieldSpec{}
+		runFieldTest(t, spec, test)
+	}
+}
+
+type repeatBoundsFieldSpec struct {
+	Verbose int `flag:"v, verbose" minvalues:"1" maxvalues:"3"`
+	Quiet   int `flag:"q" maxvalues:"1"`
+}
+
+var repeatBoundsFieldTests = []fieldTest{
+	{Args: []string{"-v"}, Valid: true, Field: "Verbose", Value: 1},
+	{Args: []string{"-vvv"}, Valid: true, Field: "Verbose", Value: 3},
+	{Args: []string{"-vv", "--verbose", "-q"}, Valid: true, Field: "Quiet", Value: 1},
+	{Args: []string{}, Valid: false, Err: "flag '--verbose' must be specified at least 1 time"},
+	{Args: []string{"-vvvv"}, Valid: false, Err: "flag '--verbose' may be specified at most 3 times"},
+	{Args: []string{"-v", "-qq"}, Valid: false, Err: "flag '-q' may be specified at most 1 time"},
+}
+
+func TestRepeatBoundsFields(t *testing.T) {
+	for _, test := range repeatBoundsFieldTests {
+		spec := &repeatBoundsFieldSpec{}
+		runFieldTest(t, spec, test)
+	}
+
+	err := Validate(&struct {
+		Flag bool `flag:"f" maxvalues:"2"`
+	}{})
+	if _, ok := err.(optionError); !ok {
+		t.Errorf("Expected an option error for bounds on a bool flag.  Received: %v", err)
+	}
+}
+
+type pointerFieldSpec struct {
+	Count   *int     `option:"c, count"`
+	Name    *string  `option:"n, name"`
+	Ratio   *float32 `option:"r, ratio"`
+	Port    *uint16  `option:"p, port" default:"8080"`
+	Verbose bool     `flag:"v"`
+}
+
+var zeroInt = 0
+var emptyString = ""
+var portval = uint16(80)
+var defaultPortval = uint16(8080)
+
+var pointerFieldTests = []fieldTest{
+	{Args: []string{}, Valid: true, Field: "Count", Value: (*int)(nil)},
+	{Args: []string{"-v"}, Valid: true, Field: "Name", Value: (*string)(nil)},
+	{Args: []string{"--count", "0"}, Valid: true, Field: "Count", Value: &zeroInt},
+	{Args: []string{"--name="}, Valid: true, Field: "Name", Value: &emptyString},
+	{Args: []string{"-c", "x"}, Valid: false},
+	{Args: []string{"-c", "1", "-c", "2"}, Valid: false},
+	{Args: []string{}, Valid: true, Field: "Port", Value: &defaultPortval},
+	{Args: []string{"-p", "80"}, Valid: true, Field: "Port", Value: &portval},
+	{Args: []string{"-p", "65536"}, Valid: false},
+}
+
+func TestPointerFields(t *testing.T) {
+	for _, test := range pointerFieldTests {
+		spec := &pointerFieldSpec{}
+		runFieldTest(t, spec, test)
+	}
+
+	// A failed decode leaves the pointer unset, and a successful decode
+	// allocates a new value rather than writing through the old pointer.
+	spec := &pointerFieldSpec{}
+	cmd := New("test", spec)
+	_, _, err := cmd.Decode([]string{"-r", "bogus"})
+	if err == nil || spec.Ratio != nil {
+		t.Errorf("Expected a nil pointer after a failed decode.  Value: %v, Error: %v", spec.Ratio, err)
+	}
+	original := 5
+	spec.Count = &original
+	_, _, err = cmd.Decode([]string{"-c", "7"})
+	if err != nil || spec.Count == nil || *spec.Count != 7 || original != 5 {
+		t.Errorf("Invalid pointer decode.  Value: %v, Original: %d, Error: %v", spec.Count, original, err)
+	}
+}
+
+type replaceFieldSpec struct {
+	Inputs []string          `option:"i, input" default:"stdin" replace:"true"`
+	Tags   []string          `option:"t, tag" env:"WRIT_REPLACE_TEST_TAGS" replace:"true"`
+	Labels map[string]string `option:"l, label" default:"env=prod" replace:"true"`
+	Extras []string          `option:"e, extra" default:"base"`
+}
+
+var replaceFieldTests = []fieldTest{
+	{Args: []string{}, Valid: true, Field: "Inputs", Value: []string{"stdin"}},
+	{Args: []string{"-i", "a"}, Valid: true, Field: "Inputs", Value: []string{"a"}},
+	{Args: []string{"-i", "a", "--input", "b"}, Valid: true, Field: "Inputs", Value: []string{"a", "b"}},
+	{Args: []string{"-t", "a"}, Valid: true, Field: "Tags", Value: []string{"a"}},
+	{Args: []string{}, Valid: true, Field: "Labels", Value: map[string]string{"env": "prod"}},
+	{Args: []string{"-l", "tier=web"}, Valid: true, Field: "Labels", Value: map[string]string{"tier": "web"}},
+	{Args: []string{"-e", "more"}, Valid: true, Field: "Extras", Value: []string{"base", "more"}},
+}
+
+func TestReplaceFields(t *testing.T) {
+	for _, test := range replaceFieldTests {
+		spec := &replaceFieldSpec{}
+		runFieldTest(t, spec, test)
+	}
+
+	os.Setenv("WRIT_REPLACE_TEST_TAGS", "env")
+	defer os.Unsetenv("WRIT_REPLACE_TEST_TAGS")
+	spec := &replaceFieldSpec{}
+	cmd := New("test", spec)
+	_, _, err := cmd.Decode([]string{})
+	if err != nil || !reflect.DeepEqual(spec.Tags, []string{"env"}) {
+		t.Errorf("Invalid env default.  Value: %q, Error: %v", spec.Tags, err)
+	}
+	_, _, err = cmd.Decode([]string{"-t", "a", "-t", "b"})
+	if err != nil || !reflect.DeepEqual(spec.Tags, []string{"a", "b"}) {
+		t.Errorf("Env default wasn't replaced.  Value: %q, Error: %v", spec.Tags, err)
+	}
+
+	// Pre-set values and config values also count as defaults
+	spec = &replaceFieldSpec{Tags: []string{"preset"}}
+	os.Unsetenv("WRIT_REPLACE_TEST_TAGS")
+	cmd = New("test", spec)
+	_, _, err = cmd.Decode([]string{"-t", "a"})
+	if err != nil || !reflect.DeepEqual(spec.Tags, []string{"a"}) {
+		t.Errorf("Pre-set value wasn't replaced.  Value: %q, Error: %v", spec.Tags, err)
+	}
+
+	dir, err := ioutil.TempDir("", "writ-replace")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir.  Error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeConfig(t, dir, `{"input": ["x", "y"]}`)
+	spec = &replaceFieldSpec{}
+	cmd = New("test", spec)
+	err = cmd.LoadDefaultsFromFile(path)
+	if err != nil {
+		t.Fatalf("Received unexpected error loading config.  Error: %s", err)
+	}
+	_, _, err = cmd.Decode([]string{})
+	if err != nil || !reflect.DeepEqual(spec.Inputs, []string{"x", "y"}) {
+		t.Errorf("Config values didn't replace the default.  Value: %q, Error: %v", spec.Inputs, err)
+	}
+	_, _, err = cmd.Decode([]string{"-i", "z"})
+	if err != nil || !reflect.DeepEqual(spec.Inputs, []string{"z"}) {
+		t.Errorf("Config values weren't replaced.  Value: %q, Error: %v", spec.Inputs, err)
+	}
+}
+
+type platformFieldSpec struct {
+	Bootloader string `option:"bootloader" goos:"linux"`
+	Registry   bool   `flag:"registry" goos:"windows"`
+	Rosetta    bool   `flag:"rosetta" goos:"darwin" goarch:"arm64"`
+	Any        bool   `flag:"any" goos:"linux, windows, darwin"`
+}
+
+func TestPlatformFields(t *testing.T) {
+	defer func(goos, goarch string) {
+		targetGOOS, targetGOARCH = goos, goarch
+	}(targetGOOS, targetGOARCH)
+
+	tests := []struct {
+		GOOS    string
+		GOARCH  string
+		Present []string
+		Absent  []string
+	}{
+		{GOOS: "linux", GOARCH: "amd64", Present: []string{"bootloader", "any"}, Absent: []string{"registry", "rosetta"}},
+		{GOOS: "windows", GOARCH: "amd64", Present: []string{"registry", "any"}, Absent: []string{"bootloader", "rosetta"}},
+		{GOOS: "darwin", GOARCH: "amd64", Present: []string{"any"}, Absent: []string{"bootloader", "registry", "rosetta"}},
+		{GOOS: "darwin", GOARCH: "arm64", Present: []string{"rosetta", "any"}, Absent: []string{"bootloader", "registry"}},
+		{GOOS: "plan9", GOARCH: "386", Absent: []string{"bootloader", "registry", "rosetta", "any"}},
+	}
+	for _, test := range tests {
+		targetGOOS, targetGOARCH = test.GOOS, test.GOARCH
+		cmd := New("test", &platformFieldSpec{})
+		for _, name := range test.Present {
+			if cmd.Option(name) == nil {
+				t.Errorf("Expected option to be present.  GOOS: %s, GOARCH: %s, Option: %s", test.GOOS, test.GOARCH, name)
+			}
+		}
+		for _, name := range test.Absent {
+			if cmd.Option(name) != nil {
+				t.Errorf("Expected option to be skipped.  GOOS: %s, GOARCH: %s, Option: %s", test.GOOS, test.GOARCH, name)
+			}
+			_, _, err := cmd.Decode([]string{"--" + name})
+			if err == nil {
+				t.Errorf("Expected error decoding skipped option.  GOOS: %s, GOARCH: %s, Option: %s", test.GOOS, test.GOARCH, name)
+			}
+		}
+	}
+
+	type relationSpec struct {
+		Bootloader string `option:"bootloader" goos:"linux"`
+		Registry   string `option:"registry" goos:"windows"`
+		Kernel     string `option:"kernel" requires:"bootloader" conflicts:"registry"`
+		Sub        struct {
+			Image string `option:"image" requires:"bootloader"`
+		} `command:"sub"`
+	}
+	relationTests := []struct {
+		GOOS  string
+		Args  []string
+		Valid bool
+	}{
+		{GOOS: "linux", Args: []string{"--kernel", "k"}, Valid: false},
+		{GOOS: "linux", Args: []string{"--kernel", "k", "--bootloader", "b"}, Valid: true},
+		{GOOS: "windows", Args: []string{"--kernel", "k"}, Valid: true},
+		{GOOS: "windows", Args: []string{"--kernel", "k", "--registry", "r"}, Valid: false},
+		{GOOS: "darwin", Args: []string{"--kernel", "k", "sub", "--image", "i"}, Valid: true},
+	}
+	for _, test := range relationTests {
+		targetGOOS = test.GOOS
+		if err := Validate(&relationSpec{}); err != nil {
+			t.Errorf("Received unexpected error validating relations to skipped options.  GOOS: %s, Error: %s", test.GOOS, err)
+			continue
+		}
+		_, _, err := New("test", &relationSpec{}).Decode(test.Args)
+		if test.Valid && err != nil {
+			t.Errorf("Received unexpected error.  GOOS: %s, Args: %q, Error: %s", test.GOOS, test.Args, err)
+		}
+		if !test.Valid && err == nil {
+			t.Errorf("Expected error but none received.  GOOS: %s, Args: %q", test.GOOS, test.Args)
+		}
+	}
+}
+
+type namespacedFieldSpec struct {
+	LogLevel string `option:"l, log.level" description:"The log level"`
+	Path     int    `option:"a/b" requires:"log.level"`
+	Trace    bool   `flag:"log.trace" description:"Enable tracing"`
+	Sub      struct {
+		Region string `option:"cloud.region"`
+	} `command:"sub"`
+}
+
+var namespacedFieldTests = []fieldTest{
+	{Args: []string{"--log.level", "debug"}, Valid: true, Field: "LogLevel", Value: "debug"},
+	{Args: []string{"--log.level=debug"}, Valid: true, Field: "LogLevel", Value: "debug"},
+	{Args: []string{"-l", "debug"}, Valid: true, Field: "LogLevel", Value: "debug"},
+	{Args: []string{"--log.trace"}, Valid: true, Field: "Trace", Value: true},
+	{Args: []string{"-l", "info", "--a/b=2"}, Valid: true, Field: "Path", Value: 2},
+	{Args: []string{"-l", "info", "--a/b", "3"}, Valid: true, Field: "Path", Value: 3},
+	{Args: []string{"--a/b=2"}, Valid: false, Err: "option '--a/b' requires option '--log.level'"},
+	{Args: []string{"sub", "--cloud.region", "eu", "--log.level", "warn"}, Valid: true, Field: "LogLevel", Value: "warn"},
+	{Args: []string{"--cloud.region", "eu"}, Valid: false, Err: "option '--cloud.region' is not recognized"},
+	{Args: []string{"--log", "debug"}, Valid: false, Err: "option '--log' is not recognized"},
+	{Args: []string{"--log.level.x", "debug"}, Valid: false, Err: "option '--log.level.x' is not recognized"},
+	{Args: []string{"--a", "1"}, Valid: false, Err: "option '--a' is not recognized"},
+}
+
+func TestNamespacedFields(t *testing.T) {
+	for _, test := range namespacedFieldTests {
+		spec := &namespacedFieldSpec{}
+		runFieldTest(t, spec, test)
+	}
+
+	cmd := New("test", &namespacedFieldSpec{})
+	opt := cmd.Option("log.level")
+	if opt == nil || !reflect.DeepEqual(opt.ShortNames(), []string{"l"}) || !reflect.DeepEqual(opt.LongNames(), []string{"log.level"}) {
+		t.Errorf("Invalid option names for dotted option.  Option: %v", opt)
+	}
+	opt = cmd.Option("a/b")
+	if opt == nil || opt.ShortNames() != nil || !reflect.DeepEqual(opt.LongNames(), []string{"a/b"}) || opt.CanonicalName() != "a/b" {
+		t.Errorf("Invalid option names for slashed option.  Option: %v", opt)
+	}
+	expected := "  -l, --log.level=STRING    The log level\n"
+	if formatted := formatOption(cmd.Option("log.level")) + "\n"; formatted != expected {
+		t.Errorf("Invalid help output for dotted option.  Expected: %q, Received: %q", expected, formatted)
+	}
+
+	spec := &namespacedFieldSpec{}
+	cmd = New("test", spec)
+	_, _, err := cmd.Decode([]string{"sub", "--cloud.region=eu"})
+	if err != nil || spec.Sub.Region != "eu" {
+		t.Errorf("Invalid subcommand value for dotted option.  Region: %q, Error: %v", spec.Sub.Region, err)
+	}
+
+	spec = &namespacedFieldSpec{}
+	cmd = New("test", spec)
+	err = cmd.DecodeMap(map[string][]string{"log.level": {"error"}, "a/b": {"4"}})
+	if err != nil || spec.LogLevel != "error" || spec.Path != 4 {
+		t.Errorf("Invalid DecodeMap result for namespaced options.  Spec: %+v, Error: %v", spec, err)
+	}
+}
+
+type uniqueFieldSpec struct {
+	Includes []string `option:"i, include" unique:"true"`
+	Names    []string `option:"n, name" unique:"ignorecase"`
+}
+
+var uniqueFieldTests = []fieldTest{
+	{Args: []string{"-i", "a", "-i", "b", "-i", "a"}, Valid: true, Field: "Includes", Value: []string{"a", "b"}},
+	{Args: []string{"-i", "b", "-i", "A", "-i", "a", "-i", "b"}, Valid: true, Field: "Includes", Value: []string{"b", "A", "a"}},
+	{Args: []string{}, Valid: true, Field: "Names", Value: []string(nil)},
+	{Args: []string{"-n", "bob", "-n", "BOB", "--name", "Carol"}, Valid: true, Field: "Names", Value: []string{"bob", "Carol"}},
+}
+
+func TestUniqueFields(t *testing.T) {
+	for _, test := range uniqueFieldTests {
+		spec := &uniqueFieldSpec{}
+		runFieldTest(t, spec, test)
+	}
+}
+
+type baseFieldSpec struct {
+	Mask uint16 `option:"m, mask" base:"0" default:"0x0f"`
+	Perm int    `option:"p, perm" base:"8"`
+}
+
+var baseFieldTests = []fieldTest{
+	{Args: []string{}, Valid: true, Field: "Mask", Value: uint16(15)},
+	{Args: []string{"--mask", "0xFF00"}, Valid: true, Field: "Mask", Value: uint16(0xff00)},
+	{Args: []string{"-m", "0b11"}, Valid: true, Field: "Mask", Value: uint16(3)},
+	{Args: []string{"-m", "0x10000"}, Valid: false},
+	{Args: []string{"-p", "755"}, Valid: true, Field: "Perm", Value: 0755},
+	{Args: []string{"-p", "9"}, Valid: false},
+}
+
+func TestBaseFields(t *testing.T) {
+	for _, test := range baseFieldTests {
+		spec := &baseFieldSpec{}
+		runFieldTest(t, spec, test)
+	}
+}
+
+type byteSizeFieldSpec struct {
+	MaxSize int64 `option:"m, max-size" bytesize:"true" default:"1MiB"`
+}
+
+var byteSizeFieldTests = []fieldTest{
+	{Args: []string{}, Valid: true, Field: "MaxSize", Value: int64(1 << 20)},
+	{Args: []string{"--max-size", "10MB"}, Valid: true, Field: "MaxSize", Value: int64(10000000)},
+	{Args: []string{"-m", "10QB"}, Valid: false, Err: `value "10QB" has an unrecognized size unit "QB" (e.g. KB, MiB, GB)`},
+}
+
+func TestByteSizeFields(t *testing.T) {
+	for _, test := range byteSizeFieldTests {
+		spec := &byteSizeFieldSpec{}
+		runFieldTest(t, spec, test)
+	}
+}
+
+type arrayFieldSpec struct {
+	RGB   [3]int     `option:"rgb" default:"0,0,0"`
+	Point [2]float64 `option:"p, point"`
+}
+
+var arrayFieldTests = []fieldTest{
+	{Args: []string{}, Valid: true, Field: "RGB", Value: [3]int{0, 0, 0}},
+	{Args: []string{"--rgb", "255,128,0"}, Valid: true, Field: "RGB", Value: [3]int{255, 128, 0}},
+	{Args: []string{"--rgb=1,2"}, Valid: false, Err: `value "1,2" has 2 elements, but exactly 3 are required`},
+	{Args: []string{"-p", "1.5,-2"}, Valid: true, Field: "Point", Value: [2]float64{1.5, -2}},
+	{Args: []string{"-p", "1", "-p", "2,3"}, Valid: false},
+}
+
+func TestArrayFields(t *testing.T) {
+	for _, test := range arrayFieldTests {
+		spec := &arrayFieldSpec{}
+		runFieldTest(t, spec, test)
+	}
+}
+
+type caseFieldSpec struct {
+	Env   string `option:"e, env" case:"lower" default:"DEV"`
+	Level string `option:"l, level" case:"upper"`
+	Name  string `option:"n, name" case:"title"`
+	Raw   string `option:"r, raw" case:"none"`
+}
+
+var caseFieldTests = []fieldTest{
+	{Args: []string{}, Valid: true, Field: "Env", Value: "dev"},
+	{Args: []string{"--env", "PROD"}, Valid: true, Field: "Env", Value: "prod"},
+	{Args: []string{"-l", "debug"}, Valid: true, Field: "Level", Value: "DEBUG"},
+	{Args: []string{"-n", "jane  DOE"}, Valid: true, Field: "Name", Value: "Jane  Doe"},
+	{Args: []string{"-r", " MiXeD "}, Valid: true, Field: "Raw", Value: " MiXeD "},
+}
+
+func TestCaseFields(t *testing.T) {
+	for _, test := range caseFieldTests {
+		spec := &caseFieldSpec{}
+		runFieldTest(t, spec, test)
+	}
+}
+
+type groupingFieldSpec struct {
+	Count int     `option:"c, count" grouping:"," default:"1,000"`
+	Size  uint16  `option:"s, size" grouping:"."`
+	Ratio float32 `option:"r, ratio" grouping:"_"`
+}
+
+var groupingFieldTests = []fieldTest{
+	{Args: []string{}, Valid: true, Field: "Count", Value: 1000},
+	{Args: []string{"-c", "12,345"}, Valid: true, Field: "Count", Value: 12345},
+	{Args: []string{"--count=-2,000"}, Valid: true, Field: "Count", Value: -2000},
+	{Args: []string{"-c", "1,0,"}, Valid: false},
+	{Args: []string{"-s", "65.535"}, Valid: true, Field: "Size", Value: uint16(65535)},
+	{Args: []string{"-s", "65.536"}, Valid: false},
+	{Args: []string{"-r", "1_000.5"}, Valid: true, Field: "Ratio", Value: float32(1000.5)},
+}
+
+func TestGroupingFields(t *testing.T) {
+	for _, test := range groupingFieldTests {
+		spec := &groupingFieldSpec{}
+		runFieldTest(t, spec, test)
+	}
+}
+
+/*
+ * Test short option clusters
+ */
+
+func TestShortClusters(t *testing.T) {
+	tests := []struct {
+		Args       []string
+		Valid      bool
+		Err        string
+		Verbose    int
+		Quiet      bool
+		Name       string
+		Positional []string
+	}{
+		{Args: []string{"-vvvvv"}, Valid: true, Verbose: 5, Positional: []string{}},
+		{Args: []string{"-vqv"}, Valid: true, Verbose: 2, Quiet: true, Positional: []string{}},
+		{Args: []string{"-vnfoo", "bar"}, Valid: true, Verbose: 1, Name: "foo", Positional: []string{"bar"}},
+		{Args: []string{"-vn", "foo", "bar"}, Valid: true, Verbose: 1, Name: "foo", Positional: []string{"bar"}},
+		{Args: []string{"-vnqv"}, Valid: true, Verbose: 1, Name: "qv", Positional: []string{}},
+		{Args: []string{"-ün", "foo"}, Valid: true, Verbose: 1, Name: "foo", Positional: []string{}},
+		{Args: []string{"-qvq"}, Valid: false, Err: `option "--quiet" specified too many times`},
+		{Args: []string{"-nfoo", "-vnbar"}, Valid: false, Err: `option "--name" specified too many times`},
+		{Args: []string{"-vx"}, Valid: false, Err: "option '-x' is not recognized"},
+		{Args: []string{"-v-"}, Valid: false, Err: "option '--' is not recognized"},
+		{Args: []string{"-vn"}, Valid: false, Err: "option '--name' requires an argument"},
+	}
+	for _, test := range tests {
+		spec := &struct {
+			Verbose int    `flag:"v, ü, verbose"`
+			Quiet   bool   `flag:"q, quiet"`
+			Name    string `option:"n, name"`
+		}{}
+		cmd := New("test", spec)
+		_, positional, err := cmd.Decode(test.Args)
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received. Args: %q", test.Args)
+			} else if err.Error() != test.Err {
+				t.Errorf("Invalid error message.  Args: %q, Expected: %s, Received: %s", test.Args, test.Err, err.Error())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error. Args: %q, Error: %s", test.Args, err)
+			continue
+		}
+		if spec.Verbose != test.Verbose || spec.Quiet != test.Quiet || spec.Name != test.Name {
+			t.Errorf("Decoded values are incorrect. Args: %q, Expected: %d/%t/%q, Received: %d/%t/%q", test.Args, test.Verbose, test.Quiet, test.Name, spec.Verbose, spec.Quiet, spec.Name)
+		}
+		if !reflect.DeepEqual(positional, test.Positional) {
+			t.Errorf("Positional args are incorrect. Args: %q, Expected: %q, Received: %q", test.Args, test.Positional, positional)
+		}
+	}
+}
+
+func TestDecodeInto(t *testing.T) {
+	cmd := New("top", &topSpec{})
+	var positional []string
+	path, err := cmd.DecodeInto([]string{}, &positional)
+	if err != nil {
+		t.Errorf("Received unexpected error.  Error: %s", err)
+		return
+	}
+	if positional == nil || len(positional) != 0 || path.String() != "top" {
+		t.Errorf("Invalid decode results.  Expected an empty, non-nil slice and path \"top\", Received: %#v, %q", positional, path.String())
+	}
+
+	positional = make([]string, 0, 8)
+	buf := positional[:1]
+	path, err = cmd.DecodeInto([]string{"a", "mid", "b"}, &positional)
+	if err != nil {
+		t.Errorf("Received unexpected error.  Error: %s", err)
+		return
+	}
+	if !reflect.DeepEqual(positional, []string{"a", "mid", "b"}) || path.String() != "top" {
+		t.Errorf("Invalid decode results.  Received: %q, %q", positional, path.String())
+	}
+	if &buf[0] != &positional[0] {
+		t.Errorf("Expected DecodeInto to reuse the positional buffer")
+	}
+
+	path, err = cmd.DecodeInto([]string{"mid", "c"}, &positional)
+	if err != nil {
+		t.Errorf("Received unexpected error.  Error: %s", err)
+		return
+	}
+	if !reflect.DeepEqual(positional, []string{"c"}) || path.String() != "top mid" {
+		t.Errorf("Invalid decode results.  Received: %q, %q", positional, path.String())
+	}
+
+	_, err = cmd.DecodeInto([]string{"--bogus"}, &positional)
+	if err == nil {
+		t.Errorf("Expected error but none received")
+	}
+}
+
+func TestDecodeResult(t *testing.T) {
+	cmd := New("top", &topSpec{})
+	result, err := cmd.DecodeResult([]string{"-t", "1", "mid", "-hm2", "--midval=3", "foo"})
+	if err == nil {
+		t.Errorf("Expected error for a repeated option but none received")
+	}
+	if result != nil {
+		t.Errorf("Expected a nil result on error.  Received: %#v", result)
+	}
+
+	result, err = cmd.DecodeResult([]string{"-t", "1", "mid", "-hm2", "foo"})
+	if err != nil {
+		t.Errorf("Received unexpected error.  Error: %s", err)
+		return
+	}
+	expected := &Result{
+		Path: "top mid",
+		Options: []OptionResult{
+			{Name: "help", Count: 0, Raw: nil, Value: false},
+			{Name: "topval", Count: 1, Raw: []string{"1"}, Value: 1},
+			{Name: "midval", Count: 1, Raw: []string{"2"}, Value: 2},
+			{Name: "help", Count: 1, Raw: []string{""}, Value: true},
+		},
+		Positional: []string{"foo"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Invalid result.  Expected: %#v, Received: %#v", expected, result)
+	}
+}
+
+func TestOnRepeat(t *testing.T) {
+	tests := []struct {
+		Mode    RepeatMode
+		Args    []string
+		Valid   bool
+		Output  string
+		Verbose bool
+	}{
+		{Mode: RepeatError, Args: []string{"--output", "a"}, Valid: true, Output: "a"},
+		{Mode: RepeatError, Args: []string{"--output", "a", "-o", "b"}, Valid: false},
+		{Mode: RepeatKeepFirst, Args: []string{"--output", "a", "-o", "b", "-ob"}, Valid: true, Output: "a"},
+		{Mode: RepeatKeepLast, Args: []string{"--output", "a", "-o", "b"}, Valid: true, Output: "b"},
+		{Mode: RepeatKeepLast, Args: []string{"--output=a", "-ob", "--output", "c"}, Valid: true, Output: "c"},
+		{Mode: RepeatKeepFirst, Args: []string{"-v", "-vv"}, Valid: true, Verbose: true},
+		{Mode: RepeatKeepLast, Args: []string{"-vv", "--verbose"}, Valid: true, Verbose: true},
+	}
+	for _, test := range tests {
+		spec := &struct {
+			Output  string `option:"o, output"`
+			Verbose bool   `flag:"v, verbose"`
+		}{}
+		cmd := New("test", spec)
+		cmd.Option("output").OnRepeat = test.Mode
+		cmd.Option("verbose").OnRepeat = test.Mode
+		_, _, err := cmd.Decode(test.Args)
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received.  Mode: %d, Args: %q", test.Mode, test.Args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error.  Mode: %d, Args: %q, Error: %s", test.Mode, test.Args, err)
+			continue
+		}
+		if spec.Output != test.Output || spec.Verbose != test.Verbose {
+			t.Errorf("Invalid decoded values.  Mode: %d, Args: %q, Expected: %q %t, Received: %q %t", test.Mode, test.Args, test.Output, test.Verbose, spec.Output, spec.Verbose)
+		}
+	}
+}
+
+func TestDecodeMap(t *testing.T) {
+	type mapSpec struct {
+		Verbose  int      `flag:"v, verbose"`
+		Name     string   `option:"n, name" default:"default"`
+		Count    int      `option:"count"`
+		Includes []string `option:"I, include" maxvalues:"2"`
+	}
+	tests := []struct {
+		Values   map[string][]string
+		Valid    bool
+		Err      string
+		Expected mapSpec
+	}{
+		{Values: map[string][]string{}, Valid: true, Expected: mapSpec{Name: "default"}},
+		{Values: map[string][]string{"name": {"test"}, "count": {"2"}}, Valid: true, Expected: mapSpec{Name: "test", Count: 2}},
+		{Values: map[string][]string{"n": {"test"}, "I": {"a"}, "include": {"b"}}, Valid: true, Expected: mapSpec{Name: "test", Includes: []string{"a", "b"}}},
+		{Values: map[string][]string{"verbose": {"", ""}, "v": {""}}, Valid: true, Expected: mapSpec{Verbose: 3, Name: "default"}},
+		{Values: map[string][]string{"name": {}}, Valid: true, Expected: mapSpec{Name: "default"}},
+		{Values: map[string][]string{"bogus": {"a"}}, Valid: false, Err: "option '--bogus' is not recognized"},
+		{Values: map[string][]string{"x": {"a"}}, Valid: false, Err: "option '-x' is not recognized"},
+		{Values: map[string][]string{"name": {"a", "b"}}, Valid: false, Err: `option "--name" specified too many times`},
+		{Values: map[string][]string{"name": {"a"}, "n": {"b"}}, Valid: false, Err: `option "--name" specified too many times`},
+		{Values: map[string][]string{"verbose": {"true"}}, Valid: false, Err: "flag '--verbose' does not accept an argument"},
+		{Values: map[string][]string{"count": {"abc"}}, Valid: false},
+		{Values: map[string][]string{"include": {"a", "b", "c"}}, Valid: false, Err: "option '--include' accepts at most 2 values"},
+	}
+	for _, test := range tests {
+		spec := &mapSpec{}
+		err := New("test", spec).DecodeMap(test.Values)
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received. Values: %v", test.Values)
+			} else if test.Err != "" && err.Error() != test.Err {
+				t.Errorf("Invalid error message.  Values: %v, Expected: %s, Received: %s", test.Values, test.Err, err.Error())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error. Values: %v, Error: %s", test.Values, err)
+			continue
+		}
+		if !reflect.DeepEqual(*spec, test.Expected) {
+			t.Errorf("Decoded values are incorrect. Values: %v, Expected: %+v, Received: %+v", test.Values, test.Expected, *spec)
+		}
+	}
+}
+
+func TestPointerCommandFields(t *testing.T) {
+	type pointerSpec struct {
+		Top    int      `option:"t"`
+		Mid    *midSpec `command:"mid"`
+		Shared *midSpec `command:"shared"`
+	}
+	shared := &midSpec{Mid: 5}
+	spec := &pointerSpec{Shared: shared}
+	cmd := New("top", spec)
+	if spec.Mid == nil {
+		t.Errorf("Expected New() to allocate nil pointer command fields")
+		return
+	}
+	if spec.Shared != shared {
+		t.Errorf("Expected New() to keep non-nil pointer command fields")
+	}
+
+	path, _, err := cmd.Decode([]string{"-t", "1", "mid", "-m", "2", "bottom", "-b", "3"})
+	if err != nil {
+		t.Errorf("Received unexpected error.  Error: %s", err)
+		return
+	}
+	if path.String() != "top mid bottom" || spec.Top != 1 || spec.Mid.Mid != 2 || spec.Mid.BottomSpec.Bottom != 3 {
+		t.Errorf("Decoded values are incorrect.  Path: %s, Top: %d, Mid: %d, Bottom: %d", path, spec.Top, spec.Mid.Mid, spec.Mid.BottomSpec.Bottom)
+	}
+
+	_, _, err = cmd.Decode([]string{"shared", "-m", "6"})
+	if err != nil {
+		t.Errorf("Received unexpected error.  Error: %s", err)
+		return
+	}
+	if shared.Mid != 6 {
+		t.Errorf("Expected shared spec to be decoded.  Expected: %d, Received: %d", 6, shared.Mid)
+	}
+}
+
+func TestConfigOptions(t *testing.T) {
+	warnings := bytes.NewBuffer(nil)
+	normalize := strings.ToLower
+	transform := func(s string) (string, error) { return strings.ToUpper(s), nil }
+	cmd := New("top", &topSpec{},
+		WithStrictDefaults(),
+		WithWarnings(warnings),
+		WithTerminator("::"),
+		WithGlobalsBeforeSubcommand(),
+		WithNormalizeName(normalize),
+		WithPositionalTransform(transform),
+	)
+	if !cmd.StrictDefaults || cmd.Warnings != warnings || cmd.Terminator != "::" || cmd.DisableTerminator || !cmd.GlobalsBeforeSubcommand || cmd.NormalizeName == nil || cmd.PositionalTransform == nil {
+		t.Errorf("Config options were not applied.  Received: %#v", cmd)
+	}
+	path, positional, err := cmd.Decode([]string{"--TOPVAL", "1", "mid", "foo", "::", "-m"})
+	if err != nil {
+		t.Errorf("Received unexpected error.  Error: %s", err)
+		return
+	}
+	if path.String() != "top mid" || !reflect.DeepEqual(positional, []string{"FOO", "-M"}) {
+		t.Errorf("Invalid decode results.  Received: %q, %q", path.String(), positional)
+	}
+
+	cmd = New("top", &topSpec{}, WithoutTerminator())
+	if !cmd.DisableTerminator {
+		t.Errorf("Expected WithoutTerminator to set DisableTerminator")
+	}
+	cmd = New("top", &topSpec{})
+	if cmd.StrictDefaults || cmd.Warnings != nil || cmd.Terminator != "" || cmd.GlobalsBeforeSubcommand || cmd.NormalizeName != nil {
+		t.Errorf("Expected New without config options to leave defaults")
+	}
+}
+
+func TestAutoHelp(t *testing.T) {
+	type autoHelpSpec struct {
+		Verbose bool `flag:"v" description:"Verbose output"`
+		Count   int  `option:"c" description:"A count" minvalues:"1"`
+		Sub     struct {
+			Host   string `option:"h, host" description:"The host"`
+			Nested struct {
+				Help bool `flag:"help" description:"Manual help"`
+			} `command:"nested" description:"A nested command"`
+		} `command:"sub" description:"A subcommand"`
+	}
+	tests := []struct {
+		Args  []string
+		Path  string
+		Help  bool
+		Valid bool
+	}{
+		{Args: []string{"-c", "1"}, Path: "test", Valid: true},
+		{Args: []string{"-h"}, Path: "test", Help: true},
+		{Args: []string{"--help", "--bogus"}, Path: "test", Help: true},
+		{Args: []string{"-vh", "sub"}, Path: "test sub", Help: true},
+		{Args: []string{"sub", "--help"}, Path: "test sub", Help: true},
+		{Args: []string{"sub", "-h", "localhost"}, Path: "test sub", Valid: false},
+		{Args: []string{"sub", "nested", "--help"}, Path: "test sub nested", Valid: false},
+		{Args: []string{"--", "-h"}, Path: "test", Valid: false},
+	}
+	for _, test := range tests {
+		cmd := New("test", &autoHelpSpec{}, WithAutoHelp())
+		path, _, err := cmd.Decode(test.Args)
+		if test.Help {
+			if err != ErrHelpRequested {
+				t.Errorf("Expected ErrHelpRequested.  Args: %q, Received: %v", test.Args, err)
+			}
+		} else if test.Valid && err != nil {
+			t.Errorf("Received unexpected error.  Args: %q, Error: %s", test.Args, err)
+		} else if !test.Valid && err == ErrHelpRequested {
+			t.Errorf("Received unexpected ErrHelpRequested.  Args: %q", test.Args)
+		}
+		if path.String() != test.Path {
+			t.Errorf("Invalid path.  Args: %q, Expected: %q, Received: %q", test.Args, test.Path, path.String())
+		}
+	}
+
+	cmd := New("test", &autoHelpSpec{}, WithAutoHelp())
+	expected := []string{"-h, --help", "--help", "--help"}
+	for i, c := range []*Command{cmd, cmd.Subcommand("sub"), cmd.Subcommand("sub").Subcommand("nested")} {
+		opt := c.Help.OptionGroups[0].Options[0]
+		if formatOptionNames(opt, ", ") != expected[i] {
+			t.Errorf("Invalid help flag.  Command: %s, Expected: %q, Received: %q", c.Name, expected[i], formatOptionNames(opt, ", "))
+		}
+	}
+	if cmd.Subcommand("sub").Subcommand("nested").Option("help").autoHelp {
+		t.Errorf("Expected WithAutoHelp to leave manual help flags unchanged")
+	}
+
+	cmd = New("test", &struct{}{}, WithAutoHelp())
+	expectedHelp := "Usage: test [OPTION]... [ARG]...\n\nAvailable Options:\n  -h, --help                Display this help message and exit\n"
+	if cmd.HelpString() != expectedHelp {
+		t.Errorf("Invalid help output.  Expected: %q, Received: %q", expectedHelp, cmd.HelpString())
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	type normalizeSpec struct {
+		LogLevel string `option:"log-level"`
+		DryRun   bool   `flag:"n, dry-run"`
+		Sub      struct {
+			MaxDepth int `option:"max-depth"`
+		} `command:"sub"`
+	}
+	normalize := func(name string) string {
+		return strings.ToLower(strings.Replace(name, "_", "-", -1))
+	}
+	tests := []struct {
+		Args     []string
+		Valid    bool
+		LogLevel string
+		DryRun   bool
+		MaxDepth int
+	}{
+		{Args: []string{"--log-level", "debug"}, Valid: true, LogLevel: "debug"},
+		{Args: []string{"--log_level=debug"}, Valid: true, LogLevel: "debug"},
+		{Args: []string{"--LOG_LEVEL", "debug", "--Dry_Run"}, Valid: true, LogLevel: "debug", DryRun: true},
+		{Args: []string{"-N"}, Valid: true, DryRun: true},
+		{Args: []string{"sub", "--max_depth", "3", "--log_level", "info"}, Valid: true, LogLevel: "info", MaxDepth: 3},
+		{Args: []string{"--log.level", "debug"}, Valid: false},
+	}
+	for _, test := range tests {
+		spec := &normalizeSpec{}
+		cmd := New("test", spec)
+		cmd.NormalizeName = normalize
+		_, _, err := cmd.Decode(test.Args)
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received.  Args: %q", test.Args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error.  Args: %q, Error: %s", test.Args, err)
+			continue
+		}
+		if spec.LogLevel != test.LogLevel || spec.DryRun != test.DryRun || spec.Sub.MaxDepth != test.MaxDepth {
+			t.Errorf("Invalid decoded values.  Args: %q, Expected: %q %t %d, Received: %q %t %d", test.Args, test.LogLevel, test.DryRun, test.MaxDepth, spec.LogLevel, spec.DryRun, spec.Sub.MaxDepth)
+		}
+	}
+
+	spec := &normalizeSpec{}
+	cmd := New("test", spec)
+	cmd.NormalizeName = normalize
+	err := cmd.DecodeMap(map[string][]string{"log_level": {"warn"}})
+	if err != nil || spec.LogLevel != "warn" {
+		t.Errorf("Expected DecodeMap to normalize names.  Error: %v, Received: %q", err, spec.LogLevel)
+	}
+	if cmd.Option("log_level") != nil {
+		t.Errorf("Expected Command.Option() to match names exactly")
+	}
+
+	cmd = New("test", &struct {
+		LogLevel string `option:"log-level, log_level"`
+	}{})
+	cmd.NormalizeName = normalize
+	_, _, err = cmd.Decode([]string{"--log_level", "warn"})
+	if err != nil {
+		t.Errorf("Expected names of the same option to be allowed to normalize equally.  Error: %s", err)
+	}
+
+	cmd = New("test", &struct {
+		Sub struct {
+			LogLevel  string `option:"log-level"`
+			LogLevel2 string `option:"log_level"`
+		} `command:"sub"`
+	}{})
+	cmd.NormalizeName = normalize
+	defer func() {
+		r := recover()
+		if r != nil {
+			switch r.(type) {
+			case commandError, optionError:
+				// Intentionally blank
+			default:
+				panic(r)
+			}
+		}
+	}()
+	cmd.Decode([]string{})
+	t.Errorf("Expected a panic decoding option names that collide after normalization, but this didn't happen")
+}
+
+func TestGlobalsBeforeSubcommand(t *testing.T) {
+	tests := []commandFieldTest{
+		{Args: []string{"-t", "1", "mid", "-m", "2"}, Valid: true, Path: "top mid", Positional: []string{}, Field: "Top", Value: 1},
+		{Args: []string{"-t", "1", "mid", "-m", "2", "bottom", "-b", "3"}, Valid: true, Path: "top mid bottom", Positional: []string{}, Field: "Top", Value: 1},
+		{Args: []string{"-h", "mid", "-h"}, Valid: true, Path: "top mid", Positional: []string{}, Field: "HelpFlag", Value: true},
+		{Args: []string{"mid", "-t", "1"}, Valid: false, Err: "option '-t' is not recognized"},
+		{Args: []string{"mid", "--topval", "1"}, Valid: false, Err: "option '--topval' is not recognized"},
+		{Args: []string{"mid", "bottom", "-m", "2"}, Valid: false, Err: "option '-m' is not recognized"},
+		{Args: []string{"mid", "-m", "2", "bottom", "-t", "1"}, Valid: false, Err: "option '-t' is not recognized"},
+	}
+	for _, test := range tests {
+		spec := &topSpec{}
+		cmd := New("top", spec)
+		cmd.GlobalsBeforeSubcommand = true
+		path, positional, err := cmd.Decode(test.Args)
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received. Args: %q", test.Args)
+			} else if err.Error() != test.Err {
+				t.Errorf("Invalid error message.  Args: %q, Expected: %s, Received: %s", test.Args, test.Err, err.Error())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error. Args: %q, Error: %s", test.Args, err)
+			continue
+		}
+		if path.String() != test.Path {
+			t.Errorf("Invalid path.  Args: %q, Expected: %q, Received: %q", test.Args, test.Path, path.String())
+		}
+		if !reflect.DeepEqual(positional, test.Positional) {
+			t.Errorf("Invalid positional args.  Args: %q, Expected: %q, Received: %q", test.Args, test.Positional, positional)
+		}
+		equal, fieldval := CompareField(spec, test.Field, test.Value)
+		if !equal {
+			t.Errorf("Decoded value is incorrect. Field: %s, Args: %q, Expected: %#v, Received: %#v", test.Field, test.Args, test.Value, fieldval)
+		}
+	}
+}
+
+/*
+ * Test custom terminators
+ */
+
+func TestTerminator(t *testing.T) {
+	tests := []struct {
+		Terminator string
+		Disable    bool
+		Args       []string
+		Valid      bool
+		Path       string
+		Positional []string
+		Top        int
+	}{
+		{Args: []string{"-t", "1", "--", "-t", "2"}, Valid: true, Path: "top", Positional: []string{"-t", "2"}, Top: 1},
+		{Terminator: "::", Args: []string{"-t", "1", "::", "-t", "2", "::"}, Valid: true, Path: "top", Positional: []string{"-t", "2", "::"}, Top: 1},
+		{Terminator: "::", Args: []string{"::", "mid"}, Valid: true, Path: "top", Positional: []string{"mid"}},
+		{Terminator: "::", Args: []string{"mid", "::", "-m", "2"}, Valid: true, Path: "top mid", Positional: []string{"-m", "2"}},
+		{Terminator: "::", Args: []string{"-t", "1", "--"}, Valid: false},
+		{Terminator: "::", Args: []string{"-", "::", "-"}, Valid: true, Path: "top", Positional: []string{"-", "-"}},
+		{Terminator: "-", Args: []string{"-", "-t", "1"}, Valid: true, Path: "top", Positional: []string{"-t", "1"}},
+		{Disable: true, Args: []string{"-t", "1", "--"}, Valid: false},
+		{Disable: true, Args: []string{"foo", "-t", "1"}, Valid: true, Path: "top", Positional: []string{"foo"}, Top: 1},
+		{Terminator: "::", Disable: true, Args: []string{"::", "-t", "1"}, Valid: true, Path: "top", Positional: []string{"::"}, Top: 1},
+	}
+	for _, test := range tests {
+		spec := &topSpec{}
+		cmd := New("top", spec)
+		cmd.Terminator = test.Terminator
+		cmd.DisableTerminator = test.Disable
+		path, positional, err := cmd.Decode(test.Args)
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received. Terminator: %q, Args: %q", test.Terminator, test.Args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error. Terminator: %q, Args: %q, Error: %s", test.Terminator, test.Args, err)
+			continue
+		}
+		if path.String() != test.Path {
+			t.Errorf("Invalid path.  Terminator: %q, Args: %q, Expected: %q, Received: %q", test.Terminator, test.Args, test.Path, path.String())
+		}
+		if !reflect.DeepEqual(positional, test.Positional) {
+			t.Errorf("Invalid positional args.  Terminator: %q, Args: %q, Expected: %q, Received: %q", test.Terminator, test.Args, test.Positional, positional)
+		}
+		if spec.Top != test.Top {
+			t.Errorf("Invalid option value.  Terminator: %q, Args: %q, Expected: %d, Received: %d", test.Terminator, test.Args, test.Top, spec.Top)
+		}
+	}
+}
+
+// stopDecoder is a flag decoder that stops parsing when decoded.
+type stopDecoder struct {
+	value *bool
+}
+
+func (d stopDecoder) Decode(arg string) error {
+	*d.value = true
+	return ErrStopParsing
+}
+
+func TestStopParsing(t *testing.T) {
+	tests := []struct {
+		Args       []string
+		Stopped    bool
+		Err        string
+		Path       string
+		Positional []string
+		Top        int
+	}{
+		{Args: []string{"-t", "1", "foo"}, Path: "top", Positional: []string{"foo"}, Top: 1},
+		{Args: []string{"-t", "1", "foo", "--version", "-t", "2", "bar"}, Stopped: true, Path: "top", Positional: []string{"foo"}, Top: 1},
+		{Args: []string{"--version", "--bogus"}, Stopped: true, Path: "top", Positional: []string{}},
+		{Args: []string{"-Vt", "bogus"}, Stopped: true, Path: "top", Positional: []string{}},
+		{Args: []string{"mid", "-V", "bottom"}, Stopped: true, Path: "top mid", Positional: []string{}},
+		{Args: []string{"--bogus", "--version"}, Err: "option '--bogus' is not recognized"},
+		{Args: []string{"--", "--version"}, Path: "top", Positional: []string{"--version"}},
+	}
+	for _, test := range tests {
+		var version bool
+		spec := &topSpec{}
+		cmd := New("top", spec)
+		opt := &Option{Names: []string{"V", "version"}, Flag: true, Decoder: stopDecoder{&version}}
+		cmd.Options = append(cmd.Options, opt)
+		path, positional, err := cmd.Decode(test.Args)
+		if test.Err != "" {
+			if err == nil || err.Error() != test.Err {
+				t.Errorf("Invalid error.  Args: %q, Expected: %q, Received: %v", test.Args, test.Err, err)
+			}
+			continue
+		}
+		if test.Stopped {
+			if err != ErrStopParsing {
+				t.Errorf("Expected ErrStopParsing.  Args: %q, Received: %v", test.Args, err)
+				continue
+			}
+		} else if err != nil {
+			t.Errorf("Received unexpected error.  Args: %q, Error: %s", test.Args, err)
+			continue
+		}
+		if version != test.Stopped {
+			t.Errorf("Invalid version flag value.  Args: %q, Expected: %t, Received: %t", test.Args, test.Stopped, version)
+		}
+		if path.String() != test.Path {
+			t.Errorf("Invalid path.  Args: %q, Expected: %q, Received: %q", test.Args, test.Path, path.String())
+		}
+		if !reflect.DeepEqual(positional, test.Positional) {
+			t.Errorf("Invalid positional args.  Args: %q, Expected: %q, Received: %q", test.Args, test.Positional, positional)
+		}
+		if spec.Top != test.Top {
+			t.Errorf("Invalid option value.  Args: %q, Expected: %d, Received: %d", test.Args, test.Top, spec.Top)
+		}
+	}
+
+	// Constraints that need every argument are skipped, and the stopping
+	// option is counted
+	var version bool
+	cmd := New("top", &struct {
+		Name string `option:"name" description:"A required option"`
+	}{})
+	cmd.Option("name").MinValues = 1
+	cmd.Options = append(cmd.Options, &Option{Names: []string{"version"}, Flag: true, Decoder: stopDecoder{&version}})
+	result, err := cmd.DecodeResult([]string{"--version"})
+	if err != ErrStopParsing || result == nil {
+		t.Fatalf("Expected ErrStopParsing with a result.  Result: %v, Error: %v", result, err)
+	}
+	if len(result.Options) != 2 || result.Options[1].Count != 1 {
+		t.Errorf("Expected the version flag to be counted.  Options: %+v", result.Options)
+	}
+}
+
+func TestDisableShortClustering(t *testing.T) {
+	type clusterSpec struct {
+		All     bool   `flag:"a, all"`
+		Verbose int    `flag:"v"`
+		Name    string `option:"n, name"`
+	}
+	tests := []struct {
+		Args    []string
+		Valid   bool
+		Err     string
+		All     bool
+		Verbose int
+		Name    string
+	}{
+		{Args: []string{"-a", "-v", "-v"}, Valid: true, All: true, Verbose: 2},
+		{Args: []string{"-n", "foo"}, Valid: true, Name: "foo"},
+		{Args: []string{"-nfoo"}, Valid: true, Name: "foo"},
+		{Args: []string{"-a", "--name", "-v"}, Valid: true, All: true, Name: "-v"},
+		{Args: []string{"-av"}, Valid: false, Err: "option '-av' is not recognized; short flags can't be combined, so specify '-a' separately"},
+		{Args: []string{"-vv"}, Valid: false, Err: "option '-vv' is not recognized; short flags can't be combined, so specify '-v' separately"},
+		{Args: []string{"-anfoo"}, Valid: false, Err: "option '-anfoo' is not recognized; short flags can't be combined, so specify '-a' separately"},
+		{Args: []string{"-v3"}, Valid: false, Err: "flag '-v' does not take a value; did you mean to repeat it as -vvv?"},
+		{Args: []string{"-all"}, Valid: false, Err: "option '-all' is not recognized; short flags can't be combined, so specify '-a' separately"},
+		{Args: []string{"-xyz"}, Valid: false, Err: "option '-xyz' is not recognized"},
+	}
+	for _, test := range tests {
+		spec := &clusterSpec{}
+		cmd := New("test", spec, WithoutShortClustering())
+		_, _, err := cmd.Decode(test.Args)
+		if !test.Valid {
+			if err == nil || err.Error() != test.Err {
+				t.Errorf("Invalid error.  Args: %q, Expected: %q, Received: %v", test.Args, test.Err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error.  Args: %q, Error: %s", test.Args, err)
+			continue
+		}
+		if spec.All != test.All || spec.Verbose != test.Verbose || spec.Name != test.Name {
+			t.Errorf("Invalid values.  Args: %q, Expected: %v/%d/%q, Received: %v/%d/%q", test.Args, test.All, test.Verbose, test.Name, spec.All, spec.Verbose, spec.Name)
+		}
+	}
+
+	// Clustering is enabled by default
+	spec := &clusterSpec{}
+	_, _, err := New("test", spec).Decode([]string{"-avvnfoo"})
+	if err != nil || !spec.All || spec.Verbose != 2 || spec.Name != "foo" {
+		t.Errorf("Invalid clustered decode.  Spec: %+v, Error: %v", spec, err)
+	}
+}
+
+func TestSubcommandTerminator(t *testing.T) {
+	tests := []struct {
+		Terminator string
+		Args       []string
+		Valid      bool
+		Path       string
+		Positional []string
+		Top        int
+	}{
+		{Args: []string{"++", "mid"}, Valid: true, Path: "top", Positional: []string{"++", "mid"}},
+		{Terminator: "++", Args: []string{"++", "mid"}, Valid: true, Path: "top", Positional: []string{"mid"}},
+		{Terminator: "++", Args: []string{"++", "-t", "1", "mid"}, Valid: true, Path: "top", Positional: []string{"mid"}, Top: 1},
+		{Terminator: "++", Args: []string{"mid", "++", "bottom", "-t", "2"}, Valid: true, Path: "top mid", Positional: []string{"bottom"}, Top: 2},
+		{Terminator: "++", Args: []string{"mid", "++", "-b", "1"}, Valid: false},
+		{Terminator: "++", Args: []string{"foo", "++", "mid"}, Valid: true, Path: "top", Positional: []string{"foo", "++", "mid"}},
+		{Terminator: "++", Args: []string{"++", "++"}, Valid: true, Path: "top", Positional: []string{"++"}},
+		{Terminator: "++", Args: []string{"--", "++", "mid"}, Valid: true, Path: "top", Positional: []string{"++", "mid"}},
+		{Terminator: "++", Args: []string{"++", "--", "-t", "1"}, Valid: true, Path: "top", Positional: []string{"-t", "1"}},
+	}
+	for _, test := range tests {
+		spec := &topSpec{}
+		cmd := New("top", spec, WithSubcommandTerminator(test.Terminator))
+		path, positional, err := cmd.Decode(test.Args)
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received. Terminator: %q, Args: %q", test.Terminator, test.Args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error. Terminator: %q, Args: %q, Error: %s", test.Terminator, test.Args, err)
+			continue
+		}
+		if path.String() != test.Path {
+			t.Errorf("Invalid path.  Terminator: %q, Args: %q, Expected: %q, Received: %q", test.Terminator, test.Args, test.Path, path.String())
+		}
+		if !reflect.DeepEqual(positional, test.Positional) {
+			t.Errorf("Invalid positional args.  Terminator: %q, Args: %q, Expected: %q, Received: %q", test.Terminator, test.Args, test.Positional, positional)
+		}
+		if spec.Top != test.Top {
+			t.Errorf("Invalid option value.  Terminator: %q, Args: %q, Expected: %d, Received: %d", test.Terminator, test.Args, test.Top, spec.Top)
+		}
+	}
+
+	// Unknown commands aren't dispatched after the SubcommandTerminator
+	cmd := New("top", &topSpec{}, WithSubcommandTerminator("++"))
+	cmd.UnknownCommandHandler = func(name string, args []string) error {
+		return fmt.Errorf("unexpected call to UnknownCommandHandler")
+	}
+	_, positional, err := cmd.Decode([]string{"++", "foo"})
+	if err != nil || !reflect.DeepEqual(positional, []string{"foo"}) {
+		t.Errorf("Invalid decode after SubcommandTerminator.  Positional: %q, Error: %v", positional, err)
+	}
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Errorf("Expected a panic for a SubcommandTerminator matching the Terminator")
+		}
+	}()
+	New("top", &topSpec{}, WithSubcommandTerminator("--"))
+}
+
+func TestUnknownCommandHandler(t *testing.T) {
+	tests := []struct {
+		Args       []string
+		Called     bool
+		Name       string
+		Rest       []string
+		Path       string
+		Positional []string
+	}{
+		{Args: []string{"foo", "-x", "bar"}, Called: true, Name: "foo", Rest: []string{"foo", "-x", "bar"}, Path: "top", Positional: []string{}},
+		{Args: []string{"-t", "1", "foo"}, Called: true, Name: "foo", Rest: []string{"foo"}, Path: "top", Positional: []string{}},
+		{Args: []string{"mid", "foo"}, Called: true, Name: "foo", Rest: []string{"foo"}, Path: "top mid", Positional: []string{}},
+		{Args: []string{"mid", "bottom", "foo"}, Called: false, Path: "top mid bottom", Positional: []string{"foo"}},
+		{Args: []string{"--", "foo"}, Called: false, Path: "top", Positional: []string{"foo"}},
+		{Args: []string{"-", "foo"}, Called: false, Path: "top", Positional: []string{"-", "foo"}},
+		{Args: []string{"mid", "-m", "2"}, Called: false, Path: "top mid", Positional: []string{}},
+	}
+	for _, test := range tests {
+		cmd := New("top", &topSpec{})
+		var called bool
+		var name string
+		var rest []string
+		handler := func(n string, args []string) error {
+			called, name, rest = true, n, args
+			return fmt.Errorf("external command %s", n)
+		}
+		cmd.UnknownCommandHandler = handler
+		cmd.Subcommand("mid").UnknownCommandHandler = handler
+		cmd.Subcommand("mid").Subcommand("bottom").UnknownCommandHandler = handler
+
+		path, positional, err := cmd.Decode(test.Args)
+		if called != test.Called {
+			t.Errorf("Invalid handler invocation.  Args: %q, Expected: %t, Received: %t", test.Args, test.Called, called)
+			continue
+		}
+		if test.Called {
+			if err == nil || err.Error() != "external command "+test.Name {
+				t.Errorf("Expected handler error.  Args: %q, Received: %v", test.Args, err)
+			}
+			if name != test.Name || !reflect.DeepEqual(rest, test.Rest) {
+				t.Errorf("Invalid handler args.  Args: %q, Expected: %q %q, Received: %q %q", test.Args, test.Name, test.Rest, name, rest)
+			}
+		} else if err != nil {
+			t.Errorf("Received unexpected error.  Args: %q, Error: %s", test.Args, err)
+			continue
+		}
+		if path.String() != test.Path {
+			t.Errorf("Invalid path.  Args: %q, Expected: %q, Received: %q", test.Args, test.Path, path.String())
+		}
+		if !reflect.DeepEqual(positional, test.Positional) {
+			t.Errorf("Invalid positional args.  Args: %q, Expected: %q, Received: %q", test.Args, test.Positional, positional)
+		}
+	}
+}
+
+func TestPositionalTransform(t *testing.T) {
+	transform := func(arg string) (string, error) {
+		if arg == "bad" {
+			return "", fmt.Errorf("invalid argument %q", arg)
+		}
+		return strings.Replace(arg, "~", "/home/user", 1), nil
+	}
+	tests := []struct {
+		Args       []string
+		Valid      bool
+		Positional []string
+	}{
+		{Args: []string{}, Valid: true, Positional: []string{}},
+		{Args: []string{"~/foo", "bar"}, Valid: true, Positional: []string{"/home/user/foo", "bar"}},
+		{Args: []string{"mid", "-m", "2", "~"}, Valid: true, Positional: []string{"/home/user"}},
+		{Args: []string{"--", "-t", "~"}, Valid: true, Positional: []string{"-t", "/home/user"}},
+		{Args: []string{"foo", "bad"}, Valid: false},
+	}
+	for _, test := range tests {
+		cmd := New("top", &topSpec{})
+		cmd.PositionalTransform = transform
+		_, positional, err := cmd.Decode(test.Args)
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received.  Args: %q", test.Args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error.  Args: %q, Error: %s", test.Args, err)
+			continue
+		}
+		if !reflect.DeepEqual(positional, test.Positional) {
+			t.Errorf("Invalid positional args.  Args: %q, Expected: %q, Received: %q", test.Args, test.Positional, positional)
+		}
+	}
+}
+
+func TestFlagsAndValueOptions(t *testing.T) {
+	cmd := New("test", &struct {
+		Verbose int      `flag:"v, verbose"`
+		Name    string   `option:"n, name"`
+		Help    bool     `flag:"h, help"`
+		Files   []string `option:"f, file"`
+		Sub     struct {
+			Depth int `option:"d"`
+		} `command:"sub"`
+	}{})
+	var flags, options []string
+	for _, o := range cmd.Flags() {
+		flags = append(flags, o.CanonicalName())
+	}
+	for _, o := range cmd.ValueOptions() {
+		options = append(options, o.CanonicalName())
+	}
+	if !reflect.DeepEqual(flags, []string{"verbose", "help"}) {
+		t.Errorf("Invalid flags.  Received: %q", flags)
+	}
+	if !reflect.DeepEqual(options, []string{"name", "file"}) {
+		t.Errorf("Invalid value options.  Received: %q", options)
+	}
+	sub := cmd.Subcommand("sub")
+	if len(sub.Flags()) != 0 || len(sub.ValueOptions()) != 1 {
+		t.Errorf("Invalid subcommand options.  Flags: %v, Value options: %v", sub.Flags(), sub.ValueOptions())
+	}
+}
+
+func TestPresetFieldValues(t *testing.T) {
+	type presetSpec struct {
+		Name    string            `option:"n, name"`
+		Port    int               `option:"p, port"`
+		Verbose bool              `flag:"v, verbose"`
+		Level   int               `flag:"l, level"`
+		Tags    []string          `option:"t, tag"`
+		Labels  map[string]string `option:"label"`
+		Sub     struct {
+			Depth int `option:"d, depth"`
+		} `command:"sub"`
+	}
+	preset := func() *presetSpec {
+		spec := &presetSpec{Name: "preset", Port: 8080, Verbose: true, Level: 2, Tags: []string{"a"}, Labels: map[string]string{"k": "v"}}
+		spec.Sub.Depth = 3
+		return spec
+	}
+
+	spec := preset()
+	cmd := New("test", spec)
+	_, _, err := cmd.Decode([]string{"sub"})
+	if err != nil {
+		t.Errorf("Received unexpected error.  Error: %s", err)
+	}
+	if !reflect.DeepEqual(spec, preset()) {
+		t.Errorf("Pre-set field values were modified.  Expected: %+v, Received: %+v", preset(), spec)
+	}
+
+	spec = preset()
+	cmd = New("test", spec)
+	_, _, err = cmd.Decode([]string{"-n", "given", "-p", "80", "-l", "-t", "b", "--label", "x=y", "sub", "-d", "4"})
+	if err != nil {
+		t.Errorf("Received unexpected error.  Error: %s", err)
+	}
+	expected := preset()
+	expected.Name = "given"
+	expected.Port = 80
+	expected.Level = 3
+	expected.Tags = []string{"a", "b"}
+	expected.Labels["x"] = "y"
+	expected.Sub.Depth = 4
+	if !reflect.DeepEqual(spec, expected) {
+		t.Errorf("Invalid decoded values.  Expected: %+v, Received: %+v", expected, spec)
+	}
+}
+
+func TestValueSource(t *testing.T) {
+	type sourceSpec struct {
+		Name   string `option:"n, name" default:"default"`
+		Region string `option:"r, region" env:"WRIT_SOURCE_TEST_REGION" default:"us"`
+		Zone   string `option:"z, zone" env:"WRIT_SOURCE_TEST_ZONE"`
+		Port   int    `option:"p, port"`
+		Level  string `option:"level"`
+		Sub    struct {
+			Depth int `option:"d, depth" default:"1"`
+		} `command:"sub"`
+	}
+	os.Setenv("WRIT_SOURCE_TEST_REGION", "eu")
+	defer os.Unsetenv("WRIT_SOURCE_TEST_REGION")
+
+	dir, err := ioutil.TempDir("", "writ-sources")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir.  Error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeConfig(t, dir, `{"level": "debug"}`)
+
+	cmd := New("test", &sourceSpec{})
+	cmd.TrackSources = true
+	err = cmd.LoadDefaultsFromFile(path)
+	if err != nil {
+		t.Fatalf("Received unexpected error loading config.  Error: %s", err)
+	}
+	_, _, err = cmd.Decode([]string{"-p", "80", "sub"})
+	if err != nil {
+		t.Errorf("Received unexpected error.  Error: %s", err)
+	}
+	expected := map[string]string{
+		"name":   SourceDefault,
+		"region": SourceEnv,
+		"zone":   "",
+		"port":   SourceArg,
+		"level":  SourceConfig,
+	}
+	for name, source := range expected {
+		if cmd.ValueSource(name) != source {
+			t.Errorf("Invalid value source.  Option: %s, Expected: %q, Received: %q", name, source, cmd.ValueSource(name))
+		}
+	}
+	if cmd.Subcommand("sub").ValueSource("depth") != SourceDefault {
+		t.Errorf("Invalid subcommand value source.  Received: %q", cmd.Subcommand("sub").ValueSource("depth"))
+	}
+
+	// Sources are reset by each decode
+	_, _, err = cmd.Decode([]string{"--name", "given", "sub", "-d", "2"})
+	if err != nil {
+		t.Errorf("Received unexpected error.  Error: %s", err)
+	}
+	if cmd.ValueSource("name") != SourceArg || cmd.ValueSource("port") != "" || cmd.Subcommand("sub").ValueSource("depth") != SourceArg {
+		t.Errorf("Value sources weren't reset.  Name: %q, Port: %q, Depth: %q", cmd.ValueSource("name"), cmd.ValueSource("port"), cmd.Subcommand("sub").ValueSource("depth"))
+	}
+
+	cmd.TrackSources = false
+	_, _, err = cmd.Decode([]string{"-p", "80"})
+	if err != nil {
+		t.Errorf("Received unexpected error.  Error: %s", err)
+	}
+	if cmd.ValueSource("name") != "" || cmd.ValueSource("port") != "" {
+		t.Errorf("Value sources recorded without TrackSources.  Name: %q, Port: %q", cmd.ValueSource("name"), cmd.ValueSource("port"))
+	}
+}
+
+func TestWarnOnOptionLikeValues(t *testing.T) {
+	tests := []struct {
+		Args    []string
+		Enabled bool
+		Warning string
+	}{
+		{Args: []string{"--topval", "--help"}, Enabled: true, Warning: "Warning: option '--topval' consumed \"--help\" as its value; did you forget to specify a value?\n"},
+		{Args: []string{"-t", "-h"}, Enabled: true, Warning: "Warning: option '--topval' consumed \"-h\" as its value; did you forget to specify a value?\n"},
+		{Args: []string{"mid", "-m", "--topval=2"}, Enabled: true, Warning: "Warning: option '--midval' consumed \"--topval=2\" as its value; did you forget to specify a value?\n"},
+		{Args: []string{"-t", "--bottomval"}, Enabled: true, Warning: ""},
+		{Args: []string{"-t", "-5"}, Enabled: true, Warning: ""},
+		{Args: []string{"-t", "-"}, Enabled: true, Warning: ""},
+		{Args: []string{"--topval=--help"}, Enabled: true, Warning: ""},
+		{Args: []string{"--topval", "--help"}, Enabled: false, Warning: ""},
+	}
+	for _, test := range tests {
+		cmd := New("top", &topSpec{})
+		warnings := bytes.NewBuffer(nil)
+		cmd.Warnings = warnings
+		cmd.WarnOnOptionLikeValues = test.Enabled
+		cmd.Decode(test.Args)
+		if warnings.String() != test.Warning {
+			t.Errorf("Invalid warning.  Args: %q, Expected: %q, Received: %q", test.Args, test.Warning, warnings.String())
+		}
+	}
+}
+
+func TestBoolWords(t *testing.T) {
+	type spec struct {
+		Feature bool `flag:"f, feature"`
+		Plain   bool `flag:"plain"`
+	}
+	yesNo := &BoolWords{True: []string{"yes"}, False: []string{"no"}}
+	tests := []struct {
+		Words   *BoolWords
+		Args    []string
+		Valid   bool
+		Feature bool
+		Err     string
+	}{
+		{Words: DefaultBoolWords, Args: []string{}, Valid: true, Feature: false},
+		{Words: DefaultBoolWords, Args: []string{"--feature"}, Valid: true, Feature: true},
+		{Words: DefaultBoolWords, Args: []string{"-f"}, Valid: true, Feature: true},
+		{Words: DefaultBoolWords, Args: []string{"--feature=on"}, Valid: true, Feature: true},
+		{Words: DefaultBoolWords, Args: []string{"--feature=OFF"}, Valid: true, Feature: false},
+		{Words: DefaultBoolWords, Args: []string{"--feature=enabled"}, Valid: true, Feature: true},
+		{Words: DefaultBoolWords, Args: []string{"--feature=disabled"}, Valid: true, Feature: false},
+		{Words: DefaultBoolWords, Args: []string{"--feature=false"}, Valid: true, Feature: false},
+		{Words: DefaultBoolWords, Args: []string{"--feature=maybe"}, Valid: false, Err: `flag '--feature' value "maybe" is not recognized (accepted values: true, on, enabled, false, off, disabled)`},
+		{Words: DefaultBoolWords, Args: []string{"--feature", "off"}, Valid: true, Feature: true},
+		{Words: DefaultBoolWords, Args: []string{"--plain=on"}, Valid: false, Err: "flag '--plain' does not accept an argument"},
+		{Words: DefaultBoolWords, Args: []string{"--feature=on", "--feature=off"}, Valid: false, Err: `option "--feature" specified too many times`},
+		{Words: yesNo, Args: []string{"--feature=Yes"}, Valid: true, Feature: true},
+		{Words: yesNo, Args: []string{"--feature=on"}, Valid: false, Err: `flag '--feature' value "on" is not recognized (accepted values: yes, no)`},
+		{Words: nil, Args: []string{"--feature=on"}, Valid: false, Err: "flag '--feature' does not accept an argument"},
+	}
+	for _, test := range tests {
+		s := &spec{}
+		cmd := New("test", s)
+		cmd.Option("feature").BoolWords = test.Words
+		_, _, err := cmd.Decode(test.Args)
+		if !test.Valid {
+			if err == nil || err.Error() != test.Err {
+				t.Errorf("Invalid error.  Args: %q, Expected: %q, Received: %v", test.Args, test.Err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error.  Args: %q, Error: %s", test.Args, err)
+			continue
+		}
+		if s.Feature != test.Feature {
+			t.Errorf("Invalid flag value.  Args: %q, Expected: %t, Received: %t", test.Args, test.Feature, s.Feature)
+		}
+	}
+
+	s := &spec{}
+	cmd := New("test", s)
+	cmd.Option("feature").BoolWords = DefaultBoolWords
+	err := cmd.DecodeMap(map[string][]string{"feature": {"off"}})
+	if err != nil || s.Feature {
+		t.Errorf("Invalid DecodeMap result.  Value: %t, Error: %v", s.Feature, err)
+	}
+}
+
+func TestMaxPositionalBytes(t *testing.T) {
+	tests := []struct {
+		Limit int
+		Args  []string
+		Valid bool
+		Err   string
+	}{
+		{Limit: 0, Args: []string{strings.Repeat("x", 1000)}, Valid: true},
+		{Limit: 6, Args: []string{}, Valid: true},
+		{Limit: 6, Args: []string{"abc", "def"}, Valid: true},
+		{Limit: 6, Args: []string{"-t", "12345", "abc", "def"}, Valid: true},
+		{Limit: 6, Args: []string{"mid", "abc", "defg"}, Valid: false, Err: "positional arguments total 7 bytes, exceeding the limit of 6 bytes"},
+		{Limit: 6, Args: []string{"--", "-t", "abcde"}, Valid: false, Err: "positional arguments total 7 bytes, exceeding the limit of 6 bytes"},
+		{Limit: 6, Args: []string{"héllo", "x"}, Valid: false, Err: "positional arguments total 7 bytes, exceeding the limit of 6 bytes"},
+	}
+	for _, test := range tests {
+		cmd := New("top", &topSpec{})
+		cmd.MaxPositionalBytes = test.Limit
+		_, _, err := cmd.Decode(test.Args)
+		if !test.Valid {
+			if err == nil || err.Error() != test.Err {
+				t.Errorf("Invalid error.  Args: %q, Expected: %q, Received: %v", test.Args, test.Err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error.  Args: %q, Error: %s", test.Args, err)
+		}
+	}
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Errorf("Expected a panic for a negative MaxPositionalBytes")
+		}
+	}()
+	cmd := New("top", &topSpec{})
+	cmd.MaxPositionalBytes = -1
+	cmd.Decode([]string{})
+}
+
+func TestDecodeFull(t *testing.T) {
+	spec := &topSpec{}
+	cmd := New("top", spec)
+	path, positional, err := cmd.DecodeFull([]string{"/usr/bin/top", "-t", "1", "mid", "arg"})
+	if err != nil {
+		t.Errorf("Received unexpected error.  Error: %s", err)
+	}
+	if path.String() != "top mid" || !reflect.DeepEqual(positional, []string{"arg"}) || spec.Top != 1 {
+		t.Errorf("Invalid DecodeFull result.  Path: %s, Positional: %q, Top: %d", path, positional, spec.Top)
+	}
+	if cmd.Name != "top" {
+		t.Errorf("DecodeFull replaced an existing name.  Received: %s", cmd.Name)
+	}
+
+	cmd = &Command{Options: []*Option{{Names: []string{"v"}, Flag: true, Decoder: NewFlagDecoder(new(bool))}}}
+	_, positional, err = cmd.DecodeFull([]string{"/usr/local/bin/mytool", "-v", "file"})
+	if err != nil {
+		t.Errorf("Received unexpected error.  Error: %s", err)
+	}
+	if cmd.Name != "mytool" || !reflect.DeepEqual(positional, []string{"file"}) {
+		t.Errorf("Invalid DecodeFull result.  Name: %s, Positional: %q", cmd.Name, positional)
+	}
+
+	_, positional, err = New("top", &topSpec{}).DecodeFull(nil)
+	if err != nil || len(positional) != 0 {
+		t.Errorf("Invalid DecodeFull result for empty args.  Positional: %q, Error: %v", positional, err)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	tests := []struct {
+		Args    []string
+		Command string
+		Message string
+	}{
+		{Args: []string{"--unknown"}, Command: "top", Message: "option '--unknown' is not recognized"},
+		{Args: []string{"mid", "-x"}, Command: "mid", Message: "option '-x' is not recognized"},
+		{Args: []string{"mid", "bottom", "--bottomval", "foo"}, Command: "bottom", Message: "strconv.ParseInt: parsing \"foo\": invalid syntax"},
+		{Args: []string{"mid", "bottom", "--midval"}, Command: "bottom", Message: "option '--midval' requires an argument"},
+	}
+	for _, test := range tests {
+		cmd := New("top", &topSpec{})
+		_, _, err := cmd.Decode(test.Args)
+		decodeErr, ok := err.(*DecodeError)
+		if !ok {
+			t.Errorf("Expected a *DecodeError.  Args: %q, Received: %#v", test.Args, err)
+			continue
+		}
+		if decodeErr.Command == nil || decodeErr.Command.Name != test.Command {
+			t.Errorf("Invalid DecodeError command.  Args: %q, Expected: %s, Received: %v", test.Args, test.Command, decodeErr.Command)
+		}
+		if err.Error() != test.Message {
+			t.Errorf("Invalid DecodeError message.  Args: %q, Expected: %q, Received: %q", test.Args, test.Message, err.Error())
+		}
+	}
+
+	sentinel := errors.New("sentinel")
+	cmd := &Command{Name: "test", Options: []*Option{
+		{Names: []string{"o"}, Decoder: errorDecoder{sentinel}},
+	}}
+	_, _, err := cmd.Decode([]string{"-o", "value"})
+	decodeErr, ok := err.(*DecodeError)
+	if !ok || decodeErr.Unwrap() != sentinel {
+		t.Errorf("Expected a *DecodeError wrapping the decoder's error.  Received: %#v", err)
+	}
+}
+
+type errorDecoder struct {
+	err error
+}
+
+func (d errorDecoder) Decode(arg string) error {
+	return d.err
+}
+
+/*
+ * Test options with optional arguments
+ */
+
+func TestOptionalArgs(t *testing.T) {
+	tests := []struct {
+		Args       []string
+		Valid      bool
+		Value      []string
+		Positional []string
+	}{
+		{Args: []string{"--color"}, Valid: true, Value: []string{""}, Positional: []string{}},
+		{Args: []string{"--color=always"}, Valid: true, Value: []string{"always"}, Positional: []string{}},
+		{Args: []string{"--color="}, Valid: true, Value: []string{""}, Positional: []string{}},
+		{Args: []string{"--color", "always"}, Valid: true, Value: []string{""}, Positional: []string{"always"}},
+		{Args: []string{"-c"}, Valid: true, Value: []string{""}, Positional: []string{}},
+		{Args: []string{"-calways"}, Valid: true, Value: []string{"always"}, Positional: []string{}},
+		{Args: []string{"-c", "always"}, Valid: true, Value: []string{""}, Positional: []string{"always"}},
+		{Args: []string{"-vc"}, Valid: true, Value: []string{""}, Positional: []string{}},
+		{Args: []string{"-vcnever"}, Valid: true, Value: []string{"never"}, Positional: []string{}},
+		{Args: []string{"-c", "-c"}, Valid: false},
+	}
+	for _, test := range tests {
+		var values []string
+		var verbose bool
+		cmd := &Command{Name: "test"}
+		cmd.Options = []*Option{
+			{Names: []string{"c", "color"}, Decoder: stringSliceDecoder{&values}, OptionalArg: true},
+			{Names: []string{"v"}, Decoder: NewFlagDecoder(&verbose), Flag: true},
+		}
+		_, positional, err := cmd.Decode(test.Args)
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received. Args: %q", test.Args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error. Args: %q, Error: %s", test.Args, err)
+			continue
+		}
+		if !reflect.DeepEqual(values, test.Value) {
+			t.Errorf("Decoded value is incorrect. Args: %q, Expected: %q, Received: %q", test.Args, test.Value, values)
+		}
+		if !reflect.DeepEqual(positional, test.Positional) {
+			t.Errorf("Positional args are incorrect. Args: %q, Expected: %q, Received: %q", test.Args, test.Positional, positional)
+		}
 	}
 }
 
@@ -678,6 +2801,65 @@ func (r *ioFieldSpec) PerformIO() error {
 	return nil
 }
 
+func TestReaderSliceField(t *testing.T) {
+	dir, err := ioutil.TempDir("", "writ-readers")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir.  Error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	var paths []string
+	for _, name := range []string{"a", "b"} {
+		path := filepath.Join(dir, name)
+		err = ioutil.WriteFile(path, []byte(name), 0644)
+		if err != nil {
+			t.Fatalf("Failed to write temp file.  Error: %s", err)
+		}
+		paths = append(paths, path)
+	}
+
+	spec := &struct {
+		Inputs  []io.Reader     `option:"i"`
+		Closers []io.ReadCloser `option:"c"`
+	}{}
+	cmd := New("test", spec)
+	_, _, err = cmd.Decode([]string{"-i", paths[0], "-i", paths[1], "-c", paths[1], "-i", "-"})
+	if err != nil {
+		t.Fatalf("Received unexpected error.  Error: %s", err)
+	}
+	if len(spec.Inputs) != 3 || len(spec.Closers) != 1 {
+		t.Fatalf("Invalid number of readers.  Inputs: %d, Closers: %d", len(spec.Inputs), len(spec.Closers))
+	}
+	if spec.Inputs[2] != os.Stdin {
+		t.Errorf("Expected \"-\" to decode as os.Stdin")
+	}
+	for i, expected := range []string{"a", "b"} {
+		content, err := ioutil.ReadAll(spec.Inputs[i])
+		if err != nil || string(content) != expected {
+			t.Errorf("Invalid reader content.  Expected: %q, Received: %q, Error: %v", expected, string(content), err)
+		}
+		spec.Inputs[i].(io.Closer).Close()
+	}
+	spec.Closers[0].Close()
+
+	invalid := [][]string{
+		{"-i", filepath.Join(dir, "missing")},
+		{"-i", paths[0], "-i", filepath.Join(dir, "missing")},
+		{"-i", "-", "-i", "-"},
+	}
+	for _, args := range invalid {
+		spec.Inputs = nil
+		_, _, err = New("test", spec).Decode(args)
+		if err == nil {
+			t.Errorf("Expected error but none received.  Args: %q", args)
+		}
+		for _, in := range spec.Inputs {
+			if in != os.Stdin {
+				in.(io.Closer).Close()
+			}
+		}
+	}
+}
+
 type ioFieldTest struct {
 	Args       []string
 	Valid      bool
@@ -914,6 +3096,26 @@ type customDecoderFieldSpec struct {
 	CustomOptionPtr customTestOptionPtr `option:"optptr" description:"a custom option field with pointer receiver"`
 }
 
+type customDecoderSliceFieldSpec struct {
+	Values   []customTestOptionPtr  `option:"v, value" description:"a slice of custom decoders"`
+	Pointers []*customTestOptionPtr `option:"p, pointer" description:"a slice of custom decoder pointers"`
+}
+
+var customDecoderSliceFieldTests = []fieldTest{
+	{Args: []string{}, Valid: true, Field: "Values", Value: []customTestOptionPtr(nil)},
+	{Args: []string{"-v", "foo", "--value=foobar"}, Valid: true, Field: "Values", Value: []customTestOptionPtr{{val: "foo"}, {val: "foobar"}}},
+	{Args: []string{"-v", "foo", "-v", "bar"}, Valid: false},
+	{Args: []string{"-p", "foo1", "-p", "foo2"}, Valid: true, Field: "Pointers", Value: []*customTestOptionPtr{{val: "foo1"}, {val: "foo2"}}},
+	{Args: []string{"-p", "puppies"}, Valid: false},
+}
+
+func TestCustomDecoderSliceFields(t *testing.T) {
+	for _, test := range customDecoderSliceFieldTests {
+		spec := &customDecoderSliceFieldSpec{}
+		runFieldTest(t, spec, test)
+	}
+}
+
 var trueval = true
 var foobarval = "foobar"
 
@@ -1004,6 +3206,15 @@ var basicFieldTests = []fieldTest{
 	{Args: []string{"--string", "a", "--string", "b"}, Valid: false},
 	{Args: []string{"--string"}, Valid: false},
 
+	// Explicit empty values
+	{Args: []string{"--string="}, Valid: true, Field: "String", Value: ""},
+	{Args: []string{"--string=", "a"}, Valid: true, Field: "String", Value: ""},
+	{Args: []string{"--string=="}, Valid: true, Field: "String", Value: "="},
+	{Args: []string{"--string=a=b"}, Valid: true, Field: "String", Value: "a=b"},
+	{Args: []string{"--int="}, Valid: false},
+	{Args: []string{"--uint8="}, Valid: false},
+	{Args: []string{"--float64="}, Valid: false},
+
 	// Int8
 	{Args: []string{"--int8", fmt.Sprintf("%d", int64(math.MinInt8))}, Valid: true, Field: "Int8", Value: int8(math.MinInt8)},
 	{Args: []string{"--int8", fmt.Sprintf("%d", int64(math.MaxInt8))}, Valid: true, Field: "Int8", Value: int8(math.MaxInt8)},
@@ -1650,34 +3861,263 @@ var invalidSpecTests = []struct {
 			Flag bool `flag:"flag" option:"option" description:"flag as option"`
 		}{},
 	},
+	{
+		Description: "Unique options must be string slices",
+		Spec: &struct {
+			Option []int `option:"option" unique:"true"`
+		}{},
+	},
+	{
+		Description: "Unique tag values must be valid",
+		Spec: &struct {
+			Option []string `option:"option" unique:"yes"`
+		}{},
+	},
+	{
+		Description: "Glob options must be string slices",
+		Spec: &struct {
+			Option string `option:"option" glob:"true"`
+		}{},
+	},
+	{
+		Description: "Glob tag values must be valid",
+		Spec: &struct {
+			Option []string `option:"option" glob:"yes"`
+		}{},
+	},
+	{
+		Description: "Glob and unique tags cannot be combined",
+		Spec: &struct {
+			Option []string `option:"option" glob:"true" unique:"true"`
+		}{},
+	},
+	{
+		Description: "Path and case tags cannot be combined",
+		Spec: &struct {
+			Option string `option:"option" path:"existing" case:"lower"`
+		}{},
+	},
+	{
+		Description: "Base and grouping tags cannot be combined",
+		Spec: &struct {
+			Option int `option:"option" base:"0" grouping:","`
+		}{},
+	},
+	{
+		Description: "Bytesize and base tags cannot be combined",
+		Spec: &struct {
+			Option int64 `option:"option" bytesize:"true" base:"16"`
+		}{},
+	},
+	{
+		Description: "Path options must be strings",
+		Spec: &struct {
+			Option []string `option:"option" path:"existing"`
+		}{},
+	},
+	{
+		Description: "Path tag values must be valid",
+		Spec: &struct {
+			Option string `option:"option" path:"bogus"`
+		}{},
+	},
+	{
+		Description: "Base options must be integers",
+		Spec: &struct {
+			Option string `option:"option" base:"16"`
+		}{},
+	},
+	{
+		Description: "Base tag values must be valid",
+		Spec: &struct {
+			Option int `option:"option" base:"hex"`
+		}{},
+	},
+	{
+		Description: "Base tag values must be in range",
+		Spec: &struct {
+			Option int `option:"option" base:"1"`
+		}{},
+	},
+	{
+		Description: "Byte size options must be int64",
+		Spec: &struct {
+			Option int `option:"option" bytesize:"true"`
+		}{},
+	},
+	{
+		Description: "Byte size tag values must be valid",
+		Spec: &struct {
+			Option int64 `option:"option" bytesize:"yes"`
+		}{},
+	},
+	{
+		Description: "Replace options must be slices or maps",
+		Spec: &struct {
+			Option string `option:"option" replace:"true"`
+		}{},
+	},
+	{
+		Description: "Replace tag values must be valid",
+		Spec: &struct {
+			Option []string `option:"option" replace:"yes"`
+		}{},
+	},
+	{
+		Description: "Replace tags are invalid for flags",
+		Spec: &struct {
+			Flag int `flag:"flag" replace:"true"`
+		}{},
+	},
+	{
+		Description: "Environment fields can't have descriptions",
+		Spec: &struct {
+			Field string `env:"WRIT_ENV" description:"A field"`
+		}{},
+	},
+	{
+		Description: "Environment fields must be exported",
+		Spec: &struct {
+			field string `env:"WRIT_ENV"`
+		}{},
+	},
+	{
+		Description: "GOOS tags are invalid for commands",
+		Spec: &struct {
+			Command struct{} `command:"command" goos:"linux"`
+		}{},
+	},
+	{
+		Description: "Skipped options are still validated",
+		Spec: &struct {
+			Option int64 `option:"option" goos:"nonexistent" bytesize:"yes"`
+		}{},
+	},
+	{
+		Description: "Case options must be strings",
+		Spec: &struct {
+			Option []string `option:"option" case:"lower"`
+		}{},
+	},
+	{
+		Description: "Case tag values must be valid",
+		Spec: &struct {
+			Option string `option:"option" case:"camel"`
+		}{},
+	},
+	{
+		Description: "Case tags are invalid for flags",
+		Spec: &struct {
+			Flag bool `flag:"flag" case:"lower"`
+		}{},
+	},
+	{
+		Description: "Grouping options must be numeric",
+		Spec: &struct {
+			Option string `option:"option" grouping:","`
+		}{},
+	},
+	{
+		Description: "Grouping options must not be complex",
+		Spec: &struct {
+			Option complex128 `option:"option" grouping:","`
+		}{},
+	},
+	{
+		Description: "Grouping options must not be slices",
+		Spec: &struct {
+			Option []int `option:"option" grouping:","`
+		}{},
+	},
+	{
+		Description: "Grouping tag values must be a single character",
+		Spec: &struct {
+			Option int `option:"option" grouping:",,"`
+		}{},
+	},
+	{
+		Description: "Grouping tag values must not be digits",
+		Spec: &struct {
+			Option int `option:"option" grouping:"0"`
+		}{},
+	},
+	{
+		Description: "Flags cannot use grouping",
+		Spec: &struct {
+			Flag int `flag:"flag" grouping:","`
+		}{},
+	},
+	{
+		Description: "Flags cannot be paths",
+		Spec: &struct {
+			Flag bool `flag:"flag" path:"existing"`
+		}{},
+	},
+	{
+		Description: "Pointer commands must point to structs",
+		Spec: &struct {
+			Command *int `command:"command"`
+		}{},
+	},
+	{
+		Description: "Command fields must be structs",
+		Spec: &struct {
+			Command int `command:"command"`
+		}{},
+	},
+	{
+		Description: "Commands cannot have requirements",
+		Spec: &struct {
+			Command struct{} `command:"command" requires:"a"`
+		}{},
+	},
+	{
+		Description: "Commands cannot have conflicts",
+		Spec: &struct {
+			Command struct{} `command:"command" conflicts:"a"`
+		}{},
+	},
+	{
+		Description: "Flags cannot be unique",
+		Spec: &struct {
+			Flag bool `flag:"flag" unique:"true"`
+		}{},
+	},
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(&topSpec{}); err != nil {
+		t.Errorf("Received unexpected error validating spec.  Error: %s", err)
+	}
+	err := Validate(&struct {
+		Option int `option:"o" flag:"f"`
+	}{})
+	if err == nil || err.Error() != "tag option is not valid for flags (field Option)" {
+		t.Errorf("Invalid error validating spec.  Received: %v", err)
+	}
+	err = Validate(&struct {
+		Option int `option:"o" placeholder:"X" minvalues:"2"`
+	}{})
+	if _, ok := err.(optionError); !ok {
+		t.Errorf("Expected an option error validating spec.  Received: %v", err)
+	}
 }
 
 func TestInvalidSpecs(t *testing.T) {
 	for _, test := range invalidSpecTests {
-		err := newInvalidCommand(test.Spec)
+		err := Validate(test.Spec)
 		if err == nil {
 			t.Errorf("Expected error creating spec, but none received.  Test: %s", test.Description)
 			continue
 		}
 	}
-}
 
-func newInvalidCommand(spec interface{}) (err error) {
-	defer func() {
-		r := recover()
-		if r != nil {
-			switch e := r.(type) {
-			case commandError:
-				err = e
-			case optionError:
-				err = e
-			default:
-				panic(e)
-			}
-		}
-	}()
-	New("test", spec)
-	return nil
+	err := Validate(&struct {
+		Option string `option:"option" case:"lower" path:"existing"`
+	}{})
+	if err == nil || !strings.Contains(err.Error(), "tags path and case cannot be combined") {
+		t.Errorf("Expected an error naming both decoder tags.  Received: %v", err)
+	}
 }
 
 var invalidCommandTests = []struct {
@@ -1712,6 +4152,14 @@ var invalidCommandTests = []struct {
 		Description: "Command aliases cannot begin with -",
 		Command:     &Command{Name: "command", Aliases: []string{"-alias"}},
 	},
+	{
+		Description: "Argument names cannot be blank",
+		Command:     &Command{Name: "command", ArgNames: []string{""}},
+	},
+	{
+		Description: "Argument names cannot begin with -",
+		Command:     &Command{Name: "command", ArgNames: []string{"-arg"}},
+	},
 	{
 		Description: "Command aliases cannot have spaces 1",
 		Command:     &Command{Name: "command", Aliases: []string{" alias"}},
@@ -1874,6 +4322,48 @@ func TestCheckUnknownTagType(t *testing.T) {
 	}()
 }
 
+/*
+ * Benchmarks
+ */
+
+type benchmarkSpec struct {
+	Verbose  int      `flag:"v, verbose"`
+	Quiet    bool     `flag:"q, quiet"`
+	Name     string   `option:"n, name"`
+	Includes []string `option:"I, include"`
+	Labels   []string `option:"l, label"`
+}
+
+func BenchmarkDecodeShortCluster(b *testing.B) {
+	args := []string{"-vvvvv"}
+	cmd := New("bench", &benchmarkSpec{})
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _, err := cmd.Decode(args)
+		if err != nil {
+			b.Fatalf("Received unexpected error.  Error: %s", err)
+		}
+	}
+}
+
+func BenchmarkDecodeManyOptions(b *testing.B) {
+	var args []string
+	for i := 0; i < 50; i++ {
+		args = append(args, "--include", "dir", "-l", "label", "-Ivalue", "-vv")
+	}
+	args = append(args, "-q", "--name", "test", "positional")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		cmd := New("bench", &benchmarkSpec{})
+		_, _, err := cmd.Decode(args)
+		if err != nil {
+			b.Fatalf("Received unexpected error.  Error: %s", err)
+		}
+	}
+}
+
 /*
  * Misc coverage tests to ensure code doesn't panic/blow-up
  */
@@ -0,0 +1,48 @@
+// +build go1.15
+
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package writ
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+func init() {
+	decodeComplex = parseComplex
+}
+
+// parseComplex decodes complex numbers in the formats accepted by
+// strconv.ParseComplex(), such as 3+4i.  Values are parsed with 128-bit
+// precision, and values that overflow a complex64 return an error.
+func parseComplex(rval reflect.Value, arg string) error {
+	v, err := strconv.ParseComplex(arg, 128)
+	if err != nil {
+		return err
+	}
+	if rval.OverflowComplex(v) {
+		return fmt.Errorf("value %v would overflow %s", v, rval.Kind())
+	}
+	rval.Set(reflect.ValueOf(v).Convert(rval.Type()))
+	return nil
+}
@@ -0,0 +1,71 @@
+// +build go1.15
+
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package writ
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+type complexFieldSpec struct {
+	Complex64  complex64    `option:"complex64" description:"A complex64 option"`
+	Complex128 complex128   `option:"complex128" description:"A complex128 option" default:"1+1i"`
+	Pointer    *complex128  `option:"p"`
+	Pair       [2]complex64 `option:"pair"`
+}
+
+var complexFieldTests = []fieldTest{
+	{Args: []string{"--complex64", "3+4i"}, Valid: true, Field: "Complex64", Value: complex64(3 + 4i)},
+	{Args: []string{"--complex64", "-1.5-2.5i"}, Valid: true, Field: "Complex64", Value: complex64(-1.5 - 2.5i)},
+	{Args: []string{"--complex64", "(3+4i)"}, Valid: true, Field: "Complex64", Value: complex64(3 + 4i)},
+	{Args: []string{"--complex64", "2"}, Valid: true, Field: "Complex64", Value: complex64(2)},
+	{Args: []string{"--complex64", "2i"}, Valid: true, Field: "Complex64", Value: complex64(2i)},
+	{Args: []string{"--complex64", "1.2e3+4.5e-6i"}, Valid: true, Field: "Complex64", Value: complex64(1.2e3 + 4.5e-6i)},
+	{Args: []string{"--complex64", "1+" + strconv.FormatFloat(math.MaxFloat32, 'f', -1, 64) + "i"}, Valid: true, Field: "Complex64", Value: complex(float32(1), float32(math.MaxFloat32))},
+	{Args: []string{"--complex64", strconv.FormatFloat(math.MaxFloat64, 'f', -1, 64) + "+1i"}, Valid: false},
+	{Args: []string{"--complex64", "1+" + strconv.FormatFloat(math.MaxFloat64, 'f', -1, 64) + "i"}, Valid: false},
+	{Args: []string{"--complex128", strconv.FormatFloat(math.MaxFloat64, 'f', -1, 64) + "+1i"}, Valid: true, Field: "Complex128", Value: complex(math.MaxFloat64, 1)},
+	{Args: []string{"--complex128", "3+4j"}, Valid: false},
+	{Args: []string{"--complex128", "3 + 4i"}, Valid: false},
+	{Args: []string{"--complex128", "i"}, Valid: false},
+	{Args: []string{"--complex128", "foo"}, Valid: false},
+	{Args: []string{"--complex128="}, Valid: false},
+	{Args: []string{}, Valid: true, Field: "Complex128", Value: complex128(1 + 1i)},
+	{Args: []string{"-p", "0+1i"}, Valid: true, Field: "Pointer", Value: func() *complex128 { v := complex128(1i); return &v }()},
+	{Args: []string{"--pair", "1+2i,3-4i"}, Valid: true, Field: "Pair", Value: [2]complex64{1 + 2i, 3 - 4i}},
+}
+
+func TestComplexFields(t *testing.T) {
+	for _, test := range complexFieldTests {
+		spec := &complexFieldSpec{}
+		runFieldTest(t, spec, test)
+	}
+
+	cmd := New("test", &complexFieldSpec{})
+	for name, expected := range map[string]string{"complex64": "COMPLEX", "p": "COMPLEX", "pair": "COMPLEX,COMPLEX"} {
+		if placeholder := optionPlaceholder(cmd.Option(name)); placeholder != expected {
+			t.Errorf("Invalid placeholder.  Option: %s, Expected: %q, Received: %q", name, expected, placeholder)
+		}
+	}
+}
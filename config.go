@@ -0,0 +1,211 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package writ
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// LoadDefaultsFromFile reads default option values from the JSON config file
+// at path.  The values are applied by Decode(), after "default" tags and
+// before parsing arguments.  Options with an Env field are skipped if the
+// environment variable is set, so the precedence, from lowest to highest,
+// is: "default" tags, config values, environment values, and arguments.
+// Config values for slice and map options replace their "default" tag values,
+// and arguments are added to the config values unless the option has a
+// "replace" tag.
+//
+// The file must contain a JSON object.  Keys are matched against option
+// names, using the top-level command's NormalizeName, if set.  Values may be
+// strings, numbers, booleans, or arrays of these for Plural options.  Flags are set by a true value and left unset by false.
+// Objects may be used for map options, producing key=value arguments, or
+// for subcommands, with keys matching the subcommand's options.  Keys that
+// don't match an option or subcommand are reported as errors by Decode().
+func (c *Command) LoadDefaultsFromFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var values map[string]interface{}
+	dec := json.NewDecoder(f)
+	dec.UseNumber()
+	err = dec.Decode(&values)
+	if err != nil {
+		return fmt.Errorf("config %s: %s", path, err)
+	}
+	c.configPath = path
+	c.configValues = values
+	return nil
+}
+
+// LoadDefaultsFromXDG loads default option values from appName/config.json
+// in the XDG config directory, using LoadDefaultsFromFile().  The directory
+// is $XDG_CONFIG_HOME if it's set to an absolute path, and $HOME/.config
+// otherwise.  If the file doesn't exist, LoadDefaultsFromXDG does nothing and
+// returns nil.  Only JSON is supported; config.toml files aren't read, as
+// writ has no TOML parser and no dependencies outside the standard library.
+func (c *Command) LoadDefaultsFromXDG(appName string) error {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if !filepath.IsAbs(dir) {
+		home := os.Getenv("HOME")
+		if home == "" {
+			return nil
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	path := filepath.Join(dir, appName, "config.json")
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return c.LoadDefaultsFromFile(path)
+}
+
+// applyConfig decodes config values for c and its subcommands.  If track is
+// set, SourceConfig is recorded as the source of each decoded option.  Keys
+// are matched against option names with normalize, if non-nil.  Config values
+// replace the defaults of slice and map options built by New(), and of
+// options that use NewReplacingDecoder().
+func applyConfig(c *Command, values map[string]interface{}, path string, track bool, normalize func(string) string) error {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		opt := Path{c}.matchOption(k, normalize)
+		if opt == nil {
+			sub := c.Subcommand(k)
+			if sub == nil {
+				return fmt.Errorf("config %s: key %q does not match an option or command", path, k)
+			}
+			subvalues, ok := values[k].(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("config %s: command %q must be an object", path, k)
+			}
+			err := applyConfig(sub, subvalues, path, track, normalize)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if opt.Env != "" {
+			if _, set := os.LookupEnv(opt.Env); set {
+				continue
+			}
+		}
+		args, err := configArgs(opt, values[k])
+		if err != nil {
+			return fmt.Errorf("config %s: option %q %s", path, k, err)
+		}
+		if len(args) > 0 {
+			clearDefaults(opt.Decoder)
+		}
+		for _, arg := range args {
+			err = opt.Decoder.Decode(arg)
+			if err != nil {
+				return fmt.Errorf("config %s: option %q: %s", path, k, err)
+			}
+		}
+		if len(args) > 0 {
+			markDefaulted(opt.Decoder)
+		}
+		if track && len(args) > 0 {
+			opt.source = SourceConfig
+		}
+	}
+	return nil
+}
+
+// configArgs converts a JSON value to the arguments to decode for opt.
+func configArgs(opt *Option, value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		if !opt.Plural {
+			return nil, fmt.Errorf("does not accept multiple values")
+		}
+		var args []string
+		for _, elem := range v {
+			arg, ok := configScalar(opt, elem)
+			if !ok {
+				return nil, fmt.Errorf("has an invalid array element")
+			}
+			args = append(args, arg...)
+		}
+		return args, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var args []string
+		for _, k := range keys {
+			arg, ok := configScalar(&Option{}, v[k])
+			if !ok || len(arg) != 1 {
+				return nil, fmt.Errorf("has an invalid value for key %q", k)
+			}
+			args = append(args, k+"="+arg[0])
+		}
+		return args, nil
+	}
+	arg, ok := configScalar(opt, value)
+	if !ok {
+		return nil, fmt.Errorf("has an invalid value")
+	}
+	return arg, nil
+}
+
+// configScalar converts a JSON string, number, or bool to the arguments to
+// decode for opt.  Flags decode an empty argument for true, and nothing for
+// false.
+func configScalar(opt *Option, value interface{}) ([]string, bool) {
+	switch v := value.(type) {
+	case string:
+		if opt.Flag {
+			return nil, false
+		}
+		return []string{v}, true
+	case json.Number:
+		if opt.Flag {
+			return nil, false
+		}
+		return []string{v.String()}, true
+	case bool:
+		if opt.Flag {
+			if v {
+				return []string{""}, true
+			}
+			return nil, true
+		}
+		return []string{strconv.FormatBool(v)}, true
+	}
+	return nil, false
+}
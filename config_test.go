@@ -0,0 +1,239 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package writ
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type configSpec struct {
+	Verbose  bool              `flag:"v, verbose"`
+	Name     string            `option:"n, name" default:"default"`
+	Count    int               `option:"c, count"`
+	Ratio    float64           `option:"ratio"`
+	ID       int64             `option:"id"`
+	Includes []string          `option:"I, include"`
+	Labels   map[string]string `option:"l, label"`
+	User     string            `option:"user" env:"WRIT_CONFIG_TEST_USER"`
+	Sub      struct {
+		Depth int `option:"depth"`
+	} `command:"sub"`
+}
+
+func writeConfig(t *testing.T, dir string, content string) string {
+	path := filepath.Join(dir, "app", "config.json")
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		t.Fatalf("Failed to create config dir.  Error: %s", err)
+	}
+	err = ioutil.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write config file.  Error: %s", err)
+	}
+	return path
+}
+
+func TestLoadDefaultsFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "writ-config")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir.  Error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfig(t, dir, `{
+		"verbose": true,
+		"name": "config",
+		"c": 3,
+		"ratio": 0.5,
+		"id": 9007199254740993,
+		"include": ["a", "b"],
+		"label": {"k": "v"},
+		"user": "config-user",
+		"sub": {"depth": 2}
+	}`)
+	os.Setenv("WRIT_CONFIG_TEST_USER", "env-user")
+	defer os.Unsetenv("WRIT_CONFIG_TEST_USER")
+
+	spec := &configSpec{}
+	cmd := New("app", spec)
+	err = cmd.LoadDefaultsFromFile(path)
+	if err != nil {
+		t.Fatalf("Received unexpected error loading config.  Error: %s", err)
+	}
+	_, _, err = cmd.Decode([]string{"-c", "4", "sub"})
+	if err != nil {
+		t.Fatalf("Received unexpected error decoding.  Error: %s", err)
+	}
+	expected := &configSpec{
+		Verbose:  true,
+		Name:     "config",
+		Count:    4,
+		Ratio:    0.5,
+		ID:       9007199254740993,
+		Includes: []string{"a", "b"},
+		Labels:   map[string]string{"k": "v"},
+		User:     "env-user",
+	}
+	expected.Sub.Depth = 2
+	if !reflect.DeepEqual(spec, expected) {
+		t.Errorf("Decoded values are incorrect.  Expected: %+v, Received: %+v", expected, spec)
+	}
+
+	invalid := []string{
+		`{"bogus": 1}`,
+		`{"verbose": "yes"}`,
+		`{"name": ["a", "b"]}`,
+		`{"count": "abc"}`,
+		`{"sub": 1}`,
+		`{"sub": {"bogus": 1}}`,
+	}
+	for _, content := range invalid {
+		path := writeConfig(t, dir, content)
+		cmd := New("app", &configSpec{})
+		err = cmd.LoadDefaultsFromFile(path)
+		if err != nil {
+			t.Errorf("Received unexpected error loading config.  Config: %s, Error: %s", content, err)
+			continue
+		}
+		_, _, err = cmd.Decode(nil)
+		if err == nil {
+			t.Errorf("Expected error decoding config, but none received.  Config: %s", content)
+		}
+	}
+
+	path = writeConfig(t, dir, `{"name": `)
+	err = New("app", &configSpec{}).LoadDefaultsFromFile(path)
+	if err == nil {
+		t.Errorf("Expected error loading malformed config, but none received")
+	}
+	err = New("app", &configSpec{}).LoadDefaultsFromFile(filepath.Join(dir, "missing.json"))
+	if err == nil {
+		t.Errorf("Expected error loading missing config, but none received")
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "writ-config")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir.  Error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	type precedenceSpec struct {
+		Tags     []string          `option:"t, tag" default:"a"`
+		Replaced []string          `option:"r, replaced" default:"a" replace:"true"`
+		Labels   map[string]string `option:"l, label" default:"x=1"`
+		LogLevel string            `option:"log-level"`
+	}
+	path := writeConfig(t, dir, `{
+		"tag": ["b"],
+		"replaced": ["b"],
+		"label": {"y": "2"},
+		"log_level": "debug"
+	}`)
+	tests := []struct {
+		Args     []string
+		Tags     []string
+		Replaced []string
+		Labels   map[string]string
+	}{
+		{Args: nil, Tags: []string{"b"}, Replaced: []string{"b"}, Labels: map[string]string{"y": "2"}},
+		{Args: []string{"-t", "c", "-r", "c", "-l", "z=3"}, Tags: []string{"b", "c"}, Replaced: []string{"c"}, Labels: map[string]string{"y": "2", "z": "3"}},
+	}
+	for _, test := range tests {
+		spec := &precedenceSpec{}
+		cmd := New("app", spec, WithNormalizeName(func(name string) string {
+			return strings.Replace(name, "_", "-", -1)
+		}))
+		err = cmd.LoadDefaultsFromFile(path)
+		if err != nil {
+			t.Fatalf("Received unexpected error loading config.  Error: %s", err)
+		}
+		_, _, err = cmd.Decode(test.Args)
+		if err != nil {
+			t.Errorf("Received unexpected error decoding.  Args: %q, Error: %s", test.Args, err)
+			continue
+		}
+		if !reflect.DeepEqual(spec.Tags, test.Tags) || !reflect.DeepEqual(spec.Replaced, test.Replaced) || !reflect.DeepEqual(spec.Labels, test.Labels) {
+			t.Errorf("Decoded values are incorrect.  Args: %q, Expected: %q %q %v, Received: %q %q %v", test.Args, test.Tags, test.Replaced, test.Labels, spec.Tags, spec.Replaced, spec.Labels)
+		}
+		if spec.LogLevel != "debug" {
+			t.Errorf("Expected config key to match a normalized option name.  Received: %q", spec.LogLevel)
+		}
+	}
+}
+
+func TestLoadDefaultsFromXDG(t *testing.T) {
+	dir, err := ioutil.TempDir("", "writ-config")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir.  Error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldXDG, oldHome := os.Getenv("XDG_CONFIG_HOME"), os.Getenv("HOME")
+	defer os.Setenv("XDG_CONFIG_HOME", oldXDG)
+	defer os.Setenv("HOME", oldHome)
+
+	writeConfig(t, filepath.Join(dir, "xdg"), `{"name": "xdg"}`)
+	writeConfig(t, filepath.Join(dir, "home", ".config"), `{"name": "home"}`)
+	tests := []struct {
+		XDG      string
+		Home     string
+		Expected string
+	}{
+		{XDG: filepath.Join(dir, "xdg"), Home: filepath.Join(dir, "home"), Expected: "xdg"},
+		{XDG: "", Home: filepath.Join(dir, "home"), Expected: "home"},
+		{XDG: "relative", Home: filepath.Join(dir, "home"), Expected: "home"},
+		{XDG: filepath.Join(dir, "missing"), Home: filepath.Join(dir, "home"), Expected: "default"},
+		{XDG: "", Home: filepath.Join(dir, "missing"), Expected: "default"},
+	}
+	for _, test := range tests {
+		os.Setenv("XDG_CONFIG_HOME", test.XDG)
+		os.Setenv("HOME", test.Home)
+		spec := &configSpec{}
+		cmd := New("app", spec)
+		err = cmd.LoadDefaultsFromXDG("app")
+		if err != nil {
+			t.Errorf("Received unexpected error loading config.  XDG: %q, Home: %q, Error: %s", test.XDG, test.Home, err)
+			continue
+		}
+		_, _, err = cmd.Decode(nil)
+		if err != nil {
+			t.Errorf("Received unexpected error decoding.  XDG: %q, Home: %q, Error: %s", test.XDG, test.Home, err)
+			continue
+		}
+		if spec.Name != test.Expected {
+			t.Errorf("Invalid config value.  XDG: %q, Home: %q, Expected: %q, Received: %q", test.XDG, test.Home, test.Expected, spec.Name)
+		}
+	}
+
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "bad"))
+	writeConfig(t, filepath.Join(dir, "bad"), `not json`)
+	err = New("app", &configSpec{}).LoadDefaultsFromXDG("app")
+	if err == nil {
+		t.Errorf("Expected error loading malformed config, but none received")
+	}
+}
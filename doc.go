@@ -70,6 +70,12 @@ Writ uses a template to generate the help content.  The default template
 mimics --help output for common GNU programs.  See the documentation of the
 Help type for more details.
 
+Option descriptions may reference the option's metadata using text/template
+actions if the option's "expand" tag is set.  The .Names, .Placeholder, and
+.Default fields are available, e.g.
+description:"Listen on {{.Placeholder}} (default {{.Default}})" expand:"true".
+Other descriptions are displayed as-is.
+
 Field Tag Reference
 
 The New() function recognizes the following combinations of field tags:
@@ -77,23 +83,81 @@ The New() function recognizes the following combinations of field tags:
 	Option Fields:
 		- option (required): a comma-separated list of names for the option
 		- description: the description to display for help output
-		- placeholder: the placeholder value to use next to the option names (e.g. FILE)
+		- expand: "true" to render the description as a template (see above)
+		- long_description: a detailed description for documentation such as man pages, not displayed by the default help template
+		- placeholder: the placeholder value to use next to the option names (e.g. FILE); defaults to a placeholder derived from the field type, such as INT
 		- default: the default value for the field
-		- env: the name of an environment variable, the value of which is used as a default for the field
+		- env: the name of an environment variable, the value of which is used as a default for the field; help output displays the name, such as [$PORT], unless Help.HideEnv is set
+		- replace: "true" to have values specified via arguments replace the defaults of a slice or map option, rather than being added to them (see NewReplacingDecoder)
+		- minvalues: the minimum number of times a slice or map option must be specified
+		- maxvalues: the maximum number of times a slice or map option may be specified
+		- unique: "true" or "ignorecase" to skip duplicate values for []string options, keeping the first-seen order
+		- glob: "true" or "strict" to expand glob patterns for []string options (see NewGlobSliceDecoder and NewStrictGlobSliceDecoder)
+		- path: "existing", "existing-dir", "existing-file", or "parent-exists" to validate string options as file paths (see NewPathDecoder)
+		- case: "none", "lower", "upper", or "title" to convert the case of string option values (see NewCaseStringDecoder)
+		- grouping: a digit grouping separator, such as ",", accepted in int, uint, and float option values (see NewGroupedIntDecoder)
+		- base: the base for integer options, or "0" to infer the base from a 0x, 0o, or 0b prefix (see NewBaseIntDecoder)
+		- bytesize: "true" to decode int64 options as byte sizes with unit suffixes, such as 10MB or 1GiB (see NewByteSizeDecoder)
+		- requires: a comma-separated list of options that must be specified if the option is specified
+		- conflicts: a comma-separated list of options that may not be specified if the option is specified
+		- goos: a comma-separated list of operating systems, such as "linux, darwin", on which the option is available
+		- goarch: a comma-separated list of architectures, such as "amd64, arm64", on which the option is available
 
 	Flag fields:
 		- flag (required): a comma-separated list of names for the flag
 		- description: the description to display for help output
+		- expand: "true" to render the description as a template (see above)
+		- long_description: a detailed description for documentation such as man pages, not displayed by the default help template
+		- minvalues: the minimum number of times an int (counting) flag must be specified
+		- maxvalues: the maximum number of times an int (counting) flag may be specified
+		- requires: a comma-separated list of options that must be specified if the flag is specified
+		- conflicts: a comma-separated list of options that may not be specified if the flag is specified
+		- goos: a comma-separated list of operating systems on which the flag is available
+		- goarch: a comma-separated list of architectures on which the flag is available
+
+	Environment fields (fields with an "env" tag, but no "option" or "flag" tag):
+		- env (required): the name of an environment variable, the value of which is decoded into the field
+		- default: the value to decode if the environment variable is unset or fails to decode
+		- goos, goarch: as for option fields
 
 	Command fields:
 		- name (required): a name for the command
 		- aliases: a comma-separated list of alias names for the command
 		- description: the description to display for help output
+		- long_description: a detailed description for documentation such as man pages, not displayed by the default help template
+
+The unique, glob, path, case, base, bytesize, and grouping tags each select
+the decoder for an option field, so at most one of them may be set on a
+field.
+
+Options and flags with "goos" or "goarch" tags that don't match the current
+runtime.GOOS and runtime.GOARCH are left out of the command entirely.  Skipped
+options aren't parseable, aren't displayed in help output, and their fields
+keep their zero values.  Other options may reference them via "requires" or
+"conflicts" tags, but these relations are ignored on platforms where the
+referenced options are skipped.
+
+Environment fields are decoded along with option defaults, but have no
+corresponding option, so they can't be specified via arguments and aren't
+displayed in help output.  They may be of any type supported by option
+fields, or bool, in which case values accepted by strconv.ParseBool() are
+valid.
+
+Command fields may be structs or pointers to structs.  New() allocates a new
+struct for pointer fields that are nil.
 
 If both "default" and "env" are specified for an option field, the environment
 variable is consulted first.  If the environment variable is present and
 decodes without error, that value is used.  Otherwise, the value for the
 "default" tag is used.  Values specified via parsed arguments take precedence
-over both types of defaults.
+over both types of defaults.  If Command.StrictDefaults is set, an environment
+variable or default value that fails to decode causes Decode() to return an
+error instead.
+
+If an option field has neither a "default" nor an "env" tag, the field's
+existing value acts as its default.  Decode() leaves the field unchanged
+unless the option is specified.  Specifying the option replaces scalar
+values, while slice and map fields are appended to and flag accumulators
+are incremented, starting from their existing values.
 */
 package writ
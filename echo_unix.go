@@ -0,0 +1,56 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package writ
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// disableEcho disables terminal echo for f, returning a func to restore it.
+// If f isn't a terminal, there's no echo to disable, so the returned func is
+// a no-op.
+func disableEcho(f *os.File) (restore func(), err error) {
+	fd := f.Fd()
+	var state syscall.Termios
+	if ioctlTermios(fd, ioctlReadTermios, &state) != nil {
+		return func() {}, nil
+	}
+	noEcho := state
+	noEcho.Lflag &^= syscall.ECHO
+	noEcho.Lflag |= syscall.ICANON | syscall.ISIG
+	err = ioctlTermios(fd, ioctlWriteTermios, &noEcho)
+	if err != nil {
+		return nil, err
+	}
+	return func() { ioctlTermios(fd, ioctlWriteTermios, &state) }, nil
+}
+
+func ioctlTermios(fd uintptr, req uintptr, state *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(unsafe.Pointer(state)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -50,5 +50,5 @@ func Example_basic() {
 	// Available Options:
 	//   --help                    Display this help message and exit
 	//   -v, --verbose             Display verbose output
-	//   -n, --name=ARG            The person or people to greet
+	//   -n, --name=STRING         The person or people to greet
 }
@@ -0,0 +1,78 @@
+// +build go1.18
+
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package writ
+
+import (
+	"strings"
+	"testing"
+)
+
+func newFuzzCommand() *Command {
+	bottom := &Command{Name: "bottom", Aliases: []string{"third"}}
+	bottom.Options = []*Option{
+		{Names: []string{"b", "bottomval"}, Decoder: noopDecoder{}},
+		{Names: []string{"h", "help"}, Decoder: noopDecoder{}, Flag: true},
+	}
+	mid := &Command{Name: "mid", Aliases: []string{"second"}, Subcommands: []*Command{bottom}}
+	mid.Options = []*Option{
+		{Names: []string{"m", "midval"}, Decoder: noopDecoder{}, Plural: true},
+		{Names: []string{"c", "color"}, Decoder: noopDecoder{}, OptionalArg: true},
+	}
+	top := &Command{Name: "top", Subcommands: []*Command{mid}}
+	top.Options = []*Option{
+		{Names: []string{"t", "topval"}, Decoder: noopDecoder{}},
+		{Names: []string{"v", "verbose"}, Decoder: noopDecoder{}, Flag: true, Plural: true},
+	}
+	return top
+}
+
+// FuzzParseArgs splits its input on NUL bytes to produce an arg slice.
+func FuzzParseArgs(f *testing.F) {
+	seeds := []string{
+		"",
+		"-vvv",
+		"--topval=1\x00mid\x00-m\x002\x00bottom\x00-hb3",
+		"second\x00third\x00--\x00-v",
+		"mid\x00-c\x00--color=always\x00-",
+		"-t\x00-v-\x00--bogus",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		var args []string
+		if input != "" {
+			args = strings.Split(input, "\x00")
+		}
+		path, positional, err := ParseArgs(newFuzzCommand(), args)
+		if err != nil {
+			return
+		}
+		if len(path) == 0 || path.First().Name != "top" {
+			t.Errorf("Invalid path.  Args: %q", args)
+		}
+		if positional == nil || len(positional) > len(args) {
+			t.Errorf("Invalid positional args.  Args: %q, Positional: %q", args, positional)
+		}
+	})
+}
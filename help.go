@@ -25,12 +25,31 @@ import (
 	"fmt"
 	"strings"
 	"text/template"
+	"unicode"
 )
 
 var templateFuncs = map[string]interface{}{
-	"formatCommand": formatCommand,
-	"formatOption":  formatOption,
-	"wrapText":      wrapText,
+	"formatArgument":      formatArgument,
+	"formatCommand":       formatCommand,
+	"formatExample":       formatExample,
+	"formatOption":        formatOption,
+	"formatOptionCompact": formatOptionCompact,
+	"formatOptionSep":     formatOptionSep,
+	"optionSynopsis":      optionSynopsis,
+	"wrapHanging":         wrapHanging,
+	"wrapText":            wrapText,
+	"wrapUsage":           wrapUsage,
+}
+
+// TemplateFuncs returns the functions available to the default help template.
+// Custom templates may register them via template.Funcs().  See the Help type
+// for the available functions.
+func TemplateFuncs() template.FuncMap {
+	funcs := make(template.FuncMap)
+	for name, fn := range templateFuncs {
+		funcs[name] = fn
+	}
+	return funcs
 }
 
 // The Help type is used for presentation purposes only, and does not affect
@@ -39,15 +58,100 @@ var templateFuncs = map[string]interface{}{
 // The Command.ExitHelp() and Command.WriteHelp() methods execute the
 // template assigned to the Template field, passing the Command as input.
 // If the Template field is nil, the writ package's default template is used.
+// Command.WriteHelpFor() and Command.WriteHelpForPath() instead inherit the
+// Template of the nearest ancestor command that has one, and
+// Command.SetTemplateRecursive() assigns a Template to an entire command tree.
+//
+// The following functions are available to the default template, and to
+// custom templates that register TemplateFuncs():
+//
+//	formatOption(o *Option) string
+//		Formats o's names and description as a two-column row, wrapped at 80 columns.
+//		If o.Env is set, the description is followed by the variable name, such
+//		as "[$PORT]", unless Help.HideEnv is set.
+//	formatOptionCompact(o *Option) string
+//		Formats o's names on one line, followed by its description indented on
+//		the next line, wrapped at 80 columns.  Used when Help.Compact is set.
+//		Like formatOption, the description includes o.Env unless Help.HideEnv is set.
+//	formatOptionSep(o *Option, sep string) string
+//		Same as formatOption, but joins o's names with sep rather than ", ".
+//	optionSynopsis(o *Option) string
+//		Formats o compactly for usage lines, such as "[-v]" or "[--name NAME]".
+//		Options with a MinValues of 1 or more are required and aren't
+//		bracketed.  Plural options are followed by "...".
+//	formatArgument(name string, description string) string
+//		Formats a positional argument name and description as a two-column row,
+//		wrapped at 80 columns.
+//	formatCommand(c *Command) string
+//		Formats c's name and description as a two-column row, wrapped at 80 columns.
+//	formatExample(e Example) string
+//		Formats e's command line, followed by its description indented on the
+//		next line, wrapped at 80 columns.
+//	wrapText(text string, width int, indent int) string
+//		Wraps text at width runes, indenting continuation lines by indent spaces.
+//	wrapHanging(text string, width int) string
+//		Wraps text at width runes, aligning continuation lines with the second
+//		column of the first line.  The second column starts after the first run
+//		of two or more spaces that follows non-space text.  If the first line has
+//		no second column, continuation lines align with the first line's indentation.
+//	wrapUsage(text string, width int) string
+//		Wraps each line of text at word boundaries so that it fits within width
+//		runes.  Continuation lines align with the text following the line's
+//		"Usage: " (or similar ": ") prefix.  Lines that already fit are unchanged.
 type Help struct {
-	OptionGroups  []OptionGroup
-	CommandGroups []CommandGroup
+	OptionGroups    []OptionGroup
+	CommandGroups   []CommandGroup
+	ArgDescriptions map[string]string // Descriptions for Command.ArgNames, keyed by name
+	Examples        []Example         // Displayed in an "Examples:" section after the command groups
 
 	// Optional
 	Template *template.Template // Used to render output
 	Usage    string             // Short message displayed at the top of output
 	Header   string             // Displayed after Usage
 	Footer   string             // Displayed at the end of output
+	Compact  bool               // Display option descriptions below option names, rather than in a second column
+
+	// ErrorFormat is used by Command.ExitHelp() and Command.WriteError() to
+	// format error messages.  It must contain a single %s verb for the error.
+	// If empty, "\nError: %s\n" is used.
+	ErrorFormat string
+
+	// ShowOptionGroups lists the Names of the OptionGroups to render, such as
+	// to render a "common" group for brief help and every group for detailed
+	// help.  If empty, all OptionGroups are rendered.  An Option may belong to
+	// several OptionGroups.  See VisibleOptionGroups().
+	ShowOptionGroups []string
+
+	// ErrorToStdout causes Command.ExitHelp() to write help output and error
+	// messages to os.Stdout rather than os.Stderr, such as for log collectors
+	// that only capture stdout.  The exit code is unaffected.
+	ErrorToStdout bool
+
+	// HideEnv omits the "[$VAR]" suffix that the formatOption,
+	// formatOptionCompact, and formatOptionSep functions append to the
+	// descriptions of options with an Env.
+	HideEnv bool
+}
+
+const defaultErrorFormat = "\nError: %s\n"
+
+// VisibleOptionGroups returns the OptionGroups selected by ShowOptionGroups,
+// in the order they appear in OptionGroups.  Groups without Options are
+// omitted unless their ShowWhenEmpty field is set, so their headers and
+// footers aren't rendered on their own.  The default template renders these
+// groups.
+func (h Help) VisibleOptionGroups() []OptionGroup {
+	var groups []OptionGroup
+	for _, g := range h.OptionGroups {
+		if len(h.ShowOptionGroups) > 0 && !containsString(h.ShowOptionGroups, g.Name) {
+			continue
+		}
+		if len(g.Options) == 0 && !g.ShowWhenEmpty {
+			continue
+		}
+		groups = append(groups, g)
+	}
+	return groups
 }
 
 // OptionGroup is used to customize help output.  It groups related Options
@@ -58,8 +162,25 @@ type OptionGroup struct {
 
 	// Optional
 	Name   string // Not displayed; for matching purposes within the template
-	Header string // Displayed before the group
+	Header string // Displayed before the group; an empty Header is omitted
 	Footer string // Displayed after the group
+
+	// SuppressHeader omits the Header from help output without clearing it,
+	// such as to hide the "Available Options:" header New() assigns when a
+	// command has a single OptionGroup.
+	SuppressHeader bool
+
+	// ShowWhenEmpty renders the group's Header and Footer even if the group
+	// has no Options, such as for a group whose Footer is a standalone note.
+	// By default, groups without Options are omitted from help output.
+	ShowWhenEmpty bool
+}
+
+// Example is used to customize help output.  It pairs an example command
+// line with a description of what the command line does.
+type Example struct {
+	Command     string
+	Description string // Optional
 }
 
 // CommandGroup is used to customize help output.  It groups related Commands
@@ -75,43 +196,321 @@ type CommandGroup struct {
 }
 
 func formatOption(o *Option) string {
-	var placeholder string
-	if !o.Flag {
-		placeholder = o.Placeholder
-		if placeholder == "" {
-			placeholder = "ARG"
-		}
+	return formatOptionSep(o, ", ")
+}
+
+func formatOptionSep(o *Option, sep string) string {
+	return formatOptionEnv(o, sep, true)
+}
+
+func formatOptionEnv(o *Option, sep string, showEnv bool) string {
+	formatted := fmt.Sprintf("  %-24s  %s", formatOptionNames(o, sep), describeOption(o, showEnv))
+	return wrapText(formatted, 80, 28)
+}
+
+func formatOptionCompact(o *Option) string {
+	return formatOptionCompactEnv(o, true)
+}
+
+func formatOptionCompactEnv(o *Option, showEnv bool) string {
+	names := "  " + formatOptionNames(o, ", ")
+	description := describeOption(o, showEnv)
+	if description == "" {
+		return names
 	}
-	names := ""
+	return names + "\n" + wrapText("      "+description, 80, 6)
+}
+
+func formatOptionNames(o *Option, sep string) string {
+	placeholder := optionPlaceholder(o)
 	short := o.ShortNames()
 	long := o.LongNames()
-	for i, s := range short {
-		names += "-" + s
-		if (i < len(short)-1) || len(long) != 0 {
-			names += ", "
+	style := o.PlaceholderStyle
+	if style == PlaceholderShort && len(short) == 0 {
+		style = PlaceholderDefault
+	}
+
+	shortSep, longSep, longDefaultSep := " ", " ", "="
+	if o.OptionalArg {
+		// Optional arguments must be attached to the option name
+		shortSep, longSep, longDefaultSep = "", "=", "="
+	}
+	attach := func(name string, sep string) string {
+		if o.OptionalArg {
+			return name + "[" + sep + placeholder + "]"
 		}
+		return name + sep + placeholder
 	}
-	if len(long) == 0 && placeholder != "" {
-		names += " " + placeholder
+
+	var names []string
+	for i, s := range short {
+		name := "-" + s
+		last := i == len(short)-1
+		if placeholder != "" && (style == PlaceholderAll || (last && (style == PlaceholderShort || len(long) == 0))) {
+			name = attach(name, shortSep)
+		}
+		names = append(names, name)
 	}
 	for i, l := range long {
-		names += "--" + l
-		if i < len(long)-1 {
-			names += ", "
-		} else if placeholder != "" {
-			names += "=" + placeholder
+		name := "--" + l
+		last := i == len(long)-1
+		if placeholder != "" && style == PlaceholderAll {
+			name = attach(name, longSep)
+		} else if placeholder != "" && style == PlaceholderDefault && last {
+			name = attach(name, longDefaultSep)
 		}
+		names = append(names, name)
+	}
+	return strings.Join(names, sep)
+}
+
+// optionSynopsis formats o compactly for usage lines, such as "[-v]" or
+// "[--name NAME]".
+func optionSynopsis(o *Option) string {
+	name := optionDisplayName(o)
+	placeholder := optionPlaceholder(o)
+	if placeholder != "" {
+		long := strings.HasPrefix(name, "--")
+		switch {
+		case o.OptionalArg && long:
+			name += "[=" + placeholder + "]"
+		case o.OptionalArg:
+			name += "[" + placeholder + "]"
+		default:
+			name += " " + placeholder
+		}
+	}
+	if o.MinValues == 0 {
+		name = "[" + name + "]"
+	}
+	if o.Plural {
+		name += "..."
 	}
+	return name
+}
+
+// optionPlaceholder returns the placeholder displayed for o in help output.
+// If o has no Placeholder, the placeholder is derived from o's Decoder.
+func optionPlaceholder(o *Option) string {
+	if o.Flag {
+		return ""
+	}
+	if o.Placeholder != "" {
+		return o.Placeholder
+	}
+	placeholder := typePlaceholder(o.Decoder)
+	if placeholder == "" {
+		return "ARG"
+	}
+	return placeholder
+}
+
+// optionDefault returns the default value for o, or an empty string if o has
+// no default.  Options that were constructed without a Default field are
+// checked for a wrapping defaulter.
+func optionDefault(o *Option) string {
+	if o.Default != "" {
+		return o.Default
+	}
+	decoder := o.Decoder
+	for {
+		switch d := decoder.(type) {
+		case defaulter:
+			return d.defaultArg
+		case envDefaulter:
+			decoder = d.OptionDecoder
+		case replacingDecoder:
+			decoder = d.OptionDecoder
+		default:
+			return ""
+		}
+	}
+}
+
+// hideEnvFuncs replace the option formatting functions when Help.HideEnv
+// is set.
+var hideEnvFuncs = template.FuncMap{
+	"formatOption": func(o *Option) string {
+		return formatOptionEnv(o, ", ", false)
+	},
+	"formatOptionCompact": func(o *Option) string {
+		return formatOptionCompactEnv(o, false)
+	},
+	"formatOptionSep": func(o *Option, sep string) string {
+		return formatOptionEnv(o, sep, false)
+	},
+}
+
+// describeOption returns o's expanded description, followed by the name of
+// o's environment variable, such as "[$PORT]", if showEnv is set.
+func describeOption(o *Option, showEnv bool) string {
+	description := expandDescription(o)
+	if !showEnv || o.Env == "" {
+		return description
+	}
+	if description != "" {
+		description += " "
+	}
+	return description + "[$" + o.Env + "]"
+}
+
+// expandDescription returns o's description, rendered as a template if o's
+// ExpandDescription field is set.  Templates are checked when o is validated,
+// so if rendering fails, the description is returned as-is.
+func expandDescription(o *Option) string {
+	if !o.ExpandDescription {
+		return o.Description
+	}
+	description, err := renderDescription(o)
+	if err != nil {
+		return o.Description
+	}
+	return description
+}
+
+// renderDescription renders o's description as a template with access to the
+// option's Names, Placeholder, and Default.
+func renderDescription(o *Option) (string, error) {
+	tmpl, err := template.New("Description").Parse(o.Description)
+	if err != nil {
+		return "", err
+	}
+	data := struct {
+		Names       []string
+		Placeholder string
+		Default     string
+	}{o.Names, optionPlaceholder(o), optionDefault(o)}
+	buf := bytes.NewBuffer(nil)
+	err = tmpl.Execute(buf, data)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
 
-	formatted := fmt.Sprintf("  %-24s  %s", names, o.Description)
+func formatArgument(name string, description string) string {
+	if description == "" {
+		return "  " + name
+	}
+	formatted := fmt.Sprintf("  %-24s  %s", name, description)
 	return wrapText(formatted, 80, 28)
 }
 
+func formatExample(e Example) string {
+	if e.Description == "" {
+		return "  " + e.Command
+	}
+	return "  " + e.Command + "\n" + wrapText("      "+e.Description, 80, 6)
+}
+
 func formatCommand(c *Command) string {
-	formatted := fmt.Sprintf("  %-24s  %s", c.Name, c.Description)
+	return formatCommandIndented(c, 0)
+}
+
+// formatCommandIndented is identical to formatCommand, except that c's name
+// is indented by two spaces per depth.
+func formatCommandIndented(c *Command, depth int) string {
+	formatted := fmt.Sprintf("  %-24s  %s", strings.Repeat("  ", depth)+c.Name, c.Description)
 	return wrapText(formatted, 80, 28)
 }
 
+// formatMarkdownCommand formats c's help as Markdown, with a heading at the
+// given level.  If linkSubcommands is set, c's subcommands are linked to
+// their headings.
+func formatMarkdownCommand(c *Command, level int, linkSubcommands bool) string {
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, "%s %s\n", markdownHeading(level), escapeMarkdown(c.fullName()))
+	for _, text := range []string{c.Description, c.LongDescription} {
+		if text != "" {
+			fmt.Fprintf(buf, "\n%s\n", escapeMarkdown(text))
+		}
+	}
+	fmt.Fprintf(buf, "\n```\n%s\n```\n", c.Synopsis())
+
+	var visibleOpts []*Option
+	for _, o := range c.Options {
+		if o.Description != "" {
+			visibleOpts = append(visibleOpts, o)
+		}
+	}
+	if len(visibleOpts) > 0 {
+		fmt.Fprintf(buf, "\n%s Options\n\n", markdownHeading(level+1))
+		buf.WriteString("| Option | Placeholder | Description |\n")
+		buf.WriteString("| --- | --- | --- |\n")
+		for _, o := range visibleOpts {
+			var names []string
+			for _, n := range o.ShortNames() {
+				names = append(names, "`-"+n+"`")
+			}
+			for _, n := range o.LongNames() {
+				names = append(names, "`--"+n+"`")
+			}
+			placeholder := optionPlaceholder(o)
+			if placeholder != "" {
+				placeholder = "`" + placeholder + "`"
+			}
+			description := strings.Replace(escapeMarkdown(describeOption(o, !c.Help.HideEnv)), "\n", " ", -1)
+			fmt.Fprintf(buf, "| %s | %s | %s |\n", strings.Join(names, ", "), placeholder, description)
+		}
+	}
+
+	var visibleSubs []*Command
+	for _, sub := range c.Subcommands {
+		if sub.Description != "" {
+			visibleSubs = append(visibleSubs, sub)
+		}
+	}
+	if len(visibleSubs) > 0 {
+		fmt.Fprintf(buf, "\n%s Commands\n\n", markdownHeading(level+1))
+		for _, sub := range visibleSubs {
+			name := "`" + sub.Name + "`"
+			if linkSubcommands {
+				name = fmt.Sprintf("[%s](#%s)", escapeMarkdown(sub.Name), markdownAnchor(sub.fullName()))
+			}
+			fmt.Fprintf(buf, "- %s: %s\n", name, strings.Replace(escapeMarkdown(sub.Description), "\n", " ", -1))
+		}
+	}
+	return buf.String()
+}
+
+// markdownHeading returns the heading prefix for level, such as "##".
+// Markdown only supports six levels, so deeper levels are clamped to six.
+func markdownHeading(level int) string {
+	if level > 6 {
+		level = 6
+	}
+	return strings.Repeat("#", level)
+}
+
+// markdownAnchor returns the anchor that common Markdown renderers, such as
+// GitHub's, generate for a heading: lower-cased, with spaces replaced by
+// hyphens, and with punctuation other than hyphens and underscores removed.
+func markdownAnchor(heading string) string {
+	var anchor []rune
+	for _, r := range strings.ToLower(heading) {
+		switch {
+		case r == ' ':
+			anchor = append(anchor, '-')
+		case r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			anchor = append(anchor, r)
+		}
+	}
+	return string(anchor)
+}
+
+// escapeMarkdown backslash-escapes the characters in s that Markdown treats
+// as formatting, links, HTML, or table cell separators.
+func escapeMarkdown(s string) string {
+	var escaped []rune
+	for _, r := range s {
+		if strings.ContainsRune("\\`*_[]<>#|~", r) {
+			escaped = append(escaped, '\\')
+		}
+		escaped = append(escaped, r)
+	}
+	return string(escaped)
+}
+
 // This is a pretty naiive implementation, but it's late and I'm tired
 // TODO: cleanup and probably try to wrap on nearest space or punctuation
 func wrapText(s string, width int, indent int) string {
@@ -140,3 +539,95 @@ func wrapText(s string, width int, indent int) string {
 	}
 	return buf.String()
 }
+
+// wrapHanging wraps s at width, computing the continuation indent from the
+// layout of the first line of s.
+func wrapHanging(s string, width int) string {
+	return wrapText(s, width, hangingIndent(s))
+}
+
+// wrapUsage wraps each line of s on spaces so it fits within width, aligning
+// continuation lines after the line's leading "Label: " prefix.  Words longer
+// than the available width are left intact.
+func wrapUsage(s string, width int) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = wrapUsageLine(line, width)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func wrapUsageLine(line string, width int) string {
+	runes := []rune(line)
+	if len(runes) <= width {
+		return line
+	}
+	indent := usageIndent(runes)
+	if indent >= width/2 {
+		indent = 0
+	}
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString(string(runes[:indent]))
+	linelen := indent
+	for _, word := range strings.Fields(string(runes[indent:])) {
+		wordlen := len([]rune(word))
+		if linelen > indent {
+			if linelen+1+wordlen > width {
+				buf.WriteString("\n")
+				buf.WriteString(strings.Repeat(" ", indent))
+				linelen = indent
+			} else {
+				buf.WriteString(" ")
+				linelen++
+			}
+		}
+		buf.WriteString(word)
+		linelen += wordlen
+	}
+	return buf.String()
+}
+
+// usageIndent returns the column following the first ": " in line, provided
+// the text before it is a single label such as "Usage:" or "  or:".  It
+// returns 0 otherwise.
+func usageIndent(line []rune) int {
+	i := 0
+	for i < len(line) && line[i] == ' ' {
+		i++
+	}
+	for i < len(line) && line[i] != ' ' {
+		i++
+	}
+	if i == 0 || line[i-1] != ':' {
+		return 0
+	}
+	for i < len(line) && line[i] == ' ' {
+		i++
+	}
+	return i
+}
+
+// hangingIndent returns the column of the second column on the first line of s,
+// or the first line's indentation if there is no second column.
+func hangingIndent(s string) int {
+	line := []rune(strings.SplitN(s, "\n", 2)[0])
+	i := 0
+	for i < len(line) && line[i] == ' ' {
+		i++
+	}
+	indent := i
+	for i < len(line) {
+		if line[i] != ' ' {
+			i++
+			continue
+		}
+		start := i
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		if i-start >= 2 && i < len(line) {
+			return i
+		}
+	}
+	return indent
+}
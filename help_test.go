@@ -22,9 +22,14 @@ package writ
 
 import (
 	"bytes"
+	"errors"
+	"io"
 	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 	"text/template"
+	"time"
 )
 
 var helpFormattingTests = []struct {
@@ -145,7 +150,7 @@ Available Commands:
 		Rendered: `Usage: test [OPTION]... [ARG]...
 
 Available Options:
-  --opt=ARG                 An option with a reeeeeeeeeeeeeeeeeeeeeeeeeeeeeaaaaa
+  --opt=INT                 An option with a reeeeeeeeeeeeeeeeeeeeeeeeeeeeeaaaaa
                             aaaaallllllyyyyy loooooooooooooooonnnnnnngggggg desc
                             ription
 `,
@@ -159,11 +164,43 @@ Available Options:
 		Rendered: `Usage: test [OPTION]... [ARG]...
 
 Available Options:
-  --opt=ARG                 An option with a
+  --opt=INT                 An option with a
                             new line in the description
 `,
 	},
 
+	{
+		Description: "Option description with template actions",
+		Spec: &struct {
+			Option int  `option:"p, port" description:"Listen on {{.Placeholder}} (default {{.Default}})" expand:"true" placeholder:"PORT" default:"8080"`
+			Env    int  `option:"e" description:"Default {{.Default}} for {{index .Names 0}}" expand:"true" default:"42" env:"WRIT_DESCRIPTION_TEST"`
+			Flag   bool `flag:"f" description:"Flag {{index .Names 0}}" expand:"true"`
+		}{},
+		Rendered: `Usage: test [OPTION]... [ARG]...
+
+Available Options:
+  -p, --port=PORT           Listen on PORT (default 8080)
+  -e INT                    Default 42 for e [$WRIT_DESCRIPTION_TEST]
+  -f                        Flag f
+`,
+	},
+
+	{
+		Description: "Option description with literal template delimiters",
+		Spec: &struct {
+			Format string `option:"format" description:"Format output with a Go template, such as {{.ID}}"`
+			Broken string `option:"broken" description:"An unterminated {{.Name"`
+			Quoted string `option:"quoted" description:"Quote with {{\"{{\"}} and }}" expand:"true"`
+		}{},
+		Rendered: `Usage: test [OPTION]... [ARG]...
+
+Available Options:
+  --format=STRING           Format output with a Go template, such as {{.ID}}
+  --broken=STRING           An unterminated {{.Name
+  --quoted=STRING           Quote with {{ and }}
+`,
+	},
+
 	{
 		Description: "Hidden option",
 		Spec: &struct {
@@ -207,6 +244,1014 @@ func TestHelpFormatting(t *testing.T) {
 	}
 }
 
+var placeholderStyleTests = []struct {
+	Names       []string
+	Style       PlaceholderStyle
+	OptionalArg bool
+	Rendered    string
+}{
+	{Names: []string{"i", "int"}, Style: PlaceholderDefault, Rendered: "-i, --int=INT"},
+	{Names: []string{"i", "I", "int", "Int"}, Style: PlaceholderDefault, Rendered: "-i, -I, --int, --Int=INT"},
+	{Names: []string{"i"}, Style: PlaceholderDefault, Rendered: "-i INT"},
+	{Names: []string{"i", "int"}, Style: PlaceholderShort, Rendered: "-i INT, --int"},
+	{Names: []string{"i", "I", "int"}, Style: PlaceholderShort, Rendered: "-i, -I INT, --int"},
+	{Names: []string{"int"}, Style: PlaceholderShort, Rendered: "--int=INT"},
+	{Names: []string{"i", "int"}, Style: PlaceholderAll, Rendered: "-i INT, --int INT"},
+	{Names: []string{"int", "Int"}, Style: PlaceholderAll, Rendered: "--int INT, --Int INT"},
+	{Names: []string{"i", "int"}, Style: PlaceholderDefault, OptionalArg: true, Rendered: "-i, --int[=INT]"},
+	{Names: []string{"i"}, Style: PlaceholderDefault, OptionalArg: true, Rendered: "-i[INT]"},
+	{Names: []string{"i", "int"}, Style: PlaceholderShort, OptionalArg: true, Rendered: "-i[INT], --int"},
+	{Names: []string{"i", "int"}, Style: PlaceholderAll, OptionalArg: true, Rendered: "-i[INT], --int[=INT]"},
+}
+
+func TestPlaceholderStyles(t *testing.T) {
+	for _, test := range placeholderStyleTests {
+		opt := &Option{Names: test.Names, Placeholder: "INT", PlaceholderStyle: test.Style, OptionalArg: test.OptionalArg}
+		rendered := formatOptionNames(opt, ", ")
+		if rendered != test.Rendered {
+			t.Errorf("Option names rendered incorrectly.  Names: %q, Style: %d, Expected: %q, Received: %q", test.Names, test.Style, test.Rendered, rendered)
+		}
+	}
+}
+
+func TestWriteHelpFor(t *testing.T) {
+	cmd := New("top", &topSpec{})
+	tests := []struct {
+		Path  []string
+		Usage string
+	}{
+		{Path: []string{}, Usage: "Usage: top [OPTION]... [ARG]..."},
+		{Path: []string{"mid"}, Usage: "Usage: top mid [OPTION]... [ARG]..."},
+		{Path: []string{"2nd"}, Usage: "Usage: top mid [OPTION]... [ARG]..."},
+		{Path: []string{"mid", "bottom"}, Usage: "Usage: top mid bottom [OPTION]... [ARG]..."},
+		{Path: []string{"second", "third"}, Usage: "Usage: top mid bottom [OPTION]... [ARG]..."},
+	}
+	for _, test := range tests {
+		buf := bytes.NewBuffer(nil)
+		err := cmd.WriteHelpFor(buf, test.Path...)
+		if err != nil {
+			t.Errorf("Encountered unexpected error writing help.  Path: %q, Error: %s", test.Path, err)
+			continue
+		}
+		if !strings.HasPrefix(buf.String(), test.Usage+"\n") {
+			t.Errorf("Help output invalid.  Path: %q, Expected usage: %q, Received: %q", test.Path, test.Usage, buf.String())
+		}
+	}
+
+	for _, path := range [][]string{{"bogus"}, {"bottom"}, {"mid", "bogus"}, {"mid", "bottom", "mid"}} {
+		buf := bytes.NewBuffer(nil)
+		err := cmd.WriteHelpFor(buf, path...)
+		if err == nil {
+			t.Errorf("Expected an error writing help for an invalid path, but none received.  Path: %q", path)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("Expected no output writing help for an invalid path.  Path: %q, Received: %q", path, buf.String())
+		}
+	}
+}
+
+func TestWriteHelpForPath(t *testing.T) {
+	cmd := New("top", &topSpec{})
+	tests := []struct {
+		Args     []string
+		Expected string
+	}{
+		{
+			Args:     []string{},
+			Expected: "Usage: top [OPTION]... [ARG]...\n\nAvailable Options:\n  -h, --help                help flag on a top-level command\n  -t, --topval=INT          an option on a top-level command\n\nAvailable Commands:\n  mid                       a mid-level command\n",
+		},
+		{
+			Args:     []string{"mid"},
+			Expected: "Usage: top mid [OPTION]... [ARG]...\n\nAvailable Options:\n  -m, --midval=INT          an option on a mid-level command\n  -h, --help                help flag on a mid-level command\n\nGlobal Options:\n  -t, --topval=INT          an option on a top-level command\n\nAvailable Commands:\n  bottom                    a bottom-level command\n",
+		},
+		{
+			Args:     []string{"mid", "bottom"},
+			Expected: "Usage: top mid bottom [OPTION]... [ARG]...\n\nAvailable Options:\n  -b, --bottomval=INT       an option on a bottom-level command\n  -h, --help                help flag on a bottom-level command\n\nGlobal Options:\n  -t, --topval=INT          an option on a top-level command\n  -m, --midval=INT          an option on a mid-level command\n",
+		},
+	}
+	for _, test := range tests {
+		path, _, err := cmd.Decode(test.Args)
+		if err != nil {
+			t.Errorf("Received unexpected error.  Args: %q, Error: %s", test.Args, err)
+			continue
+		}
+		buf := bytes.NewBuffer(nil)
+		err = cmd.WriteHelpForPath(buf, path)
+		if err != nil {
+			t.Errorf("Encountered unexpected error writing help.  Args: %q, Error: %s", test.Args, err)
+			continue
+		}
+		if buf.String() != test.Expected {
+			t.Errorf("Help output invalid.  Args: %q, Expected: %q, Received: %q", test.Args, test.Expected, buf.String())
+		}
+	}
+	if len(cmd.Subcommand("mid").Help.OptionGroups) != 1 {
+		t.Errorf("Expected WriteHelpForPath to leave the command's option groups intact.  Received: %d groups", len(cmd.Subcommand("mid").Help.OptionGroups))
+	}
+}
+
+func TestInheritedHelpTemplate(t *testing.T) {
+	top := template.Must(template.New("top").Parse("top template: {{.Name}}"))
+	mid := template.Must(template.New("mid").Parse("mid template: {{.Name}}"))
+	cmd := New("top", &topSpec{})
+	cmd.Help.Template = top
+	cmd.Subcommand("mid").Subcommand("bottom").Help.Template = mid
+
+	tests := []struct {
+		Args     []string
+		Expected string
+	}{
+		{Args: []string{}, Expected: "top template: top"},
+		{Args: []string{"mid"}, Expected: "top template: mid"},
+		{Args: []string{"mid", "bottom"}, Expected: "mid template: bottom"},
+	}
+	for _, test := range tests {
+		buf := bytes.NewBuffer(nil)
+		err := cmd.WriteHelpFor(buf, test.Args...)
+		if err != nil || buf.String() != test.Expected {
+			t.Errorf("Invalid WriteHelpFor output.  Args: %q, Expected: %q, Received: %q, Error: %v", test.Args, test.Expected, buf.String(), err)
+		}
+
+		path, _, err := cmd.Decode(test.Args)
+		if err != nil {
+			t.Errorf("Received unexpected error.  Args: %q, Error: %s", test.Args, err)
+			continue
+		}
+		buf.Reset()
+		err = cmd.WriteHelpForPath(buf, path)
+		if err != nil || buf.String() != test.Expected {
+			t.Errorf("Invalid WriteHelpForPath output.  Args: %q, Expected: %q, Received: %q, Error: %v", test.Args, test.Expected, buf.String(), err)
+		}
+	}
+	if cmd.Subcommand("mid").Help.Template != nil {
+		t.Errorf("Expected inherited templates to leave the subcommand's Help.Template unset")
+	}
+	for _, test := range tests[1:] {
+		path, _, err := cmd.Decode(test.Args)
+		if err != nil {
+			t.Errorf("Received unexpected error.  Args: %q, Error: %s", test.Args, err)
+			continue
+		}
+		if rendered := path.Last().HelpString(); rendered != test.Expected {
+			t.Errorf("Invalid WriteHelp output for a subcommand.  Args: %q, Expected: %q, Received: %q", test.Args, test.Expected, rendered)
+		}
+	}
+
+	cmd.SetTemplateRecursive(mid)
+	for _, c := range []*Command{cmd, cmd.Subcommand("mid"), cmd.Subcommand("mid").Subcommand("bottom")} {
+		if c.Help.Template != mid {
+			t.Errorf("Expected SetTemplateRecursive to set the template.  Command: %s", c.Name)
+		}
+	}
+	expected := "mid template: mid"
+	if rendered := cmd.Subcommand("mid").HelpString(); rendered != expected {
+		t.Errorf("Invalid help output.  Expected: %q, Received: %q", expected, rendered)
+	}
+}
+
+func TestWriteCommandTree(t *testing.T) {
+	cmd := New("top", &struct {
+		Remote struct {
+			Add struct {
+				Verbose bool `flag:"v" description:"Verbose output"`
+			} `command:"add" description:"Add a remote"`
+			Hidden struct {
+				Nested struct{} `command:"nested" description:"Nested under a hidden command"`
+			} `command:"hidden"`
+			Remove struct{} `command:"remove" description:"Remove a remote"`
+		} `command:"remote" description:"Manage remotes"`
+		Status struct{} `command:"status" description:"Show status"`
+	}{})
+	expected := "  remote                    Manage remotes\n    add                     Add a remote\n    remove                  Remove a remote\n  status                    Show status\n"
+
+	buf := bytes.NewBuffer(nil)
+	err := cmd.WriteCommandTree(buf)
+	if err != nil {
+		t.Errorf("Encountered unexpected error writing command tree.  Error: %s", err)
+		return
+	}
+	if buf.String() != expected {
+		t.Errorf("Invalid command tree.  Expected: %q, Received: %q", expected, buf.String())
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	cmd := New("top", &struct {
+		Verbose bool   `flag:"v, verbose" description:"Display *verbose* output"`
+		Name    string `option:"n, name" description:"The name | alias" env:"WRIT_MARKDOWN_NAME"`
+		Hidden  int    `option:"hidden"`
+		Sub     struct {
+			Level int `option:"l" description:"A <level>"`
+			Deep  struct {
+			} `command:"deep" description:"The deepest command"`
+		} `command:"sub" description:"A sub_command"`
+		HiddenSub struct{} `command:"hidden"`
+	}{})
+	cmd.Description = "A [top] level command"
+	cmd.LongDescription = "Details about\nthe command"
+
+	tests := []struct {
+		Depth    int
+		Rendered string
+	}{
+		{
+			Depth: 0,
+			Rendered: "# top\n\nA \\[top\\] level command\n\nDetails about\nthe command\n\n" +
+				"```\ntop [OPTION]... [ARG]...\n```\n\n" +
+				"## Options\n\n" +
+				"| Option | Placeholder | Description |\n" +
+				"| --- | --- | --- |\n" +
+				"| `-v`, `--verbose` |  | Display \\*verbose\\* output |\n" +
+				"| `-n`, `--name` | `STRING` | The name \\| alias \\[$WRIT\\_MARKDOWN\\_NAME\\] |\n\n" +
+				"## Commands\n\n" +
+				"- `sub`: A sub\\_command\n",
+		},
+		{
+			Depth: 1,
+			Rendered: "# top\n\nA \\[top\\] level command\n\nDetails about\nthe command\n\n" +
+				"```\ntop [OPTION]... [ARG]...\n```\n\n" +
+				"## Options\n\n" +
+				"| Option | Placeholder | Description |\n" +
+				"| --- | --- | --- |\n" +
+				"| `-v`, `--verbose` |  | Display \\*verbose\\* output |\n" +
+				"| `-n`, `--name` | `STRING` | The name \\| alias \\[$WRIT\\_MARKDOWN\\_NAME\\] |\n\n" +
+				"## Commands\n\n" +
+				"- [sub](#top-sub): A sub\\_command\n\n" +
+				"## top sub\n\nA sub\\_command\n\n" +
+				"```\ntop sub [OPTION]... [ARG]...\n```\n\n" +
+				"### Options\n\n" +
+				"| Option | Placeholder | Description |\n" +
+				"| --- | --- | --- |\n" +
+				"| `-l` | `INT` | A \\<level\\> |\n\n" +
+				"### Commands\n\n" +
+				"- `deep`: The deepest command\n",
+		},
+		{
+			Depth: -1,
+			Rendered: "# top\n\nA \\[top\\] level command\n\nDetails about\nthe command\n\n" +
+				"```\ntop [OPTION]... [ARG]...\n```\n\n" +
+				"## Options\n\n" +
+				"| Option | Placeholder | Description |\n" +
+				"| --- | --- | --- |\n" +
+				"| `-v`, `--verbose` |  | Display \\*verbose\\* output |\n" +
+				"| `-n`, `--name` | `STRING` | The name \\| alias \\[$WRIT\\_MARKDOWN\\_NAME\\] |\n\n" +
+				"## Commands\n\n" +
+				"- [sub](#top-sub): A sub\\_command\n\n" +
+				"## top sub\n\nA sub\\_command\n\n" +
+				"```\ntop sub [OPTION]... [ARG]...\n```\n\n" +
+				"### Options\n\n" +
+				"| Option | Placeholder | Description |\n" +
+				"| --- | --- | --- |\n" +
+				"| `-l` | `INT` | A \\<level\\> |\n\n" +
+				"### Commands\n\n" +
+				"- [deep](#top-sub-deep): The deepest command\n\n" +
+				"### top sub deep\n\nThe deepest command\n\n" +
+				"```\ntop sub deep [OPTION]... [ARG]...\n```\n",
+		},
+	}
+	for _, test := range tests {
+		buf := bytes.NewBuffer(nil)
+		err := cmd.WriteMarkdown(buf, test.Depth)
+		if err != nil {
+			t.Errorf("Encountered unexpected error rendering markdown.  Depth: %d, Error: %s", test.Depth, err)
+			continue
+		}
+		if buf.String() != test.Rendered {
+			t.Errorf("\nMarkdown output invalid.  Depth: %d\n===Expected===\n%s\n\n===Received:===\n%s", test.Depth, test.Rendered, buf.String())
+		}
+	}
+}
+
+func TestAddHelpCommand(t *testing.T) {
+	cmd := New("top", &topSpec{})
+	helpCmd := cmd.AddHelpCommand("Display help for a command")
+	if cmd.Subcommand("help") != helpCmd {
+		t.Errorf("Expected help command to be added as a subcommand")
+	}
+	group := cmd.Help.CommandGroups[len(cmd.Help.CommandGroups)-1]
+	if group.Commands[len(group.Commands)-1] != helpCmd {
+		t.Errorf("Expected help command to be added to the last command group")
+	}
+
+	path, positional, err := cmd.Decode([]string{"help", "mid", "bottom"})
+	if err != nil {
+		t.Errorf("Encountered unexpected error decoding help command.  Error: %s", err)
+		return
+	}
+	if path.Last() != helpCmd {
+		t.Errorf("Expected help command to be selected, but got %s instead", path.Last())
+		return
+	}
+	buf := bytes.NewBuffer(nil)
+	err = cmd.WriteHelpFor(buf, positional...)
+	if err != nil {
+		t.Errorf("Encountered unexpected error writing help.  Error: %s", err)
+		return
+	}
+	expected := "Usage: top mid bottom [OPTION]... [ARG]...\n"
+	if !strings.HasPrefix(buf.String(), expected) {
+		t.Errorf("Help output invalid.  Expected usage: %q, Received: %q", expected, buf.String())
+	}
+
+	hidden := New("test", &struct{}{})
+	hidden.AddHelpCommand("")
+	if hidden.Subcommand("help") == nil {
+		t.Errorf("Expected hidden help command to be added as a subcommand")
+	}
+	if len(hidden.Help.CommandGroups) != 0 {
+		t.Errorf("Expected hidden help command to be omitted from command groups")
+	}
+
+	defer func() {
+		r := recover()
+		if r != nil {
+			switch r.(type) {
+			case commandError, optionError:
+				// Intentionally blank
+			default:
+				panic(r)
+			}
+		}
+	}()
+	cmd.AddHelpCommand("Display help for a command")
+	t.Errorf("Expected AddHelpCommand to panic on duplicate help command, but this didn't happen")
+}
+
+var wrapHangingTests = []struct {
+	Text     string
+	Width    int
+	Rendered string
+}{
+	{Text: "short", Width: 10, Rendered: "short"},
+	{Text: "  -o      a long description", Width: 20, Rendered: "  -o      a long des\n          cription"},
+	{Text: "  --output-file  a description\nwith a newline", Width: 40, Rendered: "  --output-file  a description\n                 with a newline"},
+	{Text: "  a single column of text", Width: 15, Rendered: "  a single colu\n  mn of text"},
+}
+
+func TestWrapHanging(t *testing.T) {
+	for _, test := range wrapHangingTests {
+		rendered := wrapHanging(test.Text, test.Width)
+		if rendered != test.Rendered {
+			t.Errorf("Text wrapped incorrectly.  Text: %q, Expected: %q, Received: %q", test.Text, test.Rendered, rendered)
+		}
+	}
+}
+
+var wrapUsageTests = []struct {
+	Text     string
+	Width    int
+	Rendered string
+}{
+	{Text: "Usage: short [OPTION]...", Width: 30, Rendered: "Usage: short [OPTION]..."},
+	{Text: "Usage: cmd [-a] [-b] [--long-option=ARG] FILE", Width: 24, Rendered: "Usage: cmd [-a] [-b]\n       [--long-option=ARG]\n       FILE"},
+	{Text: "Usage: cmd [-a]\n   or: cmd [--long-option=ARG] FILE", Width: 24, Rendered: "Usage: cmd [-a]\n   or: cmd\n       [--long-option=ARG]\n       FILE"},
+	{Text: "cmd [-a] [-b] [-c] [-d]", Width: 10, Rendered: "cmd [-a]\n[-b] [-c]\n[-d]"},
+	{Text: "Usage: cmd [--an-option-longer-than-the-width]", Width: 20, Rendered: "Usage: cmd\n       [--an-option-longer-than-the-width]"},
+}
+
+func TestWrapUsage(t *testing.T) {
+	for _, test := range wrapUsageTests {
+		rendered := wrapUsage(test.Text, test.Width)
+		if rendered != test.Rendered {
+			t.Errorf("Usage wrapped incorrectly.  Text: %q, Expected: %q, Received: %q", test.Text, test.Rendered, rendered)
+		}
+	}
+
+	cmd := New("test", &struct{}{})
+	cmd.Help.Usage = "Usage: test " + strings.Repeat("[--option=ARG] ", 6) + "FILE"
+	expected := "Usage: test [--option=ARG] [--option=ARG] [--option=ARG] [--option=ARG]\n       [--option=ARG] [--option=ARG] FILE\n"
+	if cmd.HelpString() != expected {
+		t.Errorf("Long usage line wrapped incorrectly.  Expected: %q, Received: %q", expected, cmd.HelpString())
+	}
+}
+
+func TestMeta(t *testing.T) {
+	cmd := New("top", &topSpec{})
+	cmd.Meta = map[string]interface{}{"category": "admin"}
+	cmd.Option("topval").Meta = map[string]interface{}{"docs": "https://example.com/topval"}
+	cmd.Help.Template = template.Must(template.New("Help").Parse(`{{.Meta.category}} {{range .Options}}{{with .Meta}}{{.docs}}{{end}}{{end}}`))
+
+	_, _, err := cmd.Decode([]string{"mid", "-t", "1"})
+	if err != nil {
+		t.Errorf("Received unexpected error.  Error: %s", err)
+	}
+	if cmd.Meta["category"] != "admin" {
+		t.Errorf("Command Meta was modified.  Received: %v", cmd.Meta)
+	}
+	expected := "admin https://example.com/topval"
+	if cmd.HelpString() != expected {
+		t.Errorf("Meta not available to help templates.  Expected: %q, Received: %q", expected, cmd.HelpString())
+	}
+}
+
+func TestShowOptionGroups(t *testing.T) {
+	cmd := New("test", &struct {
+		Verbose bool   `flag:"v, verbose" description:"Display verbose output"`
+		Output  string `option:"o, output" description:"Write output to FILE" placeholder:"FILE"`
+		Debug   bool   `flag:"debug" description:"Enable debugging"`
+	}{})
+	cmd.Help.OptionGroups = []OptionGroup{
+		cmd.GroupOptions("verbose", "output"),
+		cmd.GroupOptions("verbose", "output", "debug"),
+	}
+	cmd.Help.OptionGroups[0].Name = "common"
+	cmd.Help.OptionGroups[0].Header = "Common Options:"
+	cmd.Help.OptionGroups[1].Name = "all"
+	cmd.Help.OptionGroups[1].Header = "All Options:"
+	cmd.Help.Usage = ""
+
+	common := "\nCommon Options:\n" +
+		"  -v, --verbose             Display verbose output\n" +
+		"  -o, --output=FILE         Write output to FILE\n"
+	all := "\nAll Options:\n" +
+		"  -v, --verbose             Display verbose output\n" +
+		"  -o, --output=FILE         Write output to FILE\n" +
+		"  --debug                   Enable debugging\n"
+	tests := []struct {
+		Show     []string
+		Rendered string
+	}{
+		{Show: nil, Rendered: common + all},
+		{Show: []string{"common"}, Rendered: common},
+		{Show: []string{"all"}, Rendered: all},
+		{Show: []string{"all", "common"}, Rendered: common + all},
+		{Show: []string{"bogus"}, Rendered: ""},
+	}
+	for _, test := range tests {
+		cmd.Help.ShowOptionGroups = test.Show
+		if cmd.HelpString() != test.Rendered {
+			t.Errorf("Invalid help output.  Show: %q\n===Expected===\n%s\n===Received===\n%s", test.Show, test.Rendered, cmd.HelpString())
+		}
+	}
+	_, _, err := cmd.Decode([]string{"-v", "--debug"})
+	if err != nil {
+		t.Errorf("Received unexpected error.  Error: %s", err)
+	}
+}
+
+func TestEmptyOptionGroups(t *testing.T) {
+	cmd := New("test", &struct {
+		Verbose bool `flag:"v, verbose" description:"Display verbose output"`
+	}{})
+	cmd.Help.Usage = ""
+	cmd.Help.OptionGroups = append(cmd.Help.OptionGroups, OptionGroup{
+		Name:   "experimental",
+		Header: "Experimental Options:",
+		Footer: "Experimental options may change without notice.",
+	})
+
+	options := "\nAvailable Options:\n  -v, --verbose             Display verbose output\n"
+	empty := "\nExperimental Options:\nExperimental options may change without notice.\n"
+	tests := []struct {
+		ShowWhenEmpty bool
+		Compact       bool
+		Rendered      string
+	}{
+		{Rendered: options},
+		{Compact: true, Rendered: "\nAvailable Options:\n  -v, --verbose\n      Display verbose output\n"},
+		{ShowWhenEmpty: true, Rendered: options + empty},
+		{ShowWhenEmpty: true, Compact: true, Rendered: "\nAvailable Options:\n  -v, --verbose\n      Display verbose output\n" + empty},
+	}
+	for _, test := range tests {
+		cmd.Help.OptionGroups[1].ShowWhenEmpty = test.ShowWhenEmpty
+		cmd.Help.Compact = test.Compact
+		if rendered := cmd.HelpString(); rendered != test.Rendered {
+			t.Errorf("Invalid help output.  ShowWhenEmpty: %t, Compact: %t\n===Expected===\n%s\n===Received===\n%s", test.ShowWhenEmpty, test.Compact, test.Rendered, rendered)
+		}
+	}
+
+	cmd.Help.OptionGroups[1].ShowWhenEmpty = false
+	cmd.Help.ShowOptionGroups = []string{"experimental"}
+	if groups := cmd.Help.VisibleOptionGroups(); len(groups) != 0 {
+		t.Errorf("Expected no visible option groups.  Received: %d", len(groups))
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	templateText := `{{range .Options}}{{wrapHanging (printf "  %-8s  %s" (index .Names 0) .Description) 30}}{{"\n"}}{{end}}`
+	tpl := template.Must(template.New("Help").Funcs(TemplateFuncs()).Parse(templateText))
+	cmd := New("test", &struct {
+		Option int `option:"opt" description:"An option with a longer description"`
+	}{})
+	cmd.Help.Template = tpl
+	buf := bytes.NewBuffer(nil)
+	err := cmd.WriteHelp(buf)
+	if err != nil {
+		t.Errorf("Encountered unexpected error running template funcs test.  Error: %s", err)
+		return
+	}
+	expected := "  opt       An option with a l\n            onger description\n"
+	if buf.String() != expected {
+		t.Errorf("Custom help output invalid.  Expected: %q, Received: %q", expected, buf.String())
+	}
+}
+
+func TestHelpString(t *testing.T) {
+	for _, test := range helpFormattingTests {
+		cmd := New("test", test.Spec)
+		if cmd.HelpString() != test.Rendered {
+			t.Errorf("\nHelp string invalid.  Test Description: %s\n===Expected===\n%s\n\n===Received:===\n%s", test.Description, test.Rendered, cmd.HelpString())
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	type describeSpec struct {
+		Verbose bool   `flag:"v, verbose" description:"Display verbose output"`
+		Name    string `option:"n, name" default:"Everyone" description:"The person to greet"`
+		Sub     *struct {
+			Depth int `option:"depth" description:"The depth"`
+		} `command:"sub" description:"A subcommand"`
+	}
+	for _, spec := range []interface{}{describeSpec{Name: "Sam"}, &describeSpec{Name: "Sam"}} {
+		described := Describe("test", spec)
+		expected := New("test", &describeSpec{})
+		for _, cmds := range [][2]*Command{{described, expected}, {described.Subcommand("sub"), expected.Subcommand("sub")}} {
+			dbuf, ebuf := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+			if err := cmds[0].WriteHelp(dbuf); err != nil {
+				t.Errorf("Encountered unexpected error rendering help.  Error: %s", err)
+				continue
+			}
+			if err := cmds[1].WriteHelp(ebuf); err != nil {
+				t.Errorf("Encountered unexpected error rendering help.  Error: %s", err)
+				continue
+			}
+			if dbuf.String() != ebuf.String() {
+				t.Errorf("\nDescribed help output invalid.\n===Expected===\n%s\n\n===Received:===\n%s", ebuf.String(), dbuf.String())
+			}
+		}
+		if described.Option("name").Default != "Everyone" {
+			t.Errorf("Expected described option to record its default.  Received: %q", described.Option("name").Default)
+		}
+		_, _, err := described.Decode([]string{"-v", "--name", "Alex", "sub", "--depth", "2"})
+		if err != nil {
+			t.Errorf("Received unexpected error decoding described command.  Error: %s", err)
+		}
+	}
+
+	spec := &describeSpec{Name: "Sam"}
+	Describe("test", spec)
+	if spec.Name != "Sam" || spec.Sub != nil {
+		t.Errorf("Expected Describe() not to modify the spec.  Name: %q, Sub: %v", spec.Name, spec.Sub)
+	}
+
+	type nestedSpec struct {
+		Depth int `option:"depth" description:"The depth"`
+	}
+	type sharedSubSpec struct {
+		Token  string      `env:"WRIT_DESCRIBE_TEST_TOKEN"`
+		Level  int         `option:"level" description:"The level"`
+		Nested *nestedSpec `command:"nested" description:"A nested subcommand"`
+	}
+	shared := &struct {
+		Sub *sharedSubSpec `command:"sub" description:"A subcommand"`
+	}{Sub: &sharedSubSpec{}}
+	os.Setenv("WRIT_DESCRIBE_TEST_TOKEN", "secret")
+	defer os.Unsetenv("WRIT_DESCRIBE_TEST_TOKEN")
+	described := Describe("test", shared)
+	_, _, err := described.Decode([]string{"sub", "--level", "3", "nested", "--depth", "2"})
+	if err != nil {
+		t.Errorf("Received unexpected error decoding described command.  Error: %s", err)
+	}
+	if shared.Sub.Token != "" || shared.Sub.Level != 0 || shared.Sub.Nested != nil {
+		t.Errorf("Expected Describe() not to modify pointer subcommands or environment fields.  Token: %q, Level: %d, Nested: %v", shared.Sub.Token, shared.Sub.Level, shared.Sub.Nested)
+	}
+
+	for _, invalid := range []interface{}{1, (*describeSpec)(nil), struct {
+		Option int `option:"o" flag:"f"`
+	}{}} {
+		func() {
+			defer func() {
+				if _, ok := recover().(commandError); !ok {
+					t.Errorf("Expected Describe() to panic with a commandError.  Spec: %#v", invalid)
+				}
+			}()
+			Describe("test", invalid)
+		}()
+	}
+}
+
+func TestCompactHelp(t *testing.T) {
+	cmd := New("test", &struct {
+		Verbose bool     `flag:"v, verbose" description:"Display verbose output"`
+		Name    string   `option:"n, name" placeholder:"NAME" description:"The person or people to greet, which is a description long enough to wrap onto a second line"`
+		Sub     struct{} `command:"sub" description:"A subcommand"`
+	}{})
+	cmd.Help.Usage = "Usage: test [OPTION]..."
+	cmd.Help.Compact = true
+	expected := `Usage: test [OPTION]...
+
+Available Options:
+  -v, --verbose
+      Display verbose output
+  -n, --name=NAME
+      The person or people to greet, which is a description long enough to wrap ` + `
+      onto a second line
+
+Available Commands:
+  sub                       A subcommand
+`
+	buf := bytes.NewBuffer(nil)
+	err := cmd.WriteHelp(buf)
+	if err != nil {
+		t.Errorf("Encountered unexpected error rendering compact help.  Error: %s", err)
+		return
+	}
+	if buf.String() != expected {
+		t.Errorf("\nHelp output invalid.\n===Expected===\n%s\n\n===Received:===\n%s", expected, buf.String())
+	}
+}
+
+func TestEnvHelp(t *testing.T) {
+	cmd := New("test", &struct {
+		Port  int    `option:"p, port" description:"The port to listen on" env:"WRIT_HELP_PORT"`
+		Token string `option:"token" env:"WRIT_HELP_TOKEN"`
+		Name  string `option:"n, name" description:"The name to use"`
+	}{})
+	cmd.Help.Usage = "Usage: test [OPTION]..."
+	cmd.Help.OptionGroups[0].Options = append(cmd.Help.OptionGroups[0].Options, cmd.Option("token"))
+
+	tests := []struct {
+		Description string
+		Compact     bool
+		HideEnv     bool
+		Rendered    string
+	}{
+		{
+			Description: "Default",
+			Rendered: `Usage: test [OPTION]...
+
+Available Options:
+  -p, --port=INT            The port to listen on [$WRIT_HELP_PORT]
+  -n, --name=STRING         The name to use
+  --token=STRING            [$WRIT_HELP_TOKEN]
+`,
+		},
+		{
+			Description: "Compact",
+			Compact:     true,
+			Rendered: `Usage: test [OPTION]...
+
+Available Options:
+  -p, --port=INT
+      The port to listen on [$WRIT_HELP_PORT]
+  -n, --name=STRING
+      The name to use
+  --token=STRING
+      [$WRIT_HELP_TOKEN]
+`,
+		},
+		{
+			Description: "Hidden",
+			HideEnv:     true,
+			Rendered: `Usage: test [OPTION]...
+
+Available Options:
+  -p, --port=INT            The port to listen on
+  -n, --name=STRING         The name to use
+  --token=STRING            ` + `
+`,
+		},
+		{
+			Description: "Hidden and compact",
+			Compact:     true,
+			HideEnv:     true,
+			Rendered: `Usage: test [OPTION]...
+
+Available Options:
+  -p, --port=INT
+      The port to listen on
+  -n, --name=STRING
+      The name to use
+  --token=STRING
+`,
+		},
+	}
+	for _, test := range tests {
+		cmd.Help.Compact = test.Compact
+		cmd.Help.HideEnv = test.HideEnv
+		rendered := cmd.HelpString()
+		if rendered != test.Rendered {
+			t.Errorf("\nHelp output invalid.  Test Description: %s\n===Expected===\n%s\n\n===Received:===\n%s", test.Description, test.Rendered, rendered)
+		}
+	}
+
+	// HideEnv applies to custom templates that use TemplateFuncs()
+	cmd.Help.Compact = false
+	cmd.Help.Template = template.Must(template.New("custom").Funcs(TemplateFuncs()).Parse(`{{formatOptionSep (.Option "port") " | "}}`))
+	expected := "  -p | --port=INT           The port to listen on"
+	if rendered := cmd.HelpString(); rendered != expected {
+		t.Errorf("Invalid custom template output with HideEnv.  Expected: %q, Received: %q", expected, rendered)
+	}
+	cmd.Help.HideEnv = false
+	expected = "  -p | --port=INT           The port to listen on [$WRIT_HELP_PORT]"
+	if rendered := cmd.HelpString(); rendered != expected {
+		t.Errorf("Invalid custom template output.  Expected: %q, Received: %q", expected, rendered)
+	}
+}
+
+func TestSuppressOptionGroupHeader(t *testing.T) {
+	cmd := New("test", &struct {
+		Verbose bool `flag:"v, verbose" description:"Display verbose output"`
+	}{})
+	cmd.Help.Usage = "Usage: test [OPTION]..."
+	expected := "Usage: test [OPTION]...\n\n  -v, --verbose             Display verbose output\n"
+
+	cmd.Help.OptionGroups[0].SuppressHeader = true
+	buf := bytes.NewBuffer(nil)
+	err := cmd.WriteHelp(buf)
+	if err != nil {
+		t.Errorf("Encountered unexpected error rendering help.  Error: %s", err)
+		return
+	}
+	if buf.String() != expected {
+		t.Errorf("Invalid help output with a suppressed header.  Expected: %q, Received: %q", expected, buf.String())
+	}
+	if cmd.Help.OptionGroups[0].Header != "Available Options:" {
+		t.Errorf("Expected SuppressHeader to leave the Header intact.  Received: %q", cmd.Help.OptionGroups[0].Header)
+	}
+
+	cmd.Help.OptionGroups[0].SuppressHeader = false
+	cmd.Help.OptionGroups[0].Header = ""
+	buf.Reset()
+	err = cmd.WriteHelp(buf)
+	if err != nil {
+		t.Errorf("Encountered unexpected error rendering help.  Error: %s", err)
+		return
+	}
+	if buf.String() != expected {
+		t.Errorf("Invalid help output with an empty header.  Expected: %q, Received: %q", expected, buf.String())
+	}
+}
+
+func TestTypePlaceholders(t *testing.T) {
+	cmd := New("test", &struct {
+		Int       int               `option:"int"`
+		Uint8     uint8             `option:"uint8"`
+		Float     float32           `option:"float"`
+		String    string            `option:"string" default:"foo"`
+		Strings   []string          `option:"strings"`
+		Map       map[string]string `option:"map"`
+		Reader    io.Reader         `option:"reader"`
+		Readers   []io.ReadCloser   `option:"readers"`
+		Writer    io.WriteCloser    `option:"writer"`
+		Path      string            `option:"path" path:"existing-file"`
+		Dir       string            `option:"dir" path:"existing-dir"`
+		Grouped   int64             `option:"grouped" grouping:","`
+		Size      int64             `option:"size" bytesize:"true"`
+		Custom    customTestOption  `option:"custom"`
+		Explicit  int               `option:"explicit" placeholder:"NUM"`
+		EnvString string            `option:"env" env:"WRIT_PLACEHOLDER_TEST"`
+		Array     [2]float64        `option:"array"`
+	}{})
+	expected := map[string]string{
+		"int":      "INT",
+		"uint8":    "INT",
+		"float":    "FLOAT",
+		"string":   "STRING",
+		"strings":  "STRING",
+		"map":      "KEY=VALUE",
+		"reader":   "FILE",
+		"readers":  "FILE",
+		"writer":   "FILE",
+		"path":     "FILE",
+		"dir":      "DIR",
+		"grouped":  "INT",
+		"size":     "SIZE",
+		"custom":   "ARG",
+		"explicit": "NUM",
+		"env":      "STRING",
+		"array":    "FLOAT,FLOAT",
+	}
+	for name, placeholder := range expected {
+		received := optionPlaceholder(cmd.Option(name))
+		if received != placeholder {
+			t.Errorf("Invalid placeholder.  Option: %s, Expected: %q, Received: %q", name, placeholder, received)
+		}
+	}
+
+	decoders := map[string]OptionDecoder{
+		"DURATION":  NewDurationAsIntDecoder(new(int), time.Second),
+		"KEY=VALUE": NewStructSetDecoder(&struct{}{}),
+		"STRING":    NewStdinFallbackDecoder(NewOptionDecoder(new(string))),
+		"FLOAT":     NewGroupedFloatDecoder(new(float64), ','),
+	}
+	for placeholder, decoder := range decoders {
+		received := optionPlaceholder(&Option{Names: []string{"o"}, Decoder: decoder})
+		if received != placeholder {
+			t.Errorf("Invalid placeholder.  Expected: %q, Received: %q", placeholder, received)
+		}
+	}
+}
+
+func TestOptionSynopsis(t *testing.T) {
+	tests := []struct {
+		Option   *Option
+		Expected string
+	}{
+		{&Option{Names: []string{"v"}, Flag: true}, "[-v]"},
+		{&Option{Names: []string{"v", "verbose"}, Flag: true, Plural: true}, "[--verbose]..."},
+		{&Option{Names: []string{"n", "name"}, Placeholder: "NAME"}, "[--name NAME]"},
+		{&Option{Names: []string{"n"}}, "[-n ARG]"},
+		{&Option{Names: []string{"required"}, Placeholder: "VALUE", MinValues: 1, MaxValues: 1}, "--required VALUE"},
+		{&Option{Names: []string{"I"}, Placeholder: "DIR", Plural: true, MinValues: 1}, "-I DIR..."},
+		{&Option{Names: []string{"c", "color"}, Placeholder: "WHEN", OptionalArg: true}, "[--color[=WHEN]]"},
+		{&Option{Names: []string{"c"}, Placeholder: "WHEN", OptionalArg: true}, "[-c[WHEN]]"},
+	}
+	for _, test := range tests {
+		synopsis := optionSynopsis(test.Option)
+		if synopsis != test.Expected {
+			t.Errorf("Invalid option synopsis.  Names: %q, Expected: %q, Received: %q", test.Option.Names, test.Expected, synopsis)
+		}
+	}
+
+	cmd := New("test", &struct {
+		Verbose bool   `flag:"v"`
+		Name    string `option:"name" placeholder:"NAME"`
+	}{})
+	cmd.Help.Template = template.Must(template.New("Help").Funcs(TemplateFuncs()).Parse(`{{.Name}}{{range .Options}} {{optionSynopsis .}}{{end}}`))
+	buf := bytes.NewBuffer(nil)
+	err := cmd.WriteHelp(buf)
+	if err != nil {
+		t.Errorf("Encountered unexpected error rendering synopsis template.  Error: %s", err)
+		return
+	}
+	if buf.String() != "test [-v] [--name NAME]" {
+		t.Errorf("Invalid synopsis template output.  Expected: %q, Received: %q", "test [-v] [--name NAME]", buf.String())
+	}
+}
+
+func TestFormatOptionSep(t *testing.T) {
+	templateText := `{{range .Options}}{{formatOptionSep . "|"}}{{"\n"}}{{end}}`
+	tpl := template.Must(template.New("Help").Funcs(TemplateFuncs()).Parse(templateText))
+	cmd := New("test", &struct {
+		Option int  `option:"i, I, int" description:"An int option" placeholder:"INT"`
+		Flag   bool `flag:"h, help" description:"Display this text and exit"`
+	}{})
+	cmd.Help.Template = tpl
+	buf := bytes.NewBuffer(nil)
+	err := cmd.WriteHelp(buf)
+	if err != nil {
+		t.Errorf("Encountered unexpected error running separator test.  Error: %s", err)
+		return
+	}
+	expected := "  -i|-I|--int=INT           An int option\n  -h|--help                 Display this text and exit\n"
+	if buf.String() != expected {
+		t.Errorf("Custom help output invalid.  Expected: %q, Received: %q", expected, buf.String())
+	}
+}
+
+func TestArgumentsHelp(t *testing.T) {
+	cmd := New("ln", &struct {
+		Flag bool `flag:"s, symbolic" description:"Make symbolic links"`
+	}{})
+	cmd.ArgNames = []string{"OLD", "NEW"}
+	cmd.Help.ArgDescriptions = map[string]string{"OLD": "The link target"}
+	cmd.Help.Usage = "Usage: " + cmd.Synopsis()
+	buf := bytes.NewBuffer(nil)
+	err := cmd.WriteHelp(buf)
+	if err != nil {
+		t.Errorf("Encountered unexpected error rendering arguments.  Error: %s", err)
+		return
+	}
+	expected := `Usage: ln [OPTION]... OLD NEW
+
+Arguments:
+  OLD                       The link target
+  NEW
+
+Available Options:
+  -s, --symbolic            Make symbolic links
+`
+	if buf.String() != expected {
+		t.Errorf("\nHelp output invalid.\n===Expected===\n%s\n\n===Received:===\n%s", expected, buf.String())
+	}
+}
+
+func TestExamplesHelp(t *testing.T) {
+	cmd := New("ln", &struct {
+		Flag bool `flag:"s, symbolic" description:"Make symbolic links"`
+	}{})
+	cmd.Help.Usage = "Usage: ln [OPTION]... TARGET LINK"
+	cmd.Help.Footer = "Report bugs upstream."
+	cmd.Help.Examples = []Example{
+		{Command: "ln -s foo bar", Description: "Create a symbolic link named bar that points to foo"},
+		{Command: "ln foo bar"},
+	}
+	expected := `Usage: ln [OPTION]... TARGET LINK
+
+Available Options:
+  -s, --symbolic            Make symbolic links
+
+Examples:
+  ln -s foo bar
+      Create a symbolic link named bar that points to foo
+  ln foo bar
+
+Report bugs upstream.
+`
+	buf := bytes.NewBuffer(nil)
+	err := cmd.WriteHelp(buf)
+	if err != nil {
+		t.Errorf("Encountered unexpected error rendering examples.  Error: %s", err)
+		return
+	}
+	if buf.String() != expected {
+		t.Errorf("\nHelp output invalid.\n===Expected===\n%s\n\n===Received:===\n%s", expected, buf.String())
+	}
+
+	cmd.Help.Examples = []Example{}
+	buf.Reset()
+	err = cmd.WriteHelp(buf)
+	if err != nil {
+		t.Errorf("Encountered unexpected error rendering empty examples.  Error: %s", err)
+		return
+	}
+	if strings.Contains(buf.String(), "Examples:") {
+		t.Errorf("Empty examples should render nothing.  Received:\n%s", buf.String())
+	}
+
+	cmd.Help.Examples = []Example{{Command: "ln a b"}, {Command: "ln -s a b"}}
+	cmd.Help.Template = template.Must(template.New("Help").Funcs(TemplateFuncs()).Parse(`{{range .Help.Examples}}{{.Command}};{{end}}`))
+	buf.Reset()
+	err = cmd.WriteHelp(buf)
+	if err != nil {
+		t.Errorf("Encountered unexpected error rendering custom examples template.  Error: %s", err)
+		return
+	}
+	if buf.String() != "ln a b;ln -s a b;" {
+		t.Errorf("Invalid custom template output.  Expected: %q, Received: %q", "ln a b;ln -s a b;", buf.String())
+	}
+}
+
+func TestSynopsis(t *testing.T) {
+	cmd := New("top", &topSpec{})
+	if cmd.Synopsis() != "top [OPTION]... [ARG]..." {
+		t.Errorf("Invalid synopsis.  Expected: %q, Received: %q", "top [OPTION]... [ARG]...", cmd.Synopsis())
+	}
+	bottom := cmd.Subcommand("mid").Subcommand("bottom")
+	bottom.ArgNames = []string{"SOURCE", "[DEST]"}
+	if bottom.Synopsis() != "top mid bottom [OPTION]... SOURCE [DEST]" {
+		t.Errorf("Invalid synopsis.  Expected: %q, Received: %q", "top mid bottom [OPTION]... SOURCE [DEST]", bottom.Synopsis())
+	}
+	manual := &Command{Name: "manual", ArgNames: []string{"FILE"}}
+	if manual.Synopsis() != "manual [OPTION]... FILE" {
+		t.Errorf("Invalid synopsis.  Expected: %q, Received: %q", "manual [OPTION]... FILE", manual.Synopsis())
+	}
+}
+
+func TestDefaultHelpText(t *testing.T) {
+	tpl := template.Must(template.New("Help").Funcs(TemplateFuncs()).Parse(DefaultHelpText))
+	for _, test := range helpFormattingTests {
+		cmd := New("test", test.Spec)
+		cmd.Help.Template = tpl
+		buf := bytes.NewBuffer(nil)
+		err := cmd.WriteHelp(buf)
+		if err != nil {
+			t.Errorf("Encountered unexpecting error running test.  Description: %s, Error: %s", test.Description, err)
+			continue
+		}
+		if buf.String() != test.Rendered {
+			t.Errorf("\nHelp output invalid.  Test Description: %s\n===Expected===\n%s\n\n===Received:===\n%s", test.Description, test.Rendered, buf.String())
+			continue
+		}
+	}
+}
+
+func TestExitHelpOutput(t *testing.T) {
+	tests := []struct {
+		Err         error
+		ErrorFormat string
+		ToStdout    bool
+		Code        int
+		Stdout      string
+		Stderr      string
+	}{
+		{Err: nil, Code: 0, Stdout: "Usage\n", Stderr: ""},
+		{Err: errors.New("bad arg"), Code: 1, Stdout: "", Stderr: "Usage\n\nError: bad arg\n"},
+		{Err: errors.New("bad arg"), ErrorFormat: "mytool: error: %s\n", Code: 1, Stdout: "", Stderr: "Usage\nmytool: error: bad arg\n"},
+		{Err: errors.New("bad arg"), ToStdout: true, Code: 1, Stdout: "Usage\n\nError: bad arg\n", Stderr: ""},
+		{Err: nil, ToStdout: true, Code: 0, Stdout: "Usage\n", Stderr: ""},
+	}
+	for _, test := range tests {
+		cmd := &Command{Name: "test"}
+		cmd.Help.Usage = "Usage"
+		cmd.Help.ErrorFormat = test.ErrorFormat
+		cmd.Help.ErrorToStdout = test.ToStdout
+		stdout, stderr := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+		code := cmd.writeExitHelp(test.Err, stdout, stderr)
+		if code != test.Code {
+			t.Errorf("Invalid exit code.  Err: %v, Expected: %d, Received: %d", test.Err, test.Code, code)
+		}
+		if stdout.String() != test.Stdout {
+			t.Errorf("Invalid stdout output.  Err: %v, Expected: %q, Received: %q", test.Err, test.Stdout, stdout.String())
+		}
+		if stderr.String() != test.Stderr {
+			t.Errorf("Invalid stderr output.  Err: %v, Expected: %q, Received: %q", test.Err, test.Stderr, stderr.String())
+		}
+	}
+}
+
 func TestCustomHelpTemplate(t *testing.T) {
 	templateText := "Custom content!"
 	tpl := template.Must(template.New("Help").Parse(templateText))
@@ -224,6 +1269,44 @@ func TestCustomHelpTemplate(t *testing.T) {
 	}
 }
 
+func TestInvalidDescriptionTemplate(t *testing.T) {
+	for _, description := range []string{"{{.Bogus}}", "{{.Defualt", "{{index .Names 5}}"} {
+		cmd := &Command{Name: "test", Options: []*Option{
+			{Names: []string{"o"}, Decoder: NewOptionDecoder(new(int)), Description: description, ExpandDescription: true},
+		}}
+		func() {
+			defer func() {
+				if _, ok := recover().(optionError); !ok {
+					t.Errorf("Expected an optionError panic validating an invalid description template.  Description: %q", description)
+				}
+			}()
+			cmd.validate()
+		}()
+	}
+
+	err := Validate(&struct {
+		Option int `option:"o" description:"{{.Bogus}}" expand:"true"`
+	}{})
+	if _, ok := err.(optionError); !ok {
+		t.Errorf("Expected an option error for an invalid description template.  Received: %v", err)
+	}
+	err = Validate(&struct {
+		Option int `option:"o" description:"{{.Bogus}}" expand:"yes"`
+	}{})
+	if _, ok := err.(commandError); !ok {
+		t.Errorf("Expected a command error for an invalid expand tag.  Received: %v", err)
+	}
+
+	cmd := New("test", &struct {
+		Option int `option:"o" description:"Default {{.Default}}" expand:"true"`
+	}{})
+	cmd.Option("o").Description = "{{.Bogus}}"
+	help := cmd.HelpString()
+	if !strings.Contains(help, "{{.Bogus}}") {
+		t.Errorf("Expected a description that fails to render to be displayed as-is.  Received: %q", help)
+	}
+}
+
 func TestInvalidHelpTemplate(t *testing.T) {
 	templateText := "{{.Bogus}}"
 	tpl := template.Must(template.New("Help").Parse(templateText))
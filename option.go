@@ -23,10 +23,16 @@ package writ
 import (
 	"fmt"
 	"io"
+	"math"
+	"math/big"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 	"unicode"
 )
 
@@ -56,6 +62,30 @@ func panicOption(format string, values ...interface{}) {
 }
 
 // Option specifies program options and flags.
+//
+// Names that are one rune long are short names, such as "v" for -v, and
+// longer names are long names, such as "verbose" for --verbose.  Names may
+// not be blank, contain spaces, or begin with '-'.  Other characters are
+// permitted, so namespaced names such as "log.level" or "cache/size" are
+// matched as ordinary long names, as in --log.level=debug.
+//
+// If OptionalArg is set, the Option's argument may be omitted, as with
+// getopt_long's optional_argument.  The argument must then be attached to the
+// option name, as in --color=always or -calways.  A separate argument, as in
+// --color always, is never consumed.  If the argument is omitted, the Option's
+// Decoder is called with an empty string.
+//
+// If Placeholder is empty, help output derives a placeholder from the type
+// of the builtin Decoder, such as INT, FLOAT, STRING, FILE, or KEY=VALUE.
+// Other decoders display ARG.
+//
+// If ExpandDescription is set, the Description is rendered as a
+// text/template template in help output, with access to the option's Names,
+// Placeholder, and Default, as in "Listen on {{.Placeholder}} (default
+// {{.Default}})".  The template is checked when the Option is validated, and
+// New() panics if it fails to parse or render.  Within a template, a literal
+// "{{" may be written as {{"{{"}}.  Other descriptions are displayed as-is,
+// even if they contain "{{".
 type Option struct {
 	// Required
 	Names   []string
@@ -63,11 +93,137 @@ type Option struct {
 
 	// Optional
 	Flag        bool   // If set, the Option takes no arguments
+	OptionalArg bool   // If set, the Option's argument is optional (see below)
 	Plural      bool   // If set, the Option may be specified multiple times
 	Description string // Options without descriptions are hidden
 	Placeholder string // Displayed next to option in help output (e.g. FILE)
+
+	// ExpandDescription renders Description as a template (see above).
+	ExpandDescription bool
+
+	// PlaceholderStyle controls which option names display the Placeholder
+	// in help output.  See the PlaceholderStyle type for details.
+	PlaceholderStyle PlaceholderStyle
+
+	// MinValues and MaxValues bound the number of times a Plural option may
+	// be specified, such as the number of values accumulated by a slice
+	// option or the number of times a counting flag is repeated.  Only
+	// occurrences in parsed arguments are counted, not defaults.  A MaxValues
+	// of 0 means there is no upper bound.  Options with a MinValues of 1 or
+	// more are required; if several required options on the selected path
+	// are missing, Decode reports them together in a single error.
+	MinValues int
+	MaxValues int
+
+	// LongDescription is a detailed description for documentation such as
+	// man pages.  It isn't displayed by the default help template.
+	LongDescription string
+
+	// Default and Env record the option's "default" and "env" field tags
+	// for introspection, such as rendering help output.  They are
+	// informational only: defaults are applied by wrapping the Decoder with
+	// NewDefaulter() and NewEnvDefaulter(), as New() does.
+	Default string
+	Env     string
+
+	// Requires and Conflicts list the names of related options on the same
+	// command or its ancestors.  If the option is specified, each option in
+	// Requires must also be specified, and no option in Conflicts may be.
+	// Defaults don't count as being specified.  Unknown names are reported
+	// when the command is validated.
+	Requires  []string
+	Conflicts []string
+
+	// OnRepeat controls how repeated occurrences of a non-Plural option are
+	// handled.  By default, repeating the option is an error.  See the
+	// RepeatMode type for details.
+	OnRepeat RepeatMode
+
+	// BoolWords, if set, allows a Flag to accept an explicit true or false
+	// word when written as --name=value, such as --feature=off.  The name
+	// alone still means true.  The Decoder must be built by
+	// NewFlagDecoder().  See the BoolWords type for details.
+	BoolWords *BoolWords
+
+	// Meta holds arbitrary user data, such as categories or documentation
+	// links for tools built around writ.  The writ package never reads or
+	// modifies Meta.
+	Meta map[string]interface{}
+
+	autoHelp bool
+	source   string
+}
+
+// BoolWords lists the words accepted by a Flag with the BoolWords field set.
+// Words are matched case-insensitively.  A word that isn't listed is an
+// error.
+type BoolWords struct {
+	True  []string
+	False []string
 }
 
+// DefaultBoolWords accepts true/false, on/off, and enabled/disabled.
+var DefaultBoolWords = &BoolWords{
+	True:  []string{"true", "on", "enabled"},
+	False: []string{"false", "off", "disabled"},
+}
+
+// parse returns the truth value of word, or an error listing the accepted
+// words if word isn't recognized.
+func (w *BoolWords) parse(word string) (bool, error) {
+	for _, t := range w.True {
+		if strings.EqualFold(word, t) {
+			return true, nil
+		}
+	}
+	for _, f := range w.False {
+		if strings.EqualFold(word, f) {
+			return false, nil
+		}
+	}
+	accepted := append(append([]string(nil), w.True...), w.False...)
+	return false, fmt.Errorf("value %q is not recognized (accepted values: %s)", word, strings.Join(accepted, ", "))
+}
+
+// PlaceholderStyle controls which of an Option's names display the Option's
+// placeholder in help output.
+type PlaceholderStyle int
+
+// Available PlaceholderStyle values.
+const (
+	// PlaceholderDefault displays the placeholder after the last long name
+	// (--int=INT), or after the last short name if the Option has no long
+	// names (-i INT).
+	PlaceholderDefault PlaceholderStyle = iota
+
+	// PlaceholderShort displays the placeholder after the last short name
+	// (-i INT, --int).  If the Option has no short names, PlaceholderDefault
+	// is used instead.
+	PlaceholderShort
+
+	// PlaceholderAll displays the placeholder after every name
+	// (-i INT, --int INT).
+	PlaceholderAll
+)
+
+// RepeatMode controls how repeated occurrences of a non-Plural Option are
+// handled.  Plural Options always decode every occurrence.
+type RepeatMode int
+
+// Available RepeatMode values.
+const (
+	// RepeatError returns an error when the Option is repeated.
+	RepeatError RepeatMode = iota
+
+	// RepeatKeepFirst ignores repeated occurrences of the Option.  Their
+	// values aren't decoded.
+	RepeatKeepFirst
+
+	// RepeatKeepLast decodes every occurrence of the Option, so the last
+	// occurrence takes precedence, as with --output a --output b.
+	RepeatKeepLast
+)
+
 // ShortNames returns a filtered slice of the names that are exactly one rune in length.
 func (o *Option) ShortNames() []string {
 	var short []string
@@ -90,6 +246,18 @@ func (o *Option) LongNames() []string {
 	return long
 }
 
+// CanonicalName returns the name used to identify o in error messages: the
+// first long name, or the first short name if o has no long names.  The
+// name is returned without its "-" or "--" prefix, so it may be passed to
+// Command.Option() to look up o.
+func (o *Option) CanonicalName() string {
+	long := o.LongNames()
+	if len(long) > 0 {
+		return long[0]
+	}
+	return o.ShortNames()[0]
+}
+
 func (o *Option) String() string {
 	var short, long []string
 	for _, s := range o.ShortNames() {
@@ -122,6 +290,65 @@ func (o *Option) validate() {
 	if o.Decoder == nil {
 		panicOption("Option decoder cannot be nil (option %s)", o.String())
 	}
+	if o.MinValues < 0 || o.MaxValues < 0 {
+		panicOption("Option value bounds cannot be negative (option %s)", o.String())
+	}
+	if o.MaxValues > 0 && o.MaxValues < o.MinValues {
+		panicOption("Option MaxValues cannot be less than MinValues (option %s)", o.String())
+	}
+	if o.OnRepeat < RepeatError || o.OnRepeat > RepeatKeepLast {
+		panicOption("Option OnRepeat value %d is not valid (option %s)", o.OnRepeat, o.String())
+	}
+	if o.Plural && o.OnRepeat != RepeatError {
+		panicOption("Plural options cannot set OnRepeat (option %s)", o.String())
+	}
+	if !o.Plural && (o.MinValues > 1 || o.MaxValues > 1) {
+		panicOption("Option value bounds greater than 1 require the Plural field to be set (option %s)", o.String())
+	}
+	if o.Flag && o.OptionalArg {
+		panicOption("Flags cannot have optional arguments (option %s)", o.String())
+	}
+	if o.Flag && o.Placeholder != "" {
+		panicOption("Flags cannot have placeholders (option %s)", o.String())
+	}
+	if o.BoolWords != nil {
+		o.validateBoolWords()
+	}
+	if o.ExpandDescription {
+		_, err := renderDescription(o)
+		if err != nil {
+			panicOption("invalid description template (option %s): %s", o.String(), err)
+		}
+	}
+	switch o.Decoder.(type) {
+	case flagAccumulator:
+		if !o.Flag {
+			panicOption("Flag accumulators require the Flag field to be set (option %s)", o.String())
+		}
+		if !o.Plural {
+			panicOption("Flag accumulators require the Plural field to be set (option %s)", o.String())
+		}
+	case flagDecoder:
+		if !o.Flag {
+			panicOption("Flag decoders require the Flag field to be set (option %s)", o.String())
+		}
+	}
+}
+
+func (o *Option) validateBoolWords() {
+	if _, ok := o.Decoder.(flagDecoder); !ok || !o.Flag {
+		panicOption("BoolWords require a Flag with a decoder built by NewFlagDecoder (option %s)", o.String())
+	}
+	if len(o.BoolWords.True) == 0 || len(o.BoolWords.False) == 0 {
+		panicOption("BoolWords must list at least one true and one false word (option %s)", o.String())
+	}
+	for _, t := range o.BoolWords.True {
+		for _, f := range o.BoolWords.False {
+			if strings.EqualFold(t, f) {
+				panicOption("BoolWords cannot list %q as both true and false (option %s)", t, o.String())
+			}
+		}
+	}
 }
 
 // OptionDecoder is used for decoding Option arguments.  Every Option must
@@ -131,6 +358,24 @@ type OptionDecoder interface {
 	Decode(arg string) error
 }
 
+// OptionValuer is implemented by OptionDecoders that can report their
+// current value.  Value returns the decoded value, such as an int for an
+// int field, or the option's default if no arguments were decoded.  The
+// builtin decoders implement OptionValuer.  See Command.DecodedValues().
+type OptionValuer interface {
+	Value() interface{}
+}
+
+// decodedValue returns the value reported by decoder, or nil if decoder
+// doesn't implement OptionValuer.
+func decodedValue(decoder OptionDecoder) interface{} {
+	valuer, ok := decoder.(OptionValuer)
+	if !ok {
+		return nil
+	}
+	return valuer.Value()
+}
+
 type decoderFunc func(rval reflect.Value, arg string) error
 
 func decodeInt(rval reflect.Value, arg string) error {
@@ -174,6 +419,22 @@ func decodeString(rval reflect.Value, arg string) error {
 	return nil
 }
 
+// decodeBool decodes values accepted by strconv.ParseBool().  It's used for
+// bool environment fields; bool options use flags instead.
+func decodeBool(rval reflect.Value, arg string) error {
+	v, err := strconv.ParseBool(arg)
+	if err != nil {
+		return err
+	}
+	rval.Set(reflect.ValueOf(v).Convert(rval.Type()))
+	return nil
+}
+
+// decodeComplex decodes complex64 and complex128 values.  It's set in
+// complex.go, since strconv.ParseComplex() requires go 1.15+, and is nil
+// otherwise.
+var decodeComplex decoderFunc
+
 func getDecoderFunc(kind reflect.Kind) decoderFunc {
 	switch kind {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
@@ -182,6 +443,8 @@ func getDecoderFunc(kind reflect.Kind) decoderFunc {
 		return decodeUint
 	case reflect.Float32, reflect.Float64:
 		return decodeFloat
+	case reflect.Complex64, reflect.Complex128:
+		return decodeComplex
 	case reflect.String:
 		return decodeString
 	default:
@@ -194,14 +457,38 @@ func getDecoderFunc(kind reflect.Kind) decoderFunc {
 //
 // 		int, int8, int16, int32, int64, uint, uint8, iunt16, uint32, uint64
 //		float32, float64
+//		complex64, complex128 (go 1.15+)
+//			Argument must be in a format accepted by strconv.ParseComplex, such
+//			as 3+4i.
 //		string, []string
+//		pointers to the int, uint, float, and string types above, such as *int
+//			The pointer is left nil unless the option is decoded, in which case a
+//			new value is allocated.  This distinguishes unset options from zero
+//			values.
+//		arrays of the int, uint, float, and string types above, such as [3]int
+//			Argument must be a comma-separated list with exactly one element per
+//			array entry.  See NewArrayDecoder.
+//		slices of types whose pointers implement OptionDecoder, such as []T where
+//			*T implements OptionDecoder, and []*T
+//			Each argument is decoded into a newly allocated element, which is
+//			appended if decoding succeeds.
 //		map[string]string
 //			Argument must be in key=value format.
 //		io.Reader, io.ReadCloser
-//			Argument must be a path to an existing file, or "-" to specify os.Stdin
+//			Argument must be a path to an existing file, or "-" to specify os.Stdin.
+//			Only one option may use os.Stdin per call to Command.Decode().
+//		[]io.Reader, []io.ReadCloser
+//			Each argument is opened as with io.Reader and appended.  "-" may only be
+//			specified once.  The caller is responsible for closing the files.
 //		io.Writer, io.WriteCloser
 //			Argument will be used to create a new file, or "-" to specify os.Stdout.
 //			If a file already exists at the path specified, it will be overwritten.
+//		slog.Level (go 1.21+)
+//			Argument must be a level name, such as debug or warn, or a number.
+//			See NewSlogLevelDecoder.
+//
+// Types registered with RegisterDecoder() are also supported, and take
+// precedence over the builtin types above.
 func NewOptionDecoder(val interface{}) OptionDecoder {
 	rval := reflect.ValueOf(val)
 	if rval.Kind() != reflect.Ptr {
@@ -215,14 +502,25 @@ func NewOptionDecoder(val interface{}) OptionDecoder {
 	ekind := elem.Kind()
 
 	var decoder OptionDecoder
-	if etype == readerT || etype == readCloserT {
+	factory := registeredDecoder(etype)
+	if factory != nil {
+		decoder = factory(val)
+	} else if etype == readerT || etype == readCloserT {
 		decoder = inputDecoder{elem}
 	} else if etype == writerT || etype == writeCloserT {
 		decoder = outputDecoder{elem}
+	} else if ekind == reflect.Slice && (etype.Elem() == readerT || etype.Elem() == readCloserT) {
+		decoder = inputSliceDecoder{elem}
 	} else if ekind == reflect.Slice && etype.Elem().Kind() == reflect.String {
 		decoder = stringSliceDecoder{rval.Interface().(*[]string)}
 	} else if ekind == reflect.Map && etype.Key().Kind() == reflect.String && etype.Elem().Kind() == reflect.String {
 		decoder = stringMapDecoder{rval.Interface().(*map[string]string)}
+	} else if ekind == reflect.Ptr && getDecoderFunc(etype.Elem().Kind()) != nil {
+		decoder = pointerDecoder{elem, getDecoderFunc(etype.Elem().Kind())}
+	} else if ekind == reflect.Array {
+		decoder = NewArrayDecoder(val)
+	} else if ekind == reflect.Slice && isDecoderElem(etype.Elem()) {
+		decoder = decoderSliceDecoder{elem}
 	} else {
 		decoderFunc := getDecoderFunc(ekind)
 		if decoderFunc != nil {
@@ -235,6 +533,149 @@ func NewOptionDecoder(val interface{}) OptionDecoder {
 	return decoder
 }
 
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[reflect.Type]func(interface{}) OptionDecoder)
+)
+
+// RegisterDecoder registers a factory for building OptionDecoders for values
+// of type t.  NewOptionDecoder() calls the factory with a pointer to the value
+// being decoded, e.g. a *uuid.UUID for t = reflect.TypeOf(uuid.UUID{}).  This
+// allows New() to build options for types that don't implement OptionDecoder.
+// Registering a factory for a type that is already registered replaces the
+// existing factory.
+//
+// RegisterDecoder is safe for concurrent use, but factories should typically
+// be registered in an init() function prior to calling New().
+func RegisterDecoder(t reflect.Type, factory func(interface{}) OptionDecoder) {
+	if t == nil {
+		panicOption("RegisterDecoder called with a nil type")
+	}
+	if factory == nil {
+		panicOption("RegisterDecoder called with a nil factory (type %s)", t)
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[t] = factory
+}
+
+func registeredDecoder(t reflect.Type) func(interface{}) OptionDecoder {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return registry[t]
+}
+
+// pointerDecoder decodes into a newly allocated value, and sets the target
+// pointer to it only if decoding succeeds.
+type pointerDecoder struct {
+	rval        reflect.Value
+	decoderFunc decoderFunc
+}
+
+func (d pointerDecoder) Decode(arg string) error {
+	ptr := reflect.New(d.rval.Type().Elem())
+	err := d.decoderFunc(ptr.Elem(), arg)
+	if err != nil {
+		return err
+	}
+	d.rval.Set(ptr)
+	return nil
+}
+
+func (d pointerDecoder) Value() interface{} {
+	return d.rval.Interface()
+}
+
+// isDecoderElem reports whether decoderSliceDecoder can allocate and decode
+// slice elements of type t.
+func isDecoderElem(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		return t.Implements(decoderT)
+	}
+	return reflect.PtrTo(t).Implements(decoderT)
+}
+
+// decoderSliceDecoder decodes each argument into a new slice element using
+// the element's own OptionDecoder implementation.
+type decoderSliceDecoder struct {
+	rval reflect.Value
+}
+
+func (d decoderSliceDecoder) Decode(arg string) error {
+	etype := d.rval.Type().Elem()
+	var ptr reflect.Value
+	if etype.Kind() == reflect.Ptr {
+		ptr = reflect.New(etype.Elem())
+	} else {
+		ptr = reflect.New(etype)
+	}
+	err := ptr.Interface().(OptionDecoder).Decode(arg)
+	if err != nil {
+		return err
+	}
+	if etype.Kind() == reflect.Ptr {
+		d.rval.Set(reflect.Append(d.rval, ptr))
+	} else {
+		d.rval.Set(reflect.Append(d.rval, ptr.Elem()))
+	}
+	return nil
+}
+
+func (d decoderSliceDecoder) Value() interface{} {
+	return d.rval.Interface()
+}
+
+// NewArrayDecoder builds an OptionDecoder for fixed-size arrays, such as
+// --rgb 255,128,0 for a [3]int.  The val parameter must be a pointer to an
+// array of int, uint, float, or string values.  The argument is split on
+// commas, and each element is trimmed of surrounding whitespace and decoded
+// in turn.  Use \, for a literal comma within an element, and \\ for a
+// literal backslash.  The argument must have exactly as many elements as the
+// array.  The array is only updated if every element decodes successfully.
+func NewArrayDecoder(val interface{}) OptionDecoder {
+	rval := reflect.ValueOf(val)
+	if rval.Kind() != reflect.Ptr || rval.Elem().Kind() != reflect.Array {
+		panicOption("NewArrayDecoder must be called on a pointer to an array")
+	}
+	if rval.IsNil() {
+		panicOption("NewArrayDecoder called on nil pointer")
+	}
+	elem := rval.Elem()
+	if elem.Len() == 0 {
+		panicOption("NewArrayDecoder called on a zero-length array (type %s)", elem.Type())
+	}
+	decoderFunc := getDecoderFunc(elem.Type().Elem().Kind())
+	if decoderFunc == nil {
+		panicOption("no option decoder available for array element type %s", elem.Type().Elem())
+	}
+	return arrayDecoder{elem, decoderFunc}
+}
+
+type arrayDecoder struct {
+	rval        reflect.Value
+	decoderFunc decoderFunc
+}
+
+func (d arrayDecoder) Decode(arg string) error {
+	parts := splitCommaList(arg)
+	if len(parts) != d.rval.Len() {
+		return fmt.Errorf("value %q has %d %s, but exactly %d are required", arg, len(parts), pluralize("element", len(parts)), d.rval.Len())
+	}
+	decoded := reflect.New(d.rval.Type()).Elem()
+	for i, part := range parts {
+		err := d.decoderFunc(decoded.Index(i), strings.TrimSpace(part))
+		if err != nil {
+			return fmt.Errorf("element %d of value %q is invalid: %s", i+1, arg, err)
+		}
+	}
+	d.rval.Set(decoded)
+	return nil
+}
+
+func (d arrayDecoder) Value() interface{} {
+	return d.rval.Interface()
+}
+
 type basicDecoder struct {
 	rval        reflect.Value
 	decoderFunc decoderFunc
@@ -244,6 +685,10 @@ func (d basicDecoder) Decode(arg string) error {
 	return d.decoderFunc(d.rval, arg)
 }
 
+func (d basicDecoder) Value() interface{} {
+	return d.rval.Interface()
+}
+
 type stringSliceDecoder struct {
 	value *[]string
 }
@@ -253,6 +698,122 @@ func (d stringSliceDecoder) Decode(arg string) error {
 	return nil
 }
 
+func (d stringSliceDecoder) Value() interface{} {
+	return *d.value
+}
+
+// NewUniqueStringSliceDecoder builds an OptionDecoder that appends arguments
+// to val, skipping arguments that are already present.  Values are kept in
+// the order they were first seen.  Comparisons are case-sensitive.
+func NewUniqueStringSliceDecoder(val *[]string) OptionDecoder {
+	if val == nil {
+		panicOption("NewUniqueStringSliceDecoder called with a nil pointer")
+	}
+	return uniqueStringSliceDecoder{val, false}
+}
+
+// NewUniqueStringSliceDecoderFold is identical to NewUniqueStringSliceDecoder,
+// except that comparisons are case-insensitive.  The first-seen case of each
+// value is kept.
+func NewUniqueStringSliceDecoderFold(val *[]string) OptionDecoder {
+	if val == nil {
+		panicOption("NewUniqueStringSliceDecoderFold called with a nil pointer")
+	}
+	return uniqueStringSliceDecoder{val, true}
+}
+
+type uniqueStringSliceDecoder struct {
+	value      *[]string
+	ignoreCase bool
+}
+
+func (d uniqueStringSliceDecoder) Decode(arg string) error {
+	for _, v := range *d.value {
+		if v == arg || (d.ignoreCase && strings.EqualFold(v, arg)) {
+			return nil
+		}
+	}
+	*d.value = append(*d.value, arg)
+	return nil
+}
+
+func (d uniqueStringSliceDecoder) Value() interface{} {
+	return *d.value
+}
+
+// NewCountingSliceDecoder builds an OptionDecoder that appends each argument
+// to values and increments count.  Both pointers must be non-nil.  Options
+// using the decoder should be Plural.
+func NewCountingSliceDecoder(values *[]string, count *int) OptionDecoder {
+	if values == nil || count == nil {
+		panicOption("NewCountingSliceDecoder called with a nil pointer")
+	}
+	return countingSliceDecoder{values, count}
+}
+
+type countingSliceDecoder struct {
+	values *[]string
+	count  *int
+}
+
+func (d countingSliceDecoder) Decode(arg string) error {
+	*d.values = append(*d.values, arg)
+	*d.count++
+	return nil
+}
+
+func (d countingSliceDecoder) Value() interface{} {
+	return *d.values
+}
+
+// NewGlobSliceDecoder builds an OptionDecoder that expands glob patterns
+// with filepath.Glob() and appends the matches to val.  Arguments without
+// glob metacharacters are appended unchanged, as are patterns that match no
+// files.  Malformed patterns return an error.
+func NewGlobSliceDecoder(val *[]string) OptionDecoder {
+	if val == nil {
+		panicOption("NewGlobSliceDecoder called with a nil pointer")
+	}
+	return globSliceDecoder{val, false}
+}
+
+// NewStrictGlobSliceDecoder is identical to NewGlobSliceDecoder, except that
+// patterns that match no files return an error.
+func NewStrictGlobSliceDecoder(val *[]string) OptionDecoder {
+	if val == nil {
+		panicOption("NewStrictGlobSliceDecoder called with a nil pointer")
+	}
+	return globSliceDecoder{val, true}
+}
+
+type globSliceDecoder struct {
+	value  *[]string
+	strict bool
+}
+
+func (d globSliceDecoder) Decode(arg string) error {
+	if !strings.ContainsAny(arg, "*?[") {
+		*d.value = append(*d.value, arg)
+		return nil
+	}
+	matches, err := filepath.Glob(arg)
+	if err != nil {
+		return fmt.Errorf("invalid glob pattern %q: %s", arg, err)
+	}
+	if len(matches) == 0 {
+		if d.strict {
+			return fmt.Errorf("glob pattern %q does not match any files", arg)
+		}
+		matches = []string{arg}
+	}
+	*d.value = append(*d.value, matches...)
+	return nil
+}
+
+func (d globSliceDecoder) Value() interface{} {
+	return *d.value
+}
+
 type stringMapDecoder struct {
 	value *map[string]string
 }
@@ -269,6 +830,10 @@ func (d stringMapDecoder) Decode(arg string) error {
 	return nil
 }
 
+func (d stringMapDecoder) Value() interface{} {
+	return *d.value
+}
+
 type inputDecoder struct {
 	rval reflect.Value
 }
@@ -288,6 +853,52 @@ func (d inputDecoder) Decode(arg string) error {
 	return nil
 }
 
+func (d inputDecoder) Value() interface{} {
+	return d.rval.Interface()
+}
+
+func (d inputDecoder) stdinFor(arg string) *os.File {
+	if arg == "-" {
+		return os.Stdin
+	}
+	return nil
+}
+
+type inputSliceDecoder struct {
+	rval reflect.Value
+}
+
+func (d inputSliceDecoder) Decode(arg string) error {
+	var err error
+	var f *os.File
+	if arg == "-" {
+		for i := 0; i < d.rval.Len(); i++ {
+			if d.rval.Index(i).Interface() == os.Stdin {
+				return fmt.Errorf("stdin (-) may only be specified once")
+			}
+		}
+		f = os.Stdin
+	} else {
+		f, err = os.Open(arg)
+	}
+	if err != nil {
+		return err
+	}
+	d.rval.Set(reflect.Append(d.rval, reflect.ValueOf(f).Convert(d.rval.Type().Elem())))
+	return nil
+}
+
+func (d inputSliceDecoder) Value() interface{} {
+	return d.rval.Interface()
+}
+
+func (d inputSliceDecoder) stdinFor(arg string) *os.File {
+	if arg == "-" {
+		return os.Stdin
+	}
+	return nil
+}
+
 type outputDecoder struct {
 	rval reflect.Value
 }
@@ -307,11 +918,19 @@ func (d outputDecoder) Decode(arg string) error {
 	return nil
 }
 
+func (d outputDecoder) Value() interface{} {
+	return d.rval.Interface()
+}
+
 func (d flagAccumulator) Decode(arg string) error {
 	*d.value++
 	return nil
 }
 
+func (d flagAccumulator) Value() interface{} {
+	return *d.value
+}
+
 // NewFlagDecoder builds an OptionDecoder for boolean flag values.  The boolean
 // value is set when the option is decoded.
 func NewFlagDecoder(val *bool) OptionDecoder {
@@ -330,6 +949,10 @@ func (d flagDecoder) Decode(arg string) error {
 	return nil
 }
 
+func (d flagDecoder) Value() interface{} {
+	return *d.value
+}
+
 // NewFlagAccumulator builds an OptionDecoder for int flag values.  The int value
 // is incremented every time the option is decoded.
 func NewFlagAccumulator(val *int) OptionDecoder {
@@ -340,37 +963,890 @@ type flagAccumulator struct {
 	value *int
 }
 
-// OptionDefaulter initializes option values to defaults.  If an OptionDecoder
-// implements the OptionDefaulter interface, its SetDefault() method is called
-// prior to decoding options.
-type OptionDefaulter interface {
-	SetDefault()
-}
-
-// NewDefaulter builds an OptionDecoder that implements OptionDefaulter.
-// SetDefault calls decoder.Decode() with the value of defaultArg.  If the
-// value fails to decode, SetDefault panics.
-func NewDefaulter(decoder OptionDecoder, defaultArg string) OptionDecoder {
-	return defaulter{decoder, defaultArg}
+// NewPromptDecoder builds an OptionDecoder for string values that may be
+// entered interactively, such as passwords.  If the argument is "-", the
+// prompt is written to os.Stderr and a single line is read from os.Stdin with
+// terminal echo disabled.  Otherwise, the argument is used as the value
+// directly.
+//
+// Echo is disabled with the platform's terminal API, without starting other
+// processes.  If os.Stdin isn't a terminal, such as when input is piped, the
+// line is read as-is.  If os.Stdin is a terminal but echo can't be disabled,
+// Decode returns an error rather than reading the value with echo enabled.
+// Reading os.Stdin counts as the option's use of standard input (see
+// NewStdinFallbackDecoder).
+func NewPromptDecoder(val *string, prompt string) OptionDecoder {
+	if val == nil {
+		panicOption("NewPromptDecoder called with a nil pointer")
+	}
+	return promptDecoder{val, prompt, os.Stdin, os.Stderr}
 }
 
-type defaulter struct {
-	OptionDecoder
-	defaultArg string
+type promptDecoder struct {
+	value  *string
+	prompt string
+	in     *os.File
+	out    io.Writer
 }
 
-func (d defaulter) SetDefault() {
-	err := d.Decode(d.defaultArg)
+func (d promptDecoder) Decode(arg string) error {
+	if arg != "-" {
+		*d.value = arg
+		return nil
+	}
+	restore, err := disableEcho(d.in)
 	if err != nil {
-		// Default values should be known correct values, so we panic on error
-		panicOption("error setting default value: decoder rejected arg %q", d.defaultArg)
+		return fmt.Errorf("failed to disable terminal echo: %s", err)
+	}
+	fmt.Fprint(d.out, d.prompt)
+	line, err := readLine(d.in)
+	restore()
+	fmt.Fprintln(d.out)
+	if err != nil {
+		return fmt.Errorf("failed to read value: %s", err)
 	}
+	*d.value = line
+	return nil
 }
 
-// NewEnvDefaulter builds an OptionDecoder that implements OptionDefaulter.
-// SetDefault calls decoder.Decode() with the value of the environment
-// variable named by key.  If the environment variable isn't set or fails to
-// decode, SetDefault checks if decoder implements OptionDefault.  If so,
+func (d promptDecoder) Value() interface{} {
+	return *d.value
+}
+
+func (d promptDecoder) stdinFor(arg string) *os.File {
+	if arg == "-" {
+		return d.in
+	}
+	return nil
+}
+
+// NewStdinFallbackDecoder wraps inner so that an argument of "-" reads the
+// value from os.Stdin.  A single line is read and passed to inner.  Other
+// arguments are passed to inner unmodified.  This allows scripts to supply
+// values such as tokens via a pipe:
+//
+//	echo secret | mytool --token -
+//
+// Standard input may only be read once per call to Command.Decode() or
+// Command.DecodeMap().  If another option, such as an io.Reader option given
+// "-" or another NewStdinFallbackDecoder, already read os.Stdin during the
+// call, an error is returned.  Options that stream their input should use
+// io.Reader fields instead.
+func NewStdinFallbackDecoder(inner OptionDecoder) OptionDecoder {
+	if inner == nil {
+		panicOption("NewStdinFallbackDecoder called with a nil decoder")
+	}
+	return stdinFallbackDecoder{inner, os.Stdin}
+}
+
+type stdinFallbackDecoder struct {
+	inner OptionDecoder
+	in    *os.File
+}
+
+func (d stdinFallbackDecoder) Decode(arg string) error {
+	if arg != "-" {
+		return d.inner.Decode(arg)
+	}
+	line, err := readLine(d.in)
+	if err != nil {
+		return fmt.Errorf("failed to read value from standard input: %s", err)
+	}
+	return d.inner.Decode(line)
+}
+
+func (d stdinFallbackDecoder) Value() interface{} {
+	return decodedValue(d.inner)
+}
+
+func (d stdinFallbackDecoder) stdinFor(arg string) *os.File {
+	if arg == "-" {
+		return d.in
+	}
+	return nil
+}
+
+// NewEnvRefDecoder wraps inner so that an argument of the form "env:NAME"
+// reads the value from the environment variable NAME.  The variable's value
+// is passed to inner, and Decode returns an error if the variable is unset.
+// Other arguments are passed to inner unmodified.  This allows users to keep
+// values such as tokens out of the command line, and out of process listings:
+//
+//	mytool --token env:CI_TOKEN
+//
+// A literal value that begins with "env:" may be escaped with a leading
+// backslash, as in "\env:literal", which passes "env:literal" to inner.
+// Unlike the "env" field tag, the variable is chosen by the user at
+// invocation time.
+func NewEnvRefDecoder(inner OptionDecoder) OptionDecoder {
+	if inner == nil {
+		panicOption("NewEnvRefDecoder called with a nil decoder")
+	}
+	return envRefDecoder{inner}
+}
+
+const envRefPrefix = "env:"
+
+type envRefDecoder struct {
+	inner OptionDecoder
+}
+
+func (d envRefDecoder) Decode(arg string) error {
+	if strings.HasPrefix(arg, `\`+envRefPrefix) {
+		return d.inner.Decode(arg[1:])
+	}
+	if !strings.HasPrefix(arg, envRefPrefix) {
+		return d.inner.Decode(arg)
+	}
+	name := arg[len(envRefPrefix):]
+	if name == "" {
+		return fmt.Errorf("value %q must name an environment variable", arg)
+	}
+	value, present := os.LookupEnv(name)
+	if !present {
+		return fmt.Errorf("environment variable %s is not set", name)
+	}
+	return d.inner.Decode(value)
+}
+
+func (d envRefDecoder) Value() interface{} {
+	return decodedValue(d.inner)
+}
+
+// readLine reads a single line from r, without the trailing line ending.  It
+// reads a byte at a time to avoid consuming input past the end of the line.
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if buf[0] == '\n' {
+				break
+			}
+			line = append(line, buf[0])
+		}
+		if err == io.EOF && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSuffix(string(line), "\r"), nil
+}
+
+// PathMode selects the checks performed by NewPathDecoder().  Modes may be
+// combined with bitwise OR.
+type PathMode int
+
+// Available PathMode values.
+const (
+	PathMustExist       PathMode = 1 << iota // The path must exist
+	PathMustBeDir                            // The path must be an existing directory
+	PathMustBeFile                           // The path must exist and must not be a directory
+	PathParentMustExist                      // The path's parent directory must exist
+)
+
+// NewPathDecoder builds an OptionDecoder for file paths.  The argument is
+// checked according to mode, and stored in val unmodified.  The path is not
+// opened, so the checks are advisory: the file system may change before the
+// application uses the path.
+func NewPathDecoder(val *string, mode PathMode) OptionDecoder {
+	if val == nil {
+		panicOption("NewPathDecoder called with a nil pointer")
+	}
+	return pathDecoder{val, mode}
+}
+
+type pathDecoder struct {
+	value *string
+	mode  PathMode
+}
+
+func (d pathDecoder) Decode(arg string) error {
+	if arg == "" {
+		return fmt.Errorf("path must not be empty")
+	}
+	if d.mode&(PathMustExist|PathMustBeDir|PathMustBeFile) != 0 {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return fmt.Errorf("path %q does not exist", arg)
+		}
+		if d.mode&PathMustBeDir != 0 && !info.IsDir() {
+			return fmt.Errorf("path %q is not a directory", arg)
+		}
+		if d.mode&PathMustBeFile != 0 && info.IsDir() {
+			return fmt.Errorf("path %q is a directory", arg)
+		}
+	}
+	if d.mode&PathParentMustExist != 0 {
+		info, err := os.Stat(filepath.Dir(arg))
+		if err != nil || !info.IsDir() {
+			return fmt.Errorf("parent directory of path %q does not exist", arg)
+		}
+	}
+	*d.value = arg
+	return nil
+}
+
+func (d pathDecoder) Value() interface{} {
+	return *d.value
+}
+
+// CaseMode selects the case conversion performed by NewCaseStringDecoder().
+type CaseMode int
+
+// Available CaseMode values.
+const (
+	CaseNone  CaseMode = iota // Values are stored unmodified
+	CaseLower                 // Values are converted to lower case
+	CaseUpper                 // Values are converted to upper case
+	CaseTitle                 // The first letter of each word is upper-cased and the rest are lower-cased
+)
+
+// NewCaseStringDecoder builds an OptionDecoder for string values that
+// converts each value's case according to mode before storing it in val.
+// For example, with CaseLower, "--env PROD" stores "prod".  Whitespace is
+// preserved.
+func NewCaseStringDecoder(val *string, mode CaseMode) OptionDecoder {
+	if val == nil {
+		panicOption("NewCaseStringDecoder called with a nil pointer")
+	}
+	if mode < CaseNone || mode > CaseTitle {
+		panicOption("NewCaseStringDecoder called with an invalid mode %d", mode)
+	}
+	return caseStringDecoder{val, mode}
+}
+
+type caseStringDecoder struct {
+	value *string
+	mode  CaseMode
+}
+
+func (d caseStringDecoder) Decode(arg string) error {
+	switch d.mode {
+	case CaseLower:
+		arg = strings.ToLower(arg)
+	case CaseUpper:
+		arg = strings.ToUpper(arg)
+	case CaseTitle:
+		arg = titleCase(arg)
+	}
+	*d.value = arg
+	return nil
+}
+
+func (d caseStringDecoder) Value() interface{} {
+	return *d.value
+}
+
+// titleCase upper-cases the first letter of each space-separated word in s
+// and lower-cases the remaining letters.
+func titleCase(s string) string {
+	runes := []rune(s)
+	start := true
+	for i, r := range runes {
+		if unicode.IsSpace(r) {
+			start = true
+			continue
+		}
+		if start {
+			runes[i] = unicode.ToTitle(r)
+		} else {
+			runes[i] = unicode.ToLower(r)
+		}
+		start = false
+	}
+	return string(runes)
+}
+
+// NewDurationAsIntDecoder builds an OptionDecoder that parses arguments with
+// time.ParseDuration() and stores the duration in val as a whole number of
+// units.  For example, with a unit of time.Second, "2m" is stored as 120.
+// Durations that aren't a whole number of units return an error.
+func NewDurationAsIntDecoder(val *int, unit time.Duration) OptionDecoder {
+	if val == nil {
+		panicOption("NewDurationAsIntDecoder called with a nil pointer")
+	}
+	if unit <= 0 {
+		panicOption("NewDurationAsIntDecoder unit must be positive")
+	}
+	return durationAsIntDecoder{val, unit}
+}
+
+type durationAsIntDecoder struct {
+	value *int
+	unit  time.Duration
+}
+
+func (d durationAsIntDecoder) Decode(arg string) error {
+	duration, err := time.ParseDuration(arg)
+	if err != nil {
+		return fmt.Errorf("value %q is not a valid duration (e.g. 30s, 5m, 1h30m)", arg)
+	}
+	if duration%d.unit != 0 {
+		return fmt.Errorf("duration %q is not a whole number of %s units", arg, d.unit)
+	}
+	*d.value = int(duration / d.unit)
+	return nil
+}
+
+func (d durationAsIntDecoder) Value() interface{} {
+	return *d.value
+}
+
+// NewGroupedIntDecoder builds an OptionDecoder for int values that may
+// contain a digit grouping separator, such as "1,000" with a sep of ','.
+// Each separator must fall between two digits, so "1,,000" and ",100" are
+// rejected.  Groups aren't required to have a particular size.  Once the
+// separators are removed, the value is decoded as with NewOptionDecoder().
+// The sep must not be a digit or a sign.
+func NewGroupedIntDecoder(val *int, sep rune) OptionDecoder {
+	if val == nil {
+		panicOption("NewGroupedIntDecoder called with a nil pointer")
+	}
+	return newGroupedDecoder(reflect.ValueOf(val).Elem(), sep)
+}
+
+// NewGroupedFloatDecoder is the float64 counterpart of NewGroupedIntDecoder.
+// A leading sign is permitted, as with "-1,000.5".  Separators are only
+// permitted in the integer part of the value; the fraction and exponent
+// must not contain separators.  The decimal point is always '.', so sep must
+// not be '.'.
+func NewGroupedFloatDecoder(val *float64, sep rune) OptionDecoder {
+	if val == nil {
+		panicOption("NewGroupedFloatDecoder called with a nil pointer")
+	}
+	return newGroupedDecoder(reflect.ValueOf(val).Elem(), sep)
+}
+
+// newGroupedDecoder builds a groupedDecoder for rval, which must be an int,
+// uint, or float kind.
+func newGroupedDecoder(rval reflect.Value, sep rune) OptionDecoder {
+	if !groupableKind(rval.Kind()) {
+		panicOption("grouped decoders require an int, uint, or float type, not %s", rval.Type())
+	}
+	decoderFunc := getDecoderFunc(rval.Kind())
+	if unicode.IsDigit(sep) || sep == '-' || sep == '+' {
+		panicOption("grouping separator %q must not be a digit or sign", sep)
+	}
+	float := rval.Kind() == reflect.Float32 || rval.Kind() == reflect.Float64
+	if float && sep == '.' {
+		panicOption("grouping separator %q conflicts with the decimal point", sep)
+	}
+	return groupedDecoder{rval, decoderFunc, sep}
+}
+
+// groupableKind reports whether values of kind k may be decoded with digit
+// grouping separators.
+func groupableKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+type groupedDecoder struct {
+	rval        reflect.Value
+	decoderFunc decoderFunc
+	sep         rune
+}
+
+func (d groupedDecoder) Decode(arg string) error {
+	runes := []rune(arg)
+	stripped := make([]rune, 0, len(runes))
+	fraction := false
+	for i, r := range runes {
+		if r != d.sep {
+			if !unicode.IsDigit(r) {
+				fraction = fraction || i > 0
+			}
+			stripped = append(stripped, r)
+			continue
+		}
+		if fraction || i == 0 || i == len(runes)-1 || !unicode.IsDigit(runes[i-1]) || !unicode.IsDigit(runes[i+1]) {
+			return fmt.Errorf("value %q has a misplaced %q separator", arg, d.sep)
+		}
+	}
+	return d.decoderFunc(d.rval, string(stripped))
+}
+
+func (d groupedDecoder) Value() interface{} {
+	return d.rval.Interface()
+}
+
+// NewBaseIntDecoder builds an OptionDecoder for integer values in the given
+// base.  The val parameter must be a pointer to an int or uint type, such as
+// *int or *uint32.  With a base of 0, the base is implied by the argument's
+// prefix: "0x" for hexadecimal, "0o" or "0" for octal, "0b" for binary, and
+// base 10 otherwise, as with strconv.ParseInt().  Otherwise, base must be
+// between 2 and 36.  Values that overflow the target type return an error.
+func NewBaseIntDecoder(val interface{}, base int) OptionDecoder {
+	rval := reflect.ValueOf(val)
+	if rval.Kind() != reflect.Ptr || rval.IsNil() {
+		panicOption("NewBaseIntDecoder must be called on a non-nil pointer")
+	}
+	if base != 0 && (base < 2 || base > 36) {
+		panicOption("NewBaseIntDecoder base must be 0 or between 2 and 36, not %d", base)
+	}
+	switch rval.Elem().Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		panicOption("NewBaseIntDecoder requires an integer type, not %s", rval.Elem().Type())
+	}
+	return baseIntDecoder{rval.Elem(), base}
+}
+
+type baseIntDecoder struct {
+	rval reflect.Value
+	base int
+}
+
+func (d baseIntDecoder) Decode(arg string) error {
+	switch d.rval.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(arg, d.base, 64)
+		if err != nil {
+			return err
+		}
+		if d.rval.OverflowUint(v) {
+			return fmt.Errorf("value %d would overflow %s", v, d.rval.Kind())
+		}
+		d.rval.SetUint(v)
+	default:
+		v, err := strconv.ParseInt(arg, d.base, 64)
+		if err != nil {
+			return err
+		}
+		if d.rval.OverflowInt(v) {
+			return fmt.Errorf("value %d would overflow %s", v, d.rval.Kind())
+		}
+		d.rval.SetInt(v)
+	}
+	return nil
+}
+
+func (d baseIntDecoder) Value() interface{} {
+	return d.rval.Interface()
+}
+
+// NewByteSizeDecoder builds an OptionDecoder for byte sizes with optional
+// unit suffixes, such as "512", "10MB", or "1.5GiB".  The size is stored in
+// val as a number of bytes.  Decimal units (KB, MB, GB, TB, PB, EB) are
+// powers of 1000, and binary units (KiB, MiB, GiB, TiB, PiB, EiB) are powers
+// of 1024.  Units are matched case-insensitively, and a "B" suffix or no
+// suffix denotes bytes.  Fractional sizes are accepted if they amount to a
+// whole number of bytes.  Negative sizes and sizes that overflow an int64
+// return an error.
+func NewByteSizeDecoder(val *int64) OptionDecoder {
+	if val == nil {
+		panicOption("NewByteSizeDecoder called with a nil pointer")
+	}
+	return byteSizeDecoder{val}
+}
+
+// byteSizeUnits maps lower-cased unit suffixes to their sizes in bytes.
+var byteSizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"pb":  1e15,
+	"eb":  1e18,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"pib": 1 << 50,
+	"eib": 1 << 60,
+}
+
+type byteSizeDecoder struct {
+	value *int64
+}
+
+func (d byteSizeDecoder) Decode(arg string) error {
+	trimmed := strings.TrimSpace(arg)
+	i := strings.IndexFunc(trimmed, unicode.IsLetter)
+	if i < 0 {
+		i = len(trimmed)
+	}
+	number, unit := strings.TrimSpace(trimmed[:i]), trimmed[i:]
+	multiplier, present := byteSizeUnits[strings.ToLower(unit)]
+	if !present {
+		return fmt.Errorf("value %q has an unrecognized size unit %q (e.g. KB, MiB, GB)", arg, unit)
+	}
+	size, ok := new(big.Rat).SetString(number)
+	if !ok || strings.Contains(number, "/") {
+		return fmt.Errorf("value %q is not a valid size (e.g. 512, 10MB, 1.5GiB)", arg)
+	}
+	if size.Sign() < 0 {
+		return fmt.Errorf("size %q must not be negative", arg)
+	}
+	size.Mul(size, new(big.Rat).SetInt64(multiplier))
+	if !size.IsInt() {
+		return fmt.Errorf("size %q is not a whole number of bytes", arg)
+	}
+	if size.Num().Cmp(big.NewInt(math.MaxInt64)) > 0 {
+		return fmt.Errorf("size %q would overflow int64", arg)
+	}
+	*d.value = size.Num().Int64()
+	return nil
+}
+
+func (d byteSizeDecoder) Value() interface{} {
+	return *d.value
+}
+
+// NewFlagSetDecoder builds an OptionDecoder for comma-separated lists of
+// values, such as --features=a,b,c.  Each value must match one of the allowed
+// values.  Values are appended to the target slice in the order given,
+// skipping values that are already present.  As with NewArrayDecoder(), \,
+// denotes a literal comma within a value.
+func NewFlagSetDecoder(val *[]string, allowed ...string) OptionDecoder {
+	if val == nil {
+		panicOption("NewFlagSetDecoder called with a nil pointer")
+	}
+	if len(allowed) == 0 {
+		panicOption("NewFlagSetDecoder requires at least one allowed value")
+	}
+	return flagSetDecoder{val, allowed}
+}
+
+type flagSetDecoder struct {
+	value   *[]string
+	allowed []string
+}
+
+func (d flagSetDecoder) Decode(arg string) error {
+	values := splitCommaList(arg)
+	for _, v := range values {
+		if !containsString(d.allowed, v) {
+			return fmt.Errorf("value %q is not valid (allowed values: %s)", v, strings.Join(d.allowed, ", "))
+		}
+	}
+	for _, v := range values {
+		if !containsString(*d.value, v) {
+			*d.value = append(*d.value, v)
+		}
+	}
+	return nil
+}
+
+func (d flagSetDecoder) Value() interface{} {
+	return *d.value
+}
+
+// NewBitmaskDecoder builds an OptionDecoder for comma-separated lists of
+// named bits, such as --perms=read,write.  Each name must be present in the
+// bits map.  The bit values for each name are OR'ed into the target int.
+func NewBitmaskDecoder(val *int, bits map[string]int) OptionDecoder {
+	if val == nil {
+		panicOption("NewBitmaskDecoder called with a nil pointer")
+	}
+	if len(bits) == 0 {
+		panicOption("NewBitmaskDecoder requires at least one named bit")
+	}
+	return bitmaskDecoder{val, bits}
+}
+
+type bitmaskDecoder struct {
+	value *int
+	bits  map[string]int
+}
+
+func (d bitmaskDecoder) Decode(arg string) error {
+	mask := 0
+	for _, v := range splitCommaList(arg) {
+		bit, present := d.bits[v]
+		if !present {
+			var names []string
+			for name := range d.bits {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("value %q is not valid (allowed values: %s)", v, strings.Join(names, ", "))
+		}
+		mask |= bit
+	}
+	*d.value |= mask
+	return nil
+}
+
+func (d bitmaskDecoder) Value() interface{} {
+	return *d.value
+}
+
+// NewStructSetDecoder builds an OptionDecoder for key=value arguments that set
+// fields on the target struct, such as --set server.port=8080.  The key is a
+// dot-separated path of field names, which are matched case-insensitively.
+// Nested struct fields are traversed, and nil pointers to structs are
+// allocated as needed.  The value is decoded into the leaf field with the
+// decoder returned by NewOptionDecoder(), or with the field's own Decode()
+// method if it implements OptionDecoder.  Unknown paths and unexported fields
+// result in an error.  The target must be a pointer to a struct.
+func NewStructSetDecoder(target interface{}) OptionDecoder {
+	rval := reflect.ValueOf(target)
+	if rval.Kind() != reflect.Ptr || rval.IsNil() || rval.Elem().Kind() != reflect.Struct {
+		panicOption("NewStructSetDecoder must be called on a non-nil pointer to a struct")
+	}
+	return structSetDecoder{rval.Elem()}
+}
+
+type structSetDecoder struct {
+	rval reflect.Value
+}
+
+func (d structSetDecoder) Decode(arg string) error {
+	keyval := strings.SplitN(arg, "=", 2)
+	if len(keyval) != 2 {
+		return fmt.Errorf("argument %q is not in key=value format", arg)
+	}
+	field := d.rval
+	for _, name := range strings.Split(keyval[0], ".") {
+		for field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				if field.Type().Elem().Kind() != reflect.Struct {
+					break
+				}
+				field.Set(reflect.New(field.Type().Elem()))
+			}
+			field = field.Elem()
+		}
+		if field.Kind() != reflect.Struct {
+			return fmt.Errorf("field %q not found", keyval[0])
+		}
+		next, ok := findStructField(field, name)
+		if !ok {
+			return fmt.Errorf("field %q not found", keyval[0])
+		}
+		field = next
+	}
+	return decodeStructField(field, keyval[0], keyval[1])
+}
+
+func (d structSetDecoder) Value() interface{} {
+	return d.rval.Interface()
+}
+
+// findStructField returns the exported field of rval whose name matches name,
+// ignoring case.
+func findStructField(rval reflect.Value, name string) (reflect.Value, bool) {
+	for i := 0; i < rval.NumField(); i++ {
+		field := rval.Type().Field(i)
+		if field.PkgPath == "" && strings.EqualFold(field.Name, name) {
+			return rval.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func decodeStructField(field reflect.Value, path string, arg string) (err error) {
+	if field.Addr().Type().Implements(decoderT) {
+		return field.Addr().Interface().(OptionDecoder).Decode(arg)
+	}
+	defer func() {
+		r := recover()
+		if r != nil {
+			_, ok := r.(optionError)
+			if !ok {
+				panic(r)
+			}
+			err = fmt.Errorf("field %q cannot be set (type %s)", path, field.Type())
+		}
+	}()
+	return NewOptionDecoder(field.Addr().Interface()).Decode(arg)
+}
+
+// splitCommaList splits a comma-separated argument into its values.  Within
+// a value, \, denotes a literal comma and \\ a literal backslash.  Backslashes
+// before any other character are kept as-is.
+func splitCommaList(arg string) []string {
+	var values []string
+	value := make([]byte, 0, len(arg))
+	for i := 0; i < len(arg); i++ {
+		switch {
+		case arg[i] == '\\' && i+1 < len(arg) && (arg[i+1] == ',' || arg[i+1] == '\\'):
+			i++
+			value = append(value, arg[i])
+		case arg[i] == ',':
+			values = append(values, string(value))
+			value = value[:0]
+		default:
+			value = append(value, arg[i])
+		}
+	}
+	return append(values, string(value))
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// stdinReader is implemented by decoders that read from an input file, such
+// as os.Stdin, for some arguments.  Each input file may only be used by one
+// option per call to Command.Decode() or Command.DecodeMap().
+type stdinReader interface {
+	// stdinFor returns the input file read when decoding arg, or nil if arg
+	// doesn't read an input file.
+	stdinFor(arg string) *os.File
+}
+
+// stdinInput returns the input file read by decoder for arg, or nil if
+// decoder doesn't read one.  Wrapping decoders are unwrapped to find a
+// stdinReader.
+func stdinInput(decoder OptionDecoder, arg string) *os.File {
+	switch d := decoder.(type) {
+	case defaulter:
+		return stdinInput(d.OptionDecoder, arg)
+	case envDefaulter:
+		return stdinInput(d.OptionDecoder, arg)
+	case replacingDecoder:
+		return stdinInput(d.OptionDecoder, arg)
+	case envRefDecoder:
+		return stdinInput(d.inner, arg)
+	case stdinReader:
+		return d.stdinFor(arg)
+	}
+	return nil
+}
+
+// typePlaceholder returns the help placeholder for the type decoded by
+// decoder, or an empty string if decoder isn't a builtin decoder.  Defaulters
+// are unwrapped to find the underlying decoder.
+func typePlaceholder(decoder OptionDecoder) string {
+	switch d := decoder.(type) {
+	case defaulter:
+		return typePlaceholder(d.OptionDecoder)
+	case envDefaulter:
+		return typePlaceholder(d.OptionDecoder)
+	case replacingDecoder:
+		return typePlaceholder(d.OptionDecoder)
+	case stdinFallbackDecoder:
+		return typePlaceholder(d.inner)
+	case envRefDecoder:
+		return typePlaceholder(d.inner)
+	case describedDecoder:
+		return d.placeholder
+	case basicDecoder:
+		return kindPlaceholder(d.rval.Kind())
+	case groupedDecoder:
+		return kindPlaceholder(d.rval.Kind())
+	case pointerDecoder:
+		return kindPlaceholder(d.rval.Type().Elem().Kind())
+	case arrayDecoder:
+		elem := kindPlaceholder(d.rval.Type().Elem().Kind())
+		return strings.TrimSuffix(strings.Repeat(elem+",", d.rval.Len()), ",")
+	case baseIntDecoder:
+		return kindPlaceholder(d.rval.Kind())
+	case durationAsIntDecoder:
+		return "DURATION"
+	case byteSizeDecoder:
+		return "SIZE"
+	case stringSliceDecoder, uniqueStringSliceDecoder, countingSliceDecoder, promptDecoder, caseStringDecoder:
+		return "STRING"
+	case inputDecoder, inputSliceDecoder, outputDecoder, globSliceDecoder:
+		return "FILE"
+	case pathDecoder:
+		if d.mode&PathMustBeDir != 0 {
+			return "DIR"
+		}
+		return "FILE"
+	case stringMapDecoder, structSetDecoder:
+		return "KEY=VALUE"
+	case placeholderDecoder:
+		return d.placeholder()
+	default:
+		return ""
+	}
+}
+
+// placeholderDecoder is implemented by builtin decoders that are defined in
+// build-constrained files, and so can't be listed in typePlaceholder().
+type placeholderDecoder interface {
+	placeholder() string
+}
+
+func kindPlaceholder(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "INT"
+	case reflect.Float32, reflect.Float64:
+		return "FLOAT"
+	case reflect.Complex64, reflect.Complex128:
+		return "COMPLEX"
+	case reflect.String:
+		return "STRING"
+	default:
+		return ""
+	}
+}
+
+// Value sources reported by Command.ValueSource().
+const (
+	SourceArg     = "arg"     // The value was specified by a parsed argument
+	SourceEnv     = "env"     // The value was read from an environment variable
+	SourceConfig  = "config"  // The value was read from a config file
+	SourceDefault = "default" // The value was set by the option's default
+)
+
+// OptionDefaulter initializes option values to defaults.  If an OptionDecoder
+// implements the OptionDefaulter interface, its SetDefault() method is called
+// prior to decoding options.
+type OptionDefaulter interface {
+	SetDefault()
+}
+
+// NewDefaulter builds an OptionDecoder that implements OptionDefaulter.
+// SetDefault calls decoder.Decode() with the value of defaultArg.  If the
+// value fails to decode, SetDefault panics.  Command.Decode() recovers the
+// panic and returns it as an error.
+func NewDefaulter(decoder OptionDecoder, defaultArg string) OptionDecoder {
+	return defaulter{decoder, defaultArg}
+}
+
+type defaulter struct {
+	OptionDecoder
+	defaultArg string
+}
+
+func (d defaulter) SetDefault() {
+	_, err := d.setDefault(false, nil)
+	if err != nil {
+		// Default values should be known correct values, so we panic on error
+		panicOption("%s", err)
+	}
+}
+
+func (d defaulter) Value() interface{} {
+	return decodedValue(d.OptionDecoder)
+}
+
+func (d defaulter) setDefault(strict bool, warnings io.Writer) (string, error) {
+	err := d.Decode(d.defaultArg)
+	if err != nil {
+		return "", fmt.Errorf("error setting default value: decoder rejected arg %q", d.defaultArg)
+	}
+	return SourceDefault, nil
+}
+
+// NewEnvDefaulter builds an OptionDecoder that implements OptionDefaulter.
+// SetDefault calls decoder.Decode() with the value of the environment
+// variable named by key.  If the environment variable isn't set or fails to
+// decode, SetDefault checks if decoder implements OptionDefault.  If so,
 // SetDefault calls decoder.SetDefault().  Otherwise, no action is taken.
 func NewEnvDefaulter(decoder OptionDecoder, key string) OptionDecoder {
 	return envDefaulter{decoder, key}
@@ -382,16 +1858,150 @@ type envDefaulter struct {
 }
 
 func (d envDefaulter) SetDefault() {
+	_, err := d.setDefault(false, nil)
+	if err != nil {
+		panicOption("%s", err)
+	}
+}
+
+func (d envDefaulter) Value() interface{} {
+	return decodedValue(d.OptionDecoder)
+}
+
+func (d envDefaulter) setDefault(strict bool, warnings io.Writer) (string, error) {
 	val := os.Getenv(d.key)
 	if val != "" {
 		err := d.Decode(val)
 		if err == nil {
-			return
+			return SourceEnv, nil
+		}
+		err = fmt.Errorf("error setting default value: decoder rejected value %q for environment variable %s", val, d.key)
+		if strict {
+			return "", err
 		}
+		warnf(warnings, "%s", err)
+	}
+	return setDefault(d.OptionDecoder, strict, warnings)
+}
+
+// NewReplacingDecoder builds an OptionDecoder that wraps decoder, which
+// accumulates values into the slice or map pointed to by val.  The first
+// value decoded after defaults are applied clears val, so values specified
+// via parsed arguments replace the defaults rather than being added to them.
+// Values from "default" and "env" tags, from config files, and values
+// present in val before decoding all count as defaults.  The decoder
+// parameter should already be wrapped by any defaulters, as with
+// NewReplacingDecoder(NewDefaulter(d, "stdin"), &val).
+func NewReplacingDecoder(decoder OptionDecoder, val interface{}) OptionDecoder {
+	rval := reflect.ValueOf(val)
+	if rval.Kind() != reflect.Ptr || rval.IsNil() || (rval.Elem().Kind() != reflect.Slice && rval.Elem().Kind() != reflect.Map) {
+		panicOption("NewReplacingDecoder must be called with a non-nil pointer to a slice or map")
+	}
+	return replacingDecoder{decoder, rval.Elem(), new(bool), true}
+}
+
+// newConfigReplacingDecoder is identical to NewReplacingDecoder, except that
+// values specified via parsed arguments are added to the defaults.  Only
+// config values replace them.  New() wraps slice and map options without a
+// "replace" tag with it, so that config values take precedence over "default"
+// tags.
+func newConfigReplacingDecoder(decoder OptionDecoder, rval reflect.Value) OptionDecoder {
+	return replacingDecoder{decoder, rval, new(bool), false}
+}
+
+type replacingDecoder struct {
+	OptionDecoder
+	rval      reflect.Value
+	defaulted *bool
+
+	// replaceArgs is set if values decoded from arguments replace the
+	// defaults.
+	replaceArgs bool
+}
+
+func (d replacingDecoder) Decode(arg string) error {
+	if d.replaceArgs {
+		d.clearDefaults()
 	}
+	return d.OptionDecoder.Decode(arg)
+}
 
-	defaulter, ok := d.OptionDecoder.(OptionDefaulter)
+// clearDefaults clears the decoder's values if they're defaults.
+func (d replacingDecoder) clearDefaults() {
+	if *d.defaulted {
+		d.rval.Set(reflect.Zero(d.rval.Type()))
+		*d.defaulted = false
+	}
+}
+
+func (d replacingDecoder) SetDefault() {
+	_, err := d.setDefault(false, nil)
+	if err != nil {
+		panicOption("%s", err)
+	}
+}
+
+func (d replacingDecoder) Value() interface{} {
+	return decodedValue(d.OptionDecoder)
+}
+
+func (d replacingDecoder) setDefault(strict bool, warnings io.Writer) (string, error) {
+	source, err := setDefault(d.OptionDecoder, strict, warnings)
+	*d.defaulted = true
+	return source, err
+}
+
+// markDefaulted records that the current values of decoder are defaults, if
+// decoder was built by NewReplacingDecoder().
+func markDefaulted(decoder OptionDecoder) {
+	r, ok := decoder.(replacingDecoder)
+	if ok {
+		*r.defaulted = true
+	}
+}
+
+// clearDefaults clears the current values of decoder if they're defaults and
+// decoder was built by NewReplacingDecoder().  It's used to replace defaults
+// with config values.
+func clearDefaults(decoder OptionDecoder) {
+	r, ok := decoder.(replacingDecoder)
+	if ok {
+		r.clearDefaults()
+	}
+}
+
+// defaultSetter is implemented by the builtin defaulters.  Unlike
+// OptionDefaulter, it reports decoding failures rather than panicking on
+// them.  If strict is set, invalid environment values are reported as errors.
+// Otherwise they're written to warnings and ignored.  The returned source is
+// SourceEnv or SourceDefault if a value was applied, or empty otherwise.
+type defaultSetter interface {
+	setDefault(strict bool, warnings io.Writer) (source string, err error)
+}
+
+// setDefault applies the default for decoder, if any, and returns the source
+// of the applied value.  See defaultSetter for the meaning of strict and
+// warnings.  Panics from invalid default values are returned as errors.
+func setDefault(decoder OptionDecoder, strict bool, warnings io.Writer) (source string, err error) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			e, ok := r.(optionError)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+
+	setter, ok := decoder.(defaultSetter)
+	if ok {
+		return setter.setDefault(strict, warnings)
+	}
+	defaulter, ok := decoder.(OptionDefaulter)
 	if ok {
 		defaulter.SetDefault()
+		return SourceDefault, nil
 	}
+	return "", nil
 }
@@ -21,8 +21,16 @@
 package writ
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 /*
@@ -69,6 +77,46 @@ var invalidOptionTests = []struct {
 		Description: "Option must have a decoder",
 		Option:      &Option{Names: []string{"option"}},
 	},
+	{
+		Description: "Flags cannot have placeholders",
+		Option:      &Option{Names: []string{"flag"}, Decoder: noopDecoder{}, Flag: true, Placeholder: "ARG"},
+	},
+	{
+		Description: "Flags cannot have optional arguments",
+		Option:      &Option{Names: []string{"flag"}, Decoder: noopDecoder{}, Flag: true, OptionalArg: true},
+	},
+	{
+		Description: "Flag decoders require Flag",
+		Option:      &Option{Names: []string{"flag"}, Decoder: NewFlagDecoder(new(bool))},
+	},
+	{
+		Description: "Flag accumulators require Flag",
+		Option:      &Option{Names: []string{"flag"}, Decoder: NewFlagAccumulator(new(int)), Plural: true},
+	},
+	{
+		Description: "Flag accumulators require Plural",
+		Option:      &Option{Names: []string{"flag"}, Decoder: NewFlagAccumulator(new(int)), Flag: true},
+	},
+	{
+		Description: "OnRepeat must be valid",
+		Option:      &Option{Names: []string{"option"}, Decoder: noopDecoder{}, OnRepeat: RepeatMode(42)},
+	},
+	{
+		Description: "Plural options cannot set OnRepeat",
+		Option:      &Option{Names: []string{"option"}, Decoder: noopDecoder{}, Plural: true, OnRepeat: RepeatKeepLast},
+	},
+	{
+		Description: "BoolWords require a flag decoder",
+		Option:      &Option{Names: []string{"option"}, Decoder: noopDecoder{}, Flag: true, BoolWords: DefaultBoolWords},
+	},
+	{
+		Description: "BoolWords require at least one true and one false word",
+		Option:      &Option{Names: []string{"option"}, Decoder: NewFlagDecoder(new(bool)), Flag: true, BoolWords: &BoolWords{True: []string{"yes"}}},
+	},
+	{
+		Description: "BoolWords cannot list a word as both true and false",
+		Option:      &Option{Names: []string{"option"}, Decoder: NewFlagDecoder(new(bool)), Flag: true, BoolWords: &BoolWords{True: []string{"yes", "on"}, False: []string{"ON"}}},
+	},
 }
 
 func TestDirectOptionValidation(t *testing.T) {
@@ -150,6 +198,947 @@ func TestNilNewFlagDecoder(t *testing.T) {
 	t.Errorf("Expected NewFlagDecoder to panic on nil value, but this didn't happen")
 }
 
+func TestCountingSliceDecoder(t *testing.T) {
+	var values []string
+	var count int
+	cmd := &Command{Name: "test"}
+	cmd.Options = []*Option{
+		{Names: []string{"I", "include"}, Decoder: NewCountingSliceDecoder(&values, &count), Plural: true},
+	}
+	_, _, err := cmd.Decode([]string{"-I", "a", "--include", "b", "-Ia"})
+	if err != nil {
+		t.Errorf("Received unexpected error.  Error: %s", err)
+		return
+	}
+	if !reflect.DeepEqual(values, []string{"a", "b", "a"}) {
+		t.Errorf("Decoded values are incorrect.  Expected: %q, Received: %q", []string{"a", "b", "a"}, values)
+	}
+	if count != 3 {
+		t.Errorf("Decoded count is incorrect.  Expected: %d, Received: %d", 3, count)
+	}
+
+	for _, fn := range []func(){
+		func() { NewCountingSliceDecoder(nil, &count) },
+		func() { NewCountingSliceDecoder(&values, nil) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected NewCountingSliceDecoder to panic on a nil pointer, but it didn't happen")
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+func TestPathDecoder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "writ-path")
+	if err != nil {
+		t.Errorf("Failed to create temp dir.  Error: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "file")
+	err = ioutil.WriteFile(file, []byte("test"), 0644)
+	if err != nil {
+		t.Errorf("Failed to create temp file.  Error: %s", err)
+		return
+	}
+	missing := filepath.Join(dir, "missing")
+	missingParent := filepath.Join(missing, "file")
+
+	tests := []struct {
+		Mode  PathMode
+		Arg   string
+		Valid bool
+	}{
+		{Mode: 0, Arg: missingParent, Valid: true},
+		{Mode: 0, Arg: "", Valid: false},
+		{Mode: PathMustExist, Arg: dir, Valid: true},
+		{Mode: PathMustExist, Arg: file, Valid: true},
+		{Mode: PathMustExist, Arg: missing, Valid: false},
+		{Mode: PathMustBeDir, Arg: dir, Valid: true},
+		{Mode: PathMustBeDir, Arg: file, Valid: false},
+		{Mode: PathMustBeDir, Arg: missing, Valid: false},
+		{Mode: PathMustBeFile, Arg: file, Valid: true},
+		{Mode: PathMustBeFile, Arg: dir, Valid: false},
+		{Mode: PathMustBeFile, Arg: missing, Valid: false},
+		{Mode: PathParentMustExist, Arg: missing, Valid: true},
+		{Mode: PathParentMustExist, Arg: file, Valid: true},
+		{Mode: PathParentMustExist, Arg: missingParent, Valid: false},
+		{Mode: PathParentMustExist, Arg: filepath.Join(file, "child"), Valid: false},
+		{Mode: PathMustExist | PathParentMustExist, Arg: missing, Valid: false},
+	}
+	for _, test := range tests {
+		value := "unchanged"
+		err := NewPathDecoder(&value, test.Mode).Decode(test.Arg)
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received. Mode: %d, Arg: %q", test.Mode, test.Arg)
+			}
+			if value != "unchanged" {
+				t.Errorf("Expected value to be unchanged on error.  Mode: %d, Arg: %q, Received: %q", test.Mode, test.Arg, value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error. Mode: %d, Arg: %q, Error: %s", test.Mode, test.Arg, err)
+			continue
+		}
+		if value != test.Arg {
+			t.Errorf("Decoded value is incorrect. Mode: %d, Expected: %q, Received: %q", test.Mode, test.Arg, value)
+		}
+	}
+
+	spec := &struct {
+		Config string `option:"c" path:"existing-file"`
+		Output string `option:"o" path:"parent-exists"`
+	}{}
+	cmd := New("test", spec)
+	_, _, err = cmd.Decode([]string{"-c", file, "-o", missing})
+	if err != nil || spec.Config != file || spec.Output != missing {
+		t.Errorf("Invalid path tag decoding.  Error: %v, Config: %q, Output: %q", err, spec.Config, spec.Output)
+	}
+	_, _, err = cmd.Decode([]string{"-c", dir})
+	if err == nil {
+		t.Errorf("Expected error decoding a directory with an existing-file path tag, but none received")
+	}
+}
+
+func TestGlobSliceDecoder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "writ-glob")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir.  Error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.go", "b.go", "c.txt"} {
+		err = ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)
+		if err != nil {
+			t.Fatalf("Failed to write temp file.  Error: %s", err)
+		}
+	}
+	join := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	tests := []struct {
+		Strict bool
+		Args   []string
+		Valid  bool
+		Value  []string
+	}{
+		{Args: []string{join("*.go")}, Valid: true, Value: []string{join("a.go"), join("b.go")}},
+		{Args: []string{join("?.txt"), join("a.go")}, Valid: true, Value: []string{join("c.txt"), join("a.go")}},
+		{Args: []string{join("missing")}, Valid: true, Value: []string{join("missing")}},
+		{Args: []string{join("*.md")}, Valid: true, Value: []string{join("*.md")}},
+		{Args: []string{join("[")}, Valid: false},
+		{Strict: true, Args: []string{join("[ab].go")}, Valid: true, Value: []string{join("a.go"), join("b.go")}},
+		{Strict: true, Args: []string{join("missing")}, Valid: true, Value: []string{join("missing")}},
+		{Strict: true, Args: []string{join("*.md")}, Valid: false},
+	}
+	for _, test := range tests {
+		var value []string
+		decoder := NewGlobSliceDecoder(&value)
+		if test.Strict {
+			decoder = NewStrictGlobSliceDecoder(&value)
+		}
+		var err error
+		for _, arg := range test.Args {
+			err = decoder.Decode(arg)
+			if err != nil {
+				break
+			}
+		}
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received. Args: %q", test.Args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error. Args: %q, Error: %s", test.Args, err)
+			continue
+		}
+		if !reflect.DeepEqual(value, test.Value) {
+			t.Errorf("Decoded value is incorrect. Args: %q, Expected: %q, Received: %q", test.Args, test.Value, value)
+		}
+	}
+
+	spec := &struct {
+		Files []string `option:"f" glob:"strict"`
+	}{}
+	_, _, err = New("test", spec).Decode([]string{"-f", join("*.txt")})
+	if err != nil || !reflect.DeepEqual(spec.Files, []string{join("c.txt")}) {
+		t.Errorf("Invalid glob tag decoding.  Error: %v, Files: %q", err, spec.Files)
+	}
+}
+
+func TestDurationAsIntDecoder(t *testing.T) {
+	tests := []struct {
+		Unit  time.Duration
+		Arg   string
+		Valid bool
+		Value int
+	}{
+		{Unit: time.Second, Arg: "2m", Valid: true, Value: 120},
+		{Unit: time.Second, Arg: "30s", Valid: true, Value: 30},
+		{Unit: time.Second, Arg: "1h30m", Valid: true, Value: 5400},
+		{Unit: time.Second, Arg: "-5s", Valid: true, Value: -5},
+		{Unit: time.Second, Arg: "0", Valid: true, Value: 0},
+		{Unit: time.Millisecond, Arg: "1.5s", Valid: true, Value: 1500},
+		{Unit: time.Minute, Arg: "2h", Valid: true, Value: 120},
+		{Unit: time.Second, Arg: "1500ms", Valid: false},
+		{Unit: time.Second, Arg: "30", Valid: false},
+		{Unit: time.Second, Arg: "", Valid: false},
+		{Unit: time.Second, Arg: "abc", Valid: false},
+	}
+	for _, test := range tests {
+		value := -1
+		err := NewDurationAsIntDecoder(&value, test.Unit).Decode(test.Arg)
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received. Unit: %s, Arg: %q", test.Unit, test.Arg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error. Unit: %s, Arg: %q, Error: %s", test.Unit, test.Arg, err)
+			continue
+		}
+		if value != test.Value {
+			t.Errorf("Decoded value is incorrect. Unit: %s, Arg: %q, Expected: %d, Received: %d", test.Unit, test.Arg, test.Value, value)
+		}
+	}
+}
+
+func TestGroupedDecoders(t *testing.T) {
+	intTests := []struct {
+		Arg   string
+		Sep   rune
+		Valid bool
+		Value int
+	}{
+		{Arg: "1000", Sep: ',', Valid: true, Value: 1000},
+		{Arg: "1,000", Sep: ',', Valid: true, Value: 1000},
+		{Arg: "-1,000,000", Sep: ',', Valid: true, Value: -1000000},
+		{Arg: "1,00,000", Sep: ',', Valid: true, Value: 100000},
+		{Arg: "1.000", Sep: '.', Valid: true, Value: 1000},
+		{Arg: "1 000", Sep: ' ', Valid: true, Value: 1000},
+		{Arg: "1,000", Sep: '.', Valid: false},
+		{Arg: ",100", Sep: ',', Valid: false},
+		{Arg: "100,", Sep: ',', Valid: false},
+		{Arg: "1,,000", Sep: ',', Valid: false},
+		{Arg: "-,100", Sep: ',', Valid: false},
+		{Arg: "9,223,372,036,854,775,808", Sep: ',', Valid: false},
+	}
+	for _, test := range intTests {
+		var value int
+		err := NewGroupedIntDecoder(&value, test.Sep).Decode(test.Arg)
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received. Arg: %q, Sep: %q", test.Arg, test.Sep)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error. Arg: %q, Sep: %q, Error: %s", test.Arg, test.Sep, err)
+			continue
+		}
+		if value != test.Value {
+			t.Errorf("Decoded value is incorrect. Arg: %q, Sep: %q, Expected: %d, Received: %d", test.Arg, test.Sep, test.Value, value)
+		}
+	}
+
+	floatTests := []struct {
+		Arg   string
+		Valid bool
+		Value float64
+	}{
+		{Arg: "1,000.5", Valid: true, Value: 1000.5},
+		{Arg: "-1,000.25", Valid: true, Value: -1000.25},
+		{Arg: "+1,000", Valid: true, Value: 1000},
+		{Arg: "1,000e3", Valid: true, Value: 1000000},
+		{Arg: "1.000,5", Valid: false},
+		{Arg: "1e1,000", Valid: false},
+	}
+	for _, test := range floatTests {
+		var value float64
+		err := NewGroupedFloatDecoder(&value, ',').Decode(test.Arg)
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received. Arg: %q", test.Arg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error. Arg: %q, Error: %s", test.Arg, err)
+			continue
+		}
+		if value != test.Value {
+			t.Errorf("Decoded value is incorrect. Arg: %q, Expected: %f, Received: %f", test.Arg, test.Value, value)
+		}
+	}
+
+	var intValue int
+	var floatValue float64
+	for _, fn := range []func(){
+		func() { NewGroupedIntDecoder(nil, ',') },
+		func() { NewGroupedIntDecoder(&intValue, '0') },
+		func() { NewGroupedIntDecoder(&intValue, '-') },
+		func() { NewGroupedIntDecoder(&intValue, '+') },
+		func() { NewGroupedFloatDecoder(&floatValue, '.') },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected grouped decoder to panic on an invalid argument, but it didn't happen")
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+func TestBaseIntDecoder(t *testing.T) {
+	tests := []struct {
+		Arg   string
+		Base  int
+		Valid bool
+		Value int64
+	}{
+		{Arg: "255", Base: 0, Valid: true, Value: 255},
+		{Arg: "0xFF", Base: 0, Valid: true, Value: 255},
+		{Arg: "0o17", Base: 0, Valid: true, Value: 15},
+		{Arg: "017", Base: 0, Valid: true, Value: 15},
+		{Arg: "0b101", Base: 0, Valid: true, Value: 5},
+		{Arg: "-0x10", Base: 0, Valid: true, Value: -16},
+		{Arg: "ff", Base: 16, Valid: true, Value: 255},
+		{Arg: "0xff", Base: 16, Valid: false},
+		{Arg: "777", Base: 8, Valid: true, Value: 511},
+		{Arg: "8", Base: 8, Valid: false},
+		{Arg: "0x", Base: 0, Valid: false},
+		{Arg: "0x7fffffff", Base: 0, Valid: true, Value: 2147483647},
+		{Arg: "0x80000000", Base: 0, Valid: false},
+	}
+	for _, test := range tests {
+		var value int32
+		err := NewBaseIntDecoder(&value, test.Base).Decode(test.Arg)
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received. Arg: %q, Base: %d", test.Arg, test.Base)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error. Arg: %q, Base: %d, Error: %s", test.Arg, test.Base, err)
+			continue
+		}
+		if int64(value) != test.Value {
+			t.Errorf("Decoded value is incorrect. Arg: %q, Base: %d, Expected: %d, Received: %d", test.Arg, test.Base, test.Value, value)
+		}
+	}
+
+	var u8 uint8
+	decoder := NewBaseIntDecoder(&u8, 0)
+	if err := decoder.Decode("0xff"); err != nil || u8 != 255 {
+		t.Errorf("Invalid uint8 decoding.  Error: %v, Received: %d", err, u8)
+	}
+	if err := decoder.Decode("0x100"); err == nil {
+		t.Errorf("Expected an overflow error decoding 0x100 into a uint8")
+	}
+	if err := decoder.Decode("-1"); err == nil {
+		t.Errorf("Expected an error decoding a negative uint8")
+	}
+
+	var str string
+	for _, fn := range []func(){
+		func() { NewBaseIntDecoder(nil, 0) },
+		func() { NewBaseIntDecoder(u8, 0) },
+		func() { NewBaseIntDecoder(&str, 0) },
+		func() { NewBaseIntDecoder(&u8, 1) },
+		func() { NewBaseIntDecoder(&u8, 37) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected NewBaseIntDecoder to panic on an invalid argument, but it didn't happen")
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+func TestByteSizeDecoder(t *testing.T) {
+	tests := []struct {
+		Arg   string
+		Valid bool
+		Value int64
+	}{
+		{Arg: "0", Valid: true, Value: 0},
+		{Arg: "512", Valid: true, Value: 512},
+		{Arg: "512B", Valid: true, Value: 512},
+		{Arg: "10KB", Valid: true, Value: 10000},
+		{Arg: "10kb", Valid: true, Value: 10000},
+		{Arg: "10KiB", Valid: true, Value: 10240},
+		{Arg: "10 MB", Valid: true, Value: 10000000},
+		{Arg: "1.5GiB", Valid: true, Value: 1610612736},
+		{Arg: "2TB", Valid: true, Value: 2000000000000},
+		{Arg: "7EiB", Valid: true, Value: 7 << 60},
+		{Arg: "9223372036854775807", Valid: true, Value: 9223372036854775807},
+		{Arg: "9223372036854775808", Valid: false},
+		{Arg: "8EiB", Valid: false},
+		{Arg: "10EB", Valid: false},
+		{Arg: "1.5B", Valid: false},
+		{Arg: "-1KB", Valid: false},
+		{Arg: "10XB", Valid: false},
+		{Arg: "1e3", Valid: false},
+		{Arg: "1/2KB", Valid: false},
+		{Arg: "KB", Valid: false},
+		{Arg: "", Valid: false},
+	}
+	for _, test := range tests {
+		var value int64
+		err := NewByteSizeDecoder(&value).Decode(test.Arg)
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received. Arg: %q, Value: %d", test.Arg, value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error. Arg: %q, Error: %s", test.Arg, err)
+			continue
+		}
+		if value != test.Value {
+			t.Errorf("Decoded value is incorrect. Arg: %q, Expected: %d, Received: %d", test.Arg, test.Value, value)
+		}
+	}
+}
+
+func TestArrayDecoder(t *testing.T) {
+	tests := []struct {
+		Arg   string
+		Valid bool
+		Value [3]int
+		Err   string
+	}{
+		{Arg: "255,128,0", Valid: true, Value: [3]int{255, 128, 0}},
+		{Arg: "1, 2, -3", Valid: true, Value: [3]int{1, 2, -3}},
+		{Arg: "1,2", Valid: false, Err: `value "1,2" has 2 elements, but exactly 3 are required`},
+		{Arg: "1,2,3,4", Valid: false, Err: `value "1,2,3,4" has 4 elements, but exactly 3 are required`},
+		{Arg: "", Valid: false, Err: `value "" has 1 element, but exactly 3 are required`},
+		{Arg: "1,x,3", Valid: false, Err: `element 2 of value "1,x,3" is invalid: strconv.ParseInt: parsing "x": invalid syntax`},
+		{Arg: "1,,3", Valid: false},
+	}
+	for _, test := range tests {
+		value := [3]int{7, 8, 9}
+		err := NewArrayDecoder(&value).Decode(test.Arg)
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received. Arg: %q, Value: %v", test.Arg, value)
+			} else if test.Err != "" && err.Error() != test.Err {
+				t.Errorf("Invalid error. Arg: %q, Expected: %q, Received: %q", test.Arg, test.Err, err)
+			}
+			if value != [3]int{7, 8, 9} {
+				t.Errorf("Array modified by failed decode. Arg: %q, Value: %v", test.Arg, value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error. Arg: %q, Error: %s", test.Arg, err)
+			continue
+		}
+		if value != test.Value {
+			t.Errorf("Decoded value is incorrect. Arg: %q, Expected: %v, Received: %v", test.Arg, test.Value, value)
+		}
+	}
+
+	var version [3]uint8
+	err := NewOptionDecoder(&version).Decode("1,10,255")
+	if err != nil || version != [3]uint8{1, 10, 255} {
+		t.Errorf("Invalid array decoded by NewOptionDecoder.  Value: %v, Error: %v", version, err)
+	}
+	var names [2]string
+	err = NewOptionDecoder(&names).Decode("a, b c")
+	if err != nil || names != [2]string{"a", "b c"} {
+		t.Errorf("Invalid array decoded by NewOptionDecoder.  Value: %q, Error: %v", names, err)
+	}
+
+	invalid := []interface{}{[3]int{}, &[]int{}, &[0]int{}, &[2]bool{}, (*[2]int)(nil)}
+	for _, val := range invalid {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected a panic from NewArrayDecoder.  Value: %#v", val)
+				}
+			}()
+			NewArrayDecoder(val)
+		}()
+	}
+}
+
+func TestSplitCommaList(t *testing.T) {
+	tests := []struct {
+		Arg    string
+		Values []string
+	}{
+		{Arg: "", Values: []string{""}},
+		{Arg: "a,b,c", Values: []string{"a", "b", "c"}},
+		{Arg: "a,,c,", Values: []string{"a", "", "c", ""}},
+		{Arg: `a\,b,c`, Values: []string{"a,b", "c"}},
+		{Arg: `a\\,b`, Values: []string{`a\`, "b"}},
+		{Arg: `a\\\,b`, Values: []string{`a\,b`}},
+		{Arg: `\,\,`, Values: []string{",,"}},
+		{Arg: `a\nb,c\`, Values: []string{`a\nb`, `c\`}},
+		{Arg: "héllo,wörld", Values: []string{"héllo", "wörld"}},
+	}
+	for _, test := range tests {
+		values := splitCommaList(test.Arg)
+		if !reflect.DeepEqual(values, test.Values) {
+			t.Errorf("Invalid split.  Arg: %q, Expected: %q, Received: %q", test.Arg, test.Values, values)
+		}
+	}
+
+	var pair [2]string
+	err := NewArrayDecoder(&pair).Decode(`Smith\, John,Doe\, Jane`)
+	if err != nil || pair != [2]string{"Smith, John", "Doe, Jane"} {
+		t.Errorf("Invalid array with escaped commas.  Value: %q, Error: %v", pair, err)
+	}
+	var features []string
+	err = NewFlagSetDecoder(&features, "a,b", "c").Decode(`a\,b,c`)
+	if err != nil || !reflect.DeepEqual(features, []string{"a,b", "c"}) {
+		t.Errorf("Invalid flag set with escaped commas.  Value: %q, Error: %v", features, err)
+	}
+}
+
+func TestCaseStringDecoder(t *testing.T) {
+	tests := []struct {
+		Mode  CaseMode
+		Arg   string
+		Value string
+	}{
+		{Mode: CaseNone, Arg: " Mixed Case ", Value: " Mixed Case "},
+		{Mode: CaseLower, Arg: "PROD", Value: "prod"},
+		{Mode: CaseLower, Arg: "ÀÉÎ", Value: "àéî"},
+		{Mode: CaseUpper, Arg: "debug", Value: "DEBUG"},
+		{Mode: CaseTitle, Arg: "hello WORLD", Value: "Hello World"},
+		{Mode: CaseTitle, Arg: "  two\tspaced ", Value: "  Two\tSpaced "},
+		{Mode: CaseTitle, Arg: "", Value: ""},
+	}
+	for _, test := range tests {
+		var value string
+		decoder := NewCaseStringDecoder(&value, test.Mode)
+		err := decoder.Decode(test.Arg)
+		if err != nil {
+			t.Errorf("Received unexpected error. Arg: %q, Error: %s", test.Arg, err)
+			continue
+		}
+		if value != test.Value {
+			t.Errorf("Decoded value is incorrect. Arg: %q, Expected: %q, Received: %q", test.Arg, test.Value, value)
+		}
+	}
+}
+
+func TestFlagSetDecoder(t *testing.T) {
+	tests := []struct {
+		Args  []string
+		Valid bool
+		Value []string
+	}{
+		{Args: []string{"a"}, Valid: true, Value: []string{"a"}},
+		{Args: []string{"a,b,c"}, Valid: true, Value: []string{"a", "b", "c"}},
+		{Args: []string{"c,a"}, Valid: true, Value: []string{"c", "a"}},
+		{Args: []string{"a,a,b"}, Valid: true, Value: []string{"a", "b"}},
+		{Args: []string{"a,b", "b,c"}, Valid: true, Value: []string{"a", "b", "c"}},
+		{Args: []string{"d"}, Valid: false},
+		{Args: []string{"a,d"}, Valid: false},
+		{Args: []string{"a,"}, Valid: false},
+		{Args: []string{""}, Valid: false},
+	}
+	for _, test := range tests {
+		var value []string
+		decoder := NewFlagSetDecoder(&value, "a", "b", "c")
+		var err error
+		for _, arg := range test.Args {
+			err = decoder.Decode(arg)
+			if err != nil {
+				break
+			}
+		}
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received. Args: %q", test.Args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error. Args: %q, Error: %s", test.Args, err)
+			continue
+		}
+		if !reflect.DeepEqual(value, test.Value) {
+			t.Errorf("Decoded value is incorrect. Args: %q, Expected: %q, Received: %q", test.Args, test.Value, value)
+		}
+	}
+
+	var value []string
+	err := NewFlagSetDecoder(&value, "a", "b").Decode("a,c")
+	expected := `value "c" is not valid (allowed values: a, b)`
+	if err == nil || err.Error() != expected {
+		t.Errorf("Invalid error message.  Expected: %s, Received: %v", expected, err)
+	}
+	if len(value) != 0 {
+		t.Errorf("Expected no values to be decoded on error, but received %q", value)
+	}
+}
+
+func TestBitmaskDecoder(t *testing.T) {
+	bits := map[string]int{"read": 4, "write": 2, "exec": 1}
+	tests := []struct {
+		Args  []string
+		Valid bool
+		Value int
+	}{
+		{Args: []string{"read"}, Valid: true, Value: 4},
+		{Args: []string{"read,write"}, Valid: true, Value: 6},
+		{Args: []string{"read,write,exec,read"}, Valid: true, Value: 7},
+		{Args: []string{"exec", "write"}, Valid: true, Value: 3},
+		{Args: []string{"bogus"}, Valid: false},
+		{Args: []string{"read,"}, Valid: false},
+	}
+	for _, test := range tests {
+		var value int
+		decoder := NewBitmaskDecoder(&value, bits)
+		var err error
+		for _, arg := range test.Args {
+			err = decoder.Decode(arg)
+			if err != nil {
+				break
+			}
+		}
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received. Args: %q", test.Args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error. Args: %q, Error: %s", test.Args, err)
+			continue
+		}
+		if value != test.Value {
+			t.Errorf("Decoded value is incorrect. Args: %q, Expected: %d, Received: %d", test.Args, test.Value, value)
+		}
+	}
+
+	var value int
+	err := NewBitmaskDecoder(&value, bits).Decode("bogus")
+	expected := `value "bogus" is not valid (allowed values: exec, read, write)`
+	if err == nil || err.Error() != expected {
+		t.Errorf("Invalid error message.  Expected: %s, Received: %v", expected, err)
+	}
+}
+
+type registeredTestType struct {
+	value string
+}
+
+type registeredTestDecoder struct {
+	target *registeredTestType
+}
+
+func (d registeredTestDecoder) Decode(arg string) error {
+	if arg == "bogus" {
+		return fmt.Errorf("bogus value")
+	}
+	d.target.value = "registered:" + arg
+	return nil
+}
+
+func TestRegisterDecoder(t *testing.T) {
+	RegisterDecoder(reflect.TypeOf(registeredTestType{}), func(val interface{}) OptionDecoder {
+		return registeredTestDecoder{val.(*registeredTestType)}
+	})
+	spec := &struct {
+		Registered registeredTestType `option:"r"`
+	}{}
+	cmd := New("test", spec)
+	_, _, err := cmd.Decode([]string{"-r", "foo"})
+	if err != nil {
+		t.Errorf("Received unexpected error decoding registered type.  Error: %s", err)
+		return
+	}
+	if spec.Registered.value != "registered:foo" {
+		t.Errorf("Decoded value is incorrect.  Expected: %q, Received: %q", "registered:foo", spec.Registered.value)
+	}
+	_, _, err = cmd.Decode([]string{"-r", "bogus"})
+	if err == nil {
+		t.Errorf("Expected error decoding bogus value for registered type, but none received")
+	}
+}
+
+type structSetServer struct {
+	Host string
+	Port int
+}
+
+type structSetTarget struct {
+	Name    string
+	Server  structSetServer
+	Backup  *structSetServer
+	Tags    []string
+	Labels  map[string]string
+	Custom  customTestOptionPtr
+	private int
+}
+
+func TestStructSetDecoder(t *testing.T) {
+	tests := []struct {
+		Args  []string
+		Valid bool
+		Value structSetTarget
+	}{
+		{Args: []string{"name=foo"}, Valid: true, Value: structSetTarget{Name: "foo"}},
+		{Args: []string{"Name=foo=bar"}, Valid: true, Value: structSetTarget{Name: "foo=bar"}},
+		{Args: []string{"server.host=localhost", "SERVER.PORT=80"}, Valid: true, Value: structSetTarget{Server: structSetServer{Host: "localhost", Port: 80}}},
+		{Args: []string{"backup.port=81"}, Valid: true, Value: structSetTarget{Backup: &structSetServer{Port: 81}}},
+		{Args: []string{"tags=a", "tags=b"}, Valid: true, Value: structSetTarget{Tags: []string{"a", "b"}}},
+		{Args: []string{"labels=a=b"}, Valid: true, Value: structSetTarget{Labels: map[string]string{"a": "b"}}},
+		{Args: []string{"custom=foo"}, Valid: true, Value: structSetTarget{Custom: customTestOptionPtr{val: "foo"}}},
+		{Args: []string{"custom=bar"}, Valid: false},
+		{Args: []string{"name"}, Valid: false},
+		{Args: []string{"bogus=foo"}, Valid: false},
+		{Args: []string{"server.bogus=foo"}, Valid: false},
+		{Args: []string{"name.bogus=foo"}, Valid: false},
+		{Args: []string{"server.port=foo"}, Valid: false},
+		{Args: []string{"server=foo"}, Valid: false},
+		{Args: []string{"private=1"}, Valid: false},
+	}
+	for _, test := range tests {
+		var value structSetTarget
+		decoder := NewStructSetDecoder(&value)
+		var err error
+		for _, arg := range test.Args {
+			err = decoder.Decode(arg)
+			if err != nil {
+				break
+			}
+		}
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received. Args: %q", test.Args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error. Args: %q, Error: %s", test.Args, err)
+			continue
+		}
+		if !reflect.DeepEqual(value, test.Value) {
+			t.Errorf("Decoded value is incorrect. Args: %q, Expected: %#v, Received: %#v", test.Args, test.Value, value)
+		}
+	}
+}
+
+func TestPromptDecoder(t *testing.T) {
+	tests := []struct {
+		Arg    string
+		Input  string
+		Valid  bool
+		Value  string
+		Output string
+	}{
+		{Arg: "literal", Input: "ignored\n", Valid: true, Value: "literal", Output: ""},
+		{Arg: "-", Input: "secret\n", Valid: true, Value: "secret", Output: "Password: \n"},
+		{Arg: "-", Input: "secret\r\nextra\n", Valid: true, Value: "secret", Output: "Password: \n"},
+		{Arg: "-", Input: "secret", Valid: true, Value: "secret", Output: "Password: \n"},
+		{Arg: "-", Input: "\n", Valid: true, Value: "", Output: "Password: \n"},
+		{Arg: "-", Input: "", Valid: false, Output: "Password: \n"},
+	}
+	for _, test := range tests {
+		in, err := ioutil.TempFile("", "writ-prompt")
+		if err != nil {
+			t.Errorf("Failed to create temp file.  Error: %s", err)
+			return
+		}
+		defer os.Remove(in.Name())
+		in.WriteString(test.Input)
+		in.Seek(0, 0)
+
+		var value string
+		out := bytes.NewBuffer(nil)
+		err = promptDecoder{&value, "Password: ", in, out}.Decode(test.Arg)
+		in.Close()
+		if out.String() != test.Output {
+			t.Errorf("Invalid prompt output.  Arg: %q, Expected: %q, Received: %q", test.Arg, test.Output, out.String())
+		}
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received. Arg: %q, Input: %q", test.Arg, test.Input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error. Arg: %q, Input: %q, Error: %s", test.Arg, test.Input, err)
+			continue
+		}
+		if value != test.Value {
+			t.Errorf("Decoded value is incorrect. Arg: %q, Input: %q, Expected: %q, Received: %q", test.Arg, test.Input, test.Value, value)
+		}
+	}
+}
+
+func TestEnvRefDecoder(t *testing.T) {
+	os.Setenv("WRIT_ENVREF_TEST", "secret")
+	os.Setenv("WRIT_ENVREF_EMPTY", "")
+	os.Unsetenv("WRIT_ENVREF_UNSET")
+	defer os.Unsetenv("WRIT_ENVREF_TEST")
+	defer os.Unsetenv("WRIT_ENVREF_EMPTY")
+
+	tests := []struct {
+		Arg   string
+		Valid bool
+		Value string
+	}{
+		{Arg: "literal", Valid: true, Value: "literal"},
+		{Arg: "env:WRIT_ENVREF_TEST", Valid: true, Value: "secret"},
+		{Arg: "env:WRIT_ENVREF_EMPTY", Valid: true, Value: ""},
+		{Arg: `\env:WRIT_ENVREF_TEST`, Valid: true, Value: "env:WRIT_ENVREF_TEST"},
+		{Arg: `\\env:WRIT_ENVREF_TEST`, Valid: true, Value: `\\env:WRIT_ENVREF_TEST`},
+		{Arg: "ENV:WRIT_ENVREF_TEST", Valid: true, Value: "ENV:WRIT_ENVREF_TEST"},
+		{Arg: "env:WRIT_ENVREF_UNSET", Valid: false},
+		{Arg: "env:", Valid: false},
+	}
+	for _, test := range tests {
+		var value string
+		err := NewEnvRefDecoder(NewOptionDecoder(&value)).Decode(test.Arg)
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received. Arg: %q, Value: %q", test.Arg, value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error. Arg: %q, Error: %s", test.Arg, err)
+			continue
+		}
+		if value != test.Value {
+			t.Errorf("Decoded value is invalid. Arg: %q, Expected: %q, Received: %q", test.Arg, test.Value, value)
+		}
+	}
+
+	var port int
+	opt := &Option{Names: []string{"port"}, Decoder: NewEnvRefDecoder(NewOptionDecoder(&port))}
+	if placeholder := optionPlaceholder(opt); placeholder != "INT" {
+		t.Errorf("Invalid placeholder.  Expected: %q, Received: %q", "INT", placeholder)
+	}
+	os.Setenv("WRIT_ENVREF_TEST", "notanint")
+	if err := opt.Decoder.Decode("env:WRIT_ENVREF_TEST"); err == nil {
+		t.Errorf("Expected error decoding an invalid referenced value, but none received")
+	}
+}
+
+func TestStdinFallbackDecoder(t *testing.T) {
+	tests := []struct {
+		Args  []string
+		Input string
+		Valid bool
+		Value int
+	}{
+		{Args: []string{"-a", "42"}, Input: "ignored\n", Valid: true, Value: 42},
+		{Args: []string{"-a", "-"}, Input: "42\n", Valid: true, Value: 42},
+		{Args: []string{"-a", "-"}, Input: "42\r\n7\n", Valid: true, Value: 42},
+		{Args: []string{"-a", "-"}, Input: "42", Valid: true, Value: 42},
+		{Args: []string{"-a", "-"}, Input: "foo\n", Valid: false},
+		{Args: []string{"-a", "-"}, Input: "", Valid: false},
+		{Args: []string{"-a", "-", "-b", "-"}, Input: "42\n7\n", Valid: false},
+		{Args: []string{"-a", "-", "-a", "-"}, Input: "42\n7\n", Valid: false},
+		{Args: []string{"-a", "7", "-b", "-", "-a", "9"}, Input: "42\n", Valid: true, Value: 9},
+	}
+	for _, test := range tests {
+		in, err := ioutil.TempFile("", "writ-stdin")
+		if err != nil {
+			t.Errorf("Failed to create temp file.  Error: %s", err)
+			return
+		}
+		defer os.Remove(in.Name())
+		in.WriteString(test.Input)
+		in.Seek(0, 0)
+
+		var value int
+		inner := NewOptionDecoder(&value)
+		cmd := &Command{Name: "test", Options: []*Option{
+			{Names: []string{"a"}, Decoder: stdinFallbackDecoder{inner, in}, Plural: true},
+			{Names: []string{"b"}, Decoder: stdinFallbackDecoder{inner, in}},
+		}}
+		_, _, err = cmd.Decode(test.Args)
+		in.Close()
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received. Args: %q, Input: %q", test.Args, test.Input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error. Args: %q, Input: %q, Error: %s", test.Args, test.Input, err)
+			continue
+		}
+		if value != test.Value {
+			t.Errorf("Decoded value is incorrect. Args: %q, Input: %q, Expected: %d, Received: %d", test.Args, test.Input, test.Value, value)
+		}
+	}
+
+	in, err := ioutil.TempFile("", "writ-stdin")
+	if err != nil {
+		t.Errorf("Failed to create temp file.  Error: %s", err)
+		return
+	}
+	defer os.Remove(in.Name())
+	defer in.Close()
+	in.WriteString("42\n7\n")
+	in.Seek(0, 0)
+	var value int
+	cmd := &Command{Name: "test", Options: []*Option{
+		{Names: []string{"a"}, Decoder: stdinFallbackDecoder{NewOptionDecoder(&value), in}},
+	}}
+	for _, expected := range []int{42, 7} {
+		_, _, err = cmd.Decode([]string{"-a", "-"})
+		if err != nil {
+			t.Errorf("Received unexpected error reading standard input in a later Decode.  Error: %s", err)
+			continue
+		}
+		if value != expected {
+			t.Errorf("Decoded value is incorrect.  Expected: %d, Received: %d", expected, value)
+		}
+	}
+
+	// Readers are decoded first, so standard input is never actually read.
+	type mixedSpec struct {
+		Input  io.Reader   `option:"i"`
+		Inputs []io.Reader `option:"I"`
+		Token  int         `option:"t"`
+	}
+	newMixedCommand := func(spec *mixedSpec) *Command {
+		var secret string
+		cmd := New("test", spec)
+		cmd.Option("t").Decoder = stdinFallbackDecoder{NewOptionDecoder(&spec.Token), os.Stdin}
+		cmd.Options = append(cmd.Options, &Option{Names: []string{"p"}, Decoder: promptDecoder{&secret, "", os.Stdin, ioutil.Discard}})
+		return cmd
+	}
+	for _, args := range [][]string{{"-i", "-", "-t", "-"}, {"-I", "-", "-t", "-"}, {"-i", "-", "-p", "-"}, {"-I", "-", "-I", "-"}, {"-i", "-", "-I", "-"}} {
+		_, _, err = newMixedCommand(&mixedSpec{}).Decode(args)
+		if err == nil || !strings.Contains(err.Error(), "standard input") {
+			t.Errorf("Expected an error reading standard input twice.  Args: %q, Received: %v", args, err)
+		}
+	}
+	spec := &mixedSpec{}
+	_, _, err = newMixedCommand(spec).Decode([]string{"-i", "-", "-t", "5"})
+	if err != nil || spec.Token != 5 {
+		t.Errorf("Received unexpected result decoding a reader and a literal value.  Token: %d, Error: %v", spec.Token, err)
+	}
+}
+
 /*
  * Misc coverage tests to ensure code doesn't panic
  */
@@ -169,3 +1158,21 @@ func TestOptionString(t *testing.T) {
 		t.Errorf("Option.String() returned an empty string")
 	}
 }
+
+func TestOptionCanonicalName(t *testing.T) {
+	tests := []struct {
+		Names     []string
+		Canonical string
+	}{
+		{Names: []string{"o", "O", "opt", "Opt"}, Canonical: "opt"},
+		{Names: []string{"Opt", "opt"}, Canonical: "Opt"},
+		{Names: []string{"o", "O"}, Canonical: "o"},
+		{Names: []string{"ö"}, Canonical: "ö"},
+	}
+	for _, test := range tests {
+		opt := &Option{Names: test.Names}
+		if opt.CanonicalName() != test.Canonical {
+			t.Errorf("Invalid canonical name.  Names: %q, Expected: %q, Received: %q", test.Names, test.Canonical, opt.CanonicalName())
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// +build go1.21
+
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package writ
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	RegisterDecoder(reflect.TypeOf(slog.Level(0)), func(val interface{}) OptionDecoder {
+		return NewSlogLevelDecoder(val.(*slog.Level))
+	})
+}
+
+// NewSlogLevelDecoder builds an OptionDecoder for log/slog levels, such as
+// --log-level=debug.  Level names are matched case-insensitively, and may
+// include an offset as accepted by slog.Level.UnmarshalText(), such as
+// "info+2".  Numeric levels, such as -4, are also accepted.  NewOptionDecoder()
+// uses NewSlogLevelDecoder for slog.Level fields.  It's only available when
+// compiling with go 1.21+.
+func NewSlogLevelDecoder(val *slog.Level) OptionDecoder {
+	if val == nil {
+		panicOption("NewSlogLevelDecoder called with a nil pointer")
+	}
+	return slogLevelDecoder{val}
+}
+
+type slogLevelDecoder struct {
+	value *slog.Level
+}
+
+func (d slogLevelDecoder) Decode(arg string) error {
+	trimmed := strings.TrimSpace(arg)
+	if n, err := strconv.Atoi(trimmed); err == nil {
+		*d.value = slog.Level(n)
+		return nil
+	}
+	var level slog.Level
+	err := level.UnmarshalText([]byte(trimmed))
+	if err != nil {
+		return fmt.Errorf("value %q is not a valid log level (must be debug, info, warn, error, or a number)", arg)
+	}
+	*d.value = level
+	return nil
+}
+
+func (d slogLevelDecoder) Value() interface{} {
+	return *d.value
+}
+
+func (d slogLevelDecoder) placeholder() string {
+	return "LEVEL"
+}
@@ -0,0 +1,96 @@
+// +build go1.21
+
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package writ
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLevelDecoder(t *testing.T) {
+	tests := []struct {
+		Arg   string
+		Valid bool
+		Value slog.Level
+	}{
+		{Arg: "debug", Valid: true, Value: slog.LevelDebug},
+		{Arg: "INFO", Valid: true, Value: slog.LevelInfo},
+		{Arg: "Warn", Valid: true, Value: slog.LevelWarn},
+		{Arg: "error", Valid: true, Value: slog.LevelError},
+		{Arg: " info ", Valid: true, Value: slog.LevelInfo},
+		{Arg: "info+2", Valid: true, Value: slog.LevelInfo + 2},
+		{Arg: "error-1", Valid: true, Value: slog.LevelError - 1},
+		{Arg: "-4", Valid: true, Value: slog.LevelDebug},
+		{Arg: "12", Valid: true, Value: slog.Level(12)},
+		{Arg: "warning", Valid: false},
+		{Arg: "info+", Valid: false},
+		{Arg: "", Valid: false},
+	}
+	for _, test := range tests {
+		var value slog.Level
+		err := NewSlogLevelDecoder(&value).Decode(test.Arg)
+		if !test.Valid {
+			if err == nil {
+				t.Errorf("Expected error but none received. Arg: %q, Value: %s", test.Arg, value)
+			} else if !strings.Contains(err.Error(), "debug, info, warn, error") {
+				t.Errorf("Expected error to list the valid levels. Arg: %q, Error: %s", test.Arg, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received unexpected error. Arg: %q, Error: %s", test.Arg, err)
+			continue
+		}
+		if value != test.Value {
+			t.Errorf("Decoded value is invalid. Arg: %q, Expected: %s, Received: %s", test.Arg, test.Value, value)
+		}
+	}
+}
+
+type slogLevelFieldSpec struct {
+	Level   slog.Level `option:"l, log-level" description:"The log level"`
+	Default slog.Level `option:"d" default:"warn"`
+}
+
+var slogLevelFieldTests = []fieldTest{
+	{Args: []string{}, Valid: true, Field: "Level", Value: slog.LevelInfo},
+	{Args: []string{"--log-level", "debug"}, Valid: true, Field: "Level", Value: slog.LevelDebug},
+	{Args: []string{"-l", "ERROR"}, Valid: true, Field: "Level", Value: slog.LevelError},
+	{Args: []string{"-l", "8"}, Valid: true, Field: "Level", Value: slog.LevelError},
+	{Args: []string{"-l", "verbose"}, Valid: false},
+	{Args: []string{}, Valid: true, Field: "Default", Value: slog.LevelWarn},
+}
+
+func TestSlogLevelFields(t *testing.T) {
+	for _, test := range slogLevelFieldTests {
+		spec := &slogLevelFieldSpec{}
+		runFieldTest(t, spec, test)
+	}
+
+	cmd := New("test", &slogLevelFieldSpec{})
+	placeholder := optionPlaceholder(cmd.Option("log-level"))
+	if placeholder != "LEVEL" {
+		t.Errorf("Invalid placeholder.  Expected: %q, Received: %q", "LEVEL", placeholder)
+	}
+}
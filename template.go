@@ -26,7 +26,13 @@ import (
 	"text/template"
 )
 
-var defaultTemplate = template.Must(template.New("Help").Funcs(templateFuncs).Parse(HelpText))
+var defaultTemplate = template.Must(template.New("Help").Funcs(templateFuncs).Parse(DefaultHelpText))
+
+// DefaultHelpText is the text of the default help template.  It's identical
+// to HelpText, and is exported under the same name for every build variant.
+// Custom templates may start from a copy of DefaultHelpText, parsed with
+// TemplateFuncs() registered.
+const DefaultHelpText = HelpText
 
 // HelpText is used by Command.WriteHelp() and Command.ExitHelp() to generate
 // help content.
@@ -46,25 +52,36 @@ const HelpText = `{{/**/ -}}
 {{end -}}
 
 {{define "Usage" -}}
-{{with .Help.Usage -}}{{.}}{{"\n"}}{{end -}}
+{{with .Help.Usage -}}{{wrapUsage . 80}}{{"\n"}}{{end -}}
 {{end -}}
 
 {{define "Header"}}{{with .Help.Header}}{{.}}{{"\n"}}{{end}}{{end -}}
 
 {{define "Body" -}}
+{{block "Arguments" .}}{{end -}}
 {{block "OptionGroups" .}}{{end -}}
 {{block "CommandGroups" .}}{{end -}}
+{{block "Examples" .}}{{end -}}
+{{end -}}
+
+{{define "Arguments" -}}
+{{with .ArgNames -}}
+  {{"\n"}}Arguments:{{"\n" -}}
+  {{range .}}{{formatArgument . (index $.Help.ArgDescriptions .)}}{{"\n"}}{{end -}}
+{{end -}}
 {{end -}}
 
 {{define "OptionGroups" -}}
-{{with .Help.OptionGroups -}}
-  {{range .}}{{block "OptionGroup" .}}{{end}}{{end -}}
+{{if .Help.Compact -}}
+  {{range .Help.VisibleOptionGroups}}{{block "CompactOptionGroup" .}}{{end}}{{end -}}
+{{else -}}
+  {{range .Help.VisibleOptionGroups}}{{block "OptionGroup" .}}{{end}}{{end -}}
 {{end -}}
 {{end -}}
 
 {{define "OptionGroup" -}}
 {{"\n" -}}
-{{with .Header}}{{.}}{{"\n"}}{{end -}}
+{{if not .SuppressHeader}}{{with .Header}}{{.}}{{"\n"}}{{end}}{{end -}}
 {{with .Options -}}
   {{range .}}{{block "OptionHelp" .}}{{end}}{{end -}}
 {{end -}}
@@ -73,6 +90,17 @@ const HelpText = `{{/**/ -}}
 
 {{define "OptionHelp"}}{{formatOption .}}{{"\n"}}{{end -}}
 
+{{define "CompactOptionGroup" -}}
+{{"\n" -}}
+{{if not .SuppressHeader}}{{with .Header}}{{.}}{{"\n"}}{{end}}{{end -}}
+{{with .Options -}}
+  {{range .}}{{block "CompactOptionHelp" .}}{{end}}{{end -}}
+{{end -}}
+{{with .Footer}}{{.}}{{"\n"}}{{end -}}
+{{end -}}
+
+{{define "CompactOptionHelp"}}{{formatOptionCompact .}}{{"\n"}}{{end -}}
+
 {{define "CommandGroups" -}}
 {{with .Help.CommandGroups -}}
   {{range .}}{{block "CommandGroup" .}}{{end}}{{end -}}
@@ -90,5 +118,12 @@ const HelpText = `{{/**/ -}}
 
 {{define "CommandHelp"}}{{formatCommand .}}{{"\n"}}{{end -}}
 
+{{define "Examples" -}}
+{{with .Help.Examples -}}
+  {{"\n"}}Examples:{{"\n" -}}
+  {{range .}}{{formatExample .}}{{"\n"}}{{end -}}
+{{end -}}
+{{end -}}
+
 {{define "Footer"}}{{with .Help.Footer}}{{"\n"}}{{.}}{{"\n"}}{{end}}{{end -}}
 `